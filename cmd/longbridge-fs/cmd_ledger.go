@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"longbridge-fs/internal/ledger"
+
+	"github.com/spf13/cobra"
+)
+
+func ledgerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ledger",
+		Short: "Trade ledger operations",
+		Long:  `Inspect and check the FS trade ledger (trade/beancount.txt and trade/blocks/).`,
+	}
+
+	cmd.AddCommand(verifyLedgerCmd())
+	cmd.AddCommand(queryLedgerCmd())
+	cmd.AddCommand(exportLedgerCmd())
+	cmd.AddCommand(lintLedgerCmd())
+
+	return cmd
+}
+
+func verifyLedgerCmd() *cobra.Command {
+	var root string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the hash chain of ledger blocks",
+		Long: `Verify the compacted ledger blocks under trade/blocks/.
+
+Checks each block's data against the sha256 in its meta.txt, each block's
+prev_hash against the previous block, and the chain_head in the live
+ledger's header against the last block. Exits non-zero if any block was
+edited, deleted, inserted or reordered.
+
+Examples:
+  longbridge-fs ledger verify --root ./fs
+  longbridge-fs ledger verify --root ./fs/accounts/live --format json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runVerifyLedger(root)
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", ".", "FS root (or account) directory")
+	return cmd
+}
+
+func runVerifyLedger(root string) error {
+	report, err := ledger.VerifyChain(root)
+	if err != nil {
+		return fmt.Errorf("failed to verify ledger: %w", err)
+	}
+
+	if outputFormat == "json" {
+		if err := outputJSON(report); err != nil {
+			return err
+		}
+	} else {
+		if len(report.Issues) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "Severity\tBlock\tProblem")
+			fmt.Fprintln(w, "--------\t-----\t-------")
+			for _, is := range report.Issues {
+				block := is.BlockID
+				if block == "" {
+					block = "(ledger)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", is.Severity, block, is.Message)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		if report.OK {
+			fmt.Printf("✓ Ledger chain intact (%d blocks", report.Blocks)
+			if report.Head != "" {
+				fmt.Printf(", head %s", report.Head[:12])
+			}
+			fmt.Println(")")
+		}
+	}
+
+	if !report.OK {
+		return fmt.Errorf("ledger verification failed: %d block(s) checked, chain broken", report.Blocks)
+	}
+	return nil
+}
+
+func queryLedgerCmd() *cobra.Command {
+	var root string
+	var summary bool
+	var f ledger.QueryFilter
+
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "Query ledger history across blocks",
+		Long: `Query the trade ledger history: the compacted blocks under
+trade/blocks/ followed by the live trade/beancount.txt.
+
+Filters combine with AND; list flags accept several comma-separated values.
+--intent-id, --source, --rebalance-id and --signal-ref also match the
+SUBMITTED/EXECUTION/REJECTION entries of the matching ORDER.
+With --summary, prints bought/sold quantity, average prices and fees per
+symbol over the matching fills instead of the entries.
+
+Examples:
+  longbridge-fs ledger query --root ./fs --type EXECUTION --symbol AAPL.US
+  longbridge-fs ledger query --root ./fs --from 2026-03-01 --to 2026-03-31 --summary
+  longbridge-fs ledger query --root ./fs --source rebalance --format csv`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runQueryLedger(root, f, summary)
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", ".", "FS root (or account) directory")
+	cmd.Flags().StringSliceVar(&f.Types, "type", nil, "Entry types (ORDER, SUBMITTED, EXECUTION, REJECTION, ALGO)")
+	cmd.Flags().StringSliceVar(&f.Symbols, "symbol", nil, "Symbols (AAPL.US, or AAPL for any market)")
+	cmd.Flags().StringSliceVar(&f.Sides, "side", nil, "Sides (BUY, SELL)")
+	cmd.Flags().StringVar(&f.From, "from", "", "First date, YYYY-MM-DD")
+	cmd.Flags().StringVar(&f.To, "to", "", "Last date, YYYY-MM-DD")
+	cmd.Flags().StringVar(&f.IntentID, "intent-id", "", "Intent ID (also matches group legs)")
+	cmd.Flags().StringVar(&f.Source, "source", "", "Order source (e.g. rebalance, risk_trigger)")
+	cmd.Flags().StringVar(&f.RebalanceID, "rebalance-id", "", "Rebalance ID")
+	cmd.Flags().StringVar(&f.SignalRef, "signal-ref", "", "Signal reference listed in signal_refs")
+	cmd.Flags().BoolVar(&summary, "summary", false, "Aggregate fills per symbol")
+	return cmd
+}
+
+func runQueryLedger(root string, f ledger.QueryFilter, summary bool) error {
+	if err := checkDateRange(f.From, f.To); err != nil {
+		return err
+	}
+	history, err := ledger.LoadHistory(root)
+	if err != nil {
+		return fmt.Errorf("failed to load ledger: %w", err)
+	}
+	entries := ledger.Query(history, f)
+
+	if summary {
+		return outputLedgerSummary(ledger.Summarize(entries))
+	}
+	return outputLedgerEntries(entries)
+}
+
+// ledgerColumns are the meta fields shown per entry in table and csv output.
+var ledgerColumns = []string{"intent_id", "symbol", "side", "qty", "price", "status", "order_id", "reason"}
+
+func outputLedgerEntries(entries []ledger.HistoryEntry) error {
+	switch outputFormat {
+	case "json":
+		out := make([]map[string]interface{}, 0, len(entries))
+		for _, h := range entries {
+			out = append(out, map[string]interface{}{
+				"date":  h.Date,
+				"type":  h.Type,
+				"block": h.Block,
+				"meta":  h.Meta,
+			})
+		}
+		return outputJSON(out)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(append([]string{"date", "type", "block"}, ledgerColumns...))
+		for _, h := range entries {
+			row := []string{h.Date, h.Type, h.Block}
+			for _, c := range ledgerColumns {
+				row = append(row, h.Meta[c])
+			}
+			w.Write(row)
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Date\tType\tIntent\tSymbol\tSide\tQty\tPrice\tStatus\tBlock")
+	fmt.Fprintln(w, "----\t----\t------\t------\t----\t---\t-----\t------\t-----")
+	for _, h := range entries {
+		status := h.Meta["status"]
+		if h.Type == "REJECTION" && h.Meta["reason"] != "" {
+			status = h.Meta["reason"]
+		}
+		block := h.Block
+		if block == "" {
+			block = "(live)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			h.Date, h.Type, h.Meta["intent_id"], h.Meta["symbol"], h.Meta["side"],
+			h.Meta["qty"], h.Meta["price"], status, block)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d entries\n", len(entries))
+	return nil
+}
+
+func outputLedgerSummary(rows []ledger.SymbolSummary) error {
+	switch outputFormat {
+	case "json":
+		return outputJSON(rows)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"symbol", "fills", "bought_qty", "avg_buy_price", "sold_qty", "avg_sell_price", "net_qty", "fees"})
+		for _, r := range rows {
+			w.Write([]string{r.Symbol, strconv.Itoa(r.Fills), num(r.BoughtQty), num(r.AvgBuyPrice),
+				num(r.SoldQty), num(r.AvgSellPrice), num(r.NetQty), num(r.Fees)})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Symbol\tFills\tBought\tAvg Buy\tSold\tAvg Sell\tNet\tFees")
+	fmt.Fprintln(w, "------\t-----\t------\t-------\t----\t--------\t---\t----")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%.4f\t%s\t%.4f\t%s\t%.2f\n",
+			r.Symbol, r.Fills, num(r.BoughtQty), r.AvgBuyPrice, num(r.SoldQty), r.AvgSellPrice, num(r.NetQty), r.Fees)
+	}
+	return w.Flush()
+}
+
+// num formats a quantity or amount without trailing zeros.
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func exportLedgerCmd() *cobra.Command {
+	var root, output string
+	var f ledger.QueryFilter
+
+	cmd := &cobra.Command{
+		Use:   "export <csv|jsonl|blotter>",
+		Short: "Export ledger history for accounting and data pipelines",
+		Long: `Export the ORDER, EXECUTION and REJECTION entries of the trade ledger,
+across all compacted blocks and the live trade/beancount.txt.
+
+Formats:
+  csv      one row per entry, fixed columns (see docs/api-reference.md)
+  jsonl    one JSON object per entry, same keys as the csv columns
+  blotter  csv trade blotter: one row per fill with gross, fee and signed
+           net amounts in the trading currency
+
+--from/--to filter on the entry date (for the blotter, the header date of
+the EXECUTION entry).
+
+Examples:
+  longbridge-fs ledger export csv --root ./fs -o ledger.csv
+  longbridge-fs ledger export jsonl --root ./fs --from 2026-03-01
+  longbridge-fs ledger export blotter --root ./fs --from 2026-03-01 --to 2026-03-31`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runExportLedger(root, args[0], output, f)
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", ".", "FS root (or account) directory")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default stdout)")
+	cmd.Flags().StringVar(&f.From, "from", "", "First date, YYYY-MM-DD")
+	cmd.Flags().StringVar(&f.To, "to", "", "Last date, YYYY-MM-DD")
+	cmd.Flags().StringSliceVar(&f.Symbols, "symbol", nil, "Symbols (AAPL.US, or AAPL for any market)")
+	return cmd
+}
+
+func runExportLedger(root, format, output string, f ledger.QueryFilter) error {
+	format = strings.ToLower(format)
+	known := false
+	for _, ef := range ledger.ExportFormats {
+		known = known || ef == format
+	}
+	if !known {
+		return fmt.Errorf("unknown export format %q (want %s)", format, strings.Join(ledger.ExportFormats, ", "))
+	}
+	if err := checkDateRange(f.From, f.To); err != nil {
+		return err
+	}
+	history, err := ledger.LoadHistory(root)
+	if err != nil {
+		return fmt.Errorf("failed to load ledger: %w", err)
+	}
+	f.Types = ledger.ExportTypes
+	entries := ledger.Query(history, f)
+
+	if output == "" {
+		return ledger.Export(os.Stdout, format, history, entries)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", output, err)
+	}
+	if err := ledger.Export(file, format, history, entries); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to export: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "✓ Exported %d entries to %s\n", len(entries), output)
+	}
+	return nil
+}
+
+// checkDateRange validates --from/--to values.
+func checkDateRange(dates ...string) error {
+	for _, d := range dates {
+		if _, err := time.Parse("2006-01-02", d); d != "" && err != nil {
+			return fmt.Errorf("invalid date %q, want YYYY-MM-DD", d)
+		}
+	}
+	return nil
+}
+
+func lintLedgerCmd() *cobra.Command {
+	var root, file string
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check ledger entries for syntax and schema errors",
+		Long: `Check the live ledger (or any file of entries) the way the controller
+reads it, and report with line numbers what it would silently ignore or
+reject:
+
+  BAD_HEADER        dated line that is not YYYY-MM-DD * "TYPE" "description"
+  ORPHAN_META       meta line outside any entry
+  BAD_META          line the parser ignores (key=value, missing ";")
+  NOT_INDENTED      meta line without indentation
+  DUPLICATE_KEY     key set twice in one entry
+  UNKNOWN_TYPE      entry type other than ORDER/SUBMITTED/EXECUTION/REJECTION/ALGO
+  UNKNOWN_KEY       ORDER key the controller doesn't read (with a suggestion)
+  MISSING_FIELD     required ORDER field absent
+  INVALID_VALUE     ORDER field the controller would reject
+  DUPLICATE_INTENT  intent_id of an earlier ORDER in the file
+
+Exits non-zero if any ERROR is found; WARNINGs alone pass.
+
+Examples:
+  longbridge-fs ledger lint --root ./fs
+  longbridge-fs ledger lint --file order.txt --format json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				file = filepath.Join(root, "trade", "beancount.txt")
+			}
+			return runLintLedger(file)
+		},
+	}
+
+	cmd.Flags().StringVar(&root, "root", ".", "FS root (or account) directory")
+	cmd.Flags().StringVar(&file, "file", "", "Lint this file instead of the live ledger (e.g. entries before appending)")
+	return cmd
+}
+
+func runLintLedger(path string) error {
+	report, err := ledger.LintLedgerFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to lint ledger: %w", err)
+	}
+
+	if outputFormat == "json" {
+		if err := outputJSON(report); err != nil {
+			return err
+		}
+	} else {
+		if len(report.Diagnostics) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "Line\tSeverity\tCode\tIntent\tProblem")
+			fmt.Fprintln(w, "----\t--------\t----\t------\t-------")
+			for _, d := range report.Diagnostics {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", d.Line, d.Severity, d.Code, d.IntentID, d.Message)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%d entries, %d error(s), %d warning(s)\n", report.Entries, report.Errors, report.Warnings)
+	}
+
+	if report.Errors > 0 {
+		return fmt.Errorf("ledger lint failed: %d error(s)", report.Errors)
+	}
+	return nil
+}
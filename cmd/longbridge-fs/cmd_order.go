@@ -6,8 +6,10 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/longbridge/openapi-go/trade"
-	"github.com/shopspring/decimal"
+	"longbridge-fs/internal/broker"
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/model"
+
 	"github.com/spf13/cobra"
 )
 
@@ -31,6 +33,8 @@ func submitOrderCmd() *cobra.Command {
 		price     string
 		tif       string
 		remark    string
+		market    string
+		cond      model.ParsedOrder // conditional order fields
 	)
 
 	cmd := &cobra.Command{
@@ -39,13 +43,17 @@ func submitOrderCmd() *cobra.Command {
 		Long: `Submit a new order to buy or sell a security.
 
 Side: BUY or SELL
-Order Type: MARKET, LIMIT, ELO, ALO (default: MARKET)
+Order Type: MARKET, LIMIT, ELO, ALO, LIT, MIT, TSLPAMT, TSLPPCT (default: MARKET)
 Time In Force: DAY, GTC, GTD (default: DAY)
+Market: taken from the symbol suffix (AAPL.US, 700.HK), else --market
 
 Examples:
   longbridge-fs order submit AAPL.US BUY 100
   longbridge-fs order submit TSLA.US BUY 50 --type LIMIT --price 180.50
-  longbridge-fs order submit 700.HK SELL 1000 --type LIMIT --price 350.00 --tif GTC`,
+  longbridge-fs order submit 700.HK SELL 1000 --type LIMIT --price 350.00 --tif GTC
+  longbridge-fs order submit 700 BUY 100 --market HK
+  longbridge-fs order submit AAPL.US SELL 100 --type MIT --trigger-price 170.00 --tif GTC
+  longbridge-fs order submit AAPL.US SELL 100 --type TSLPPCT --trailing-percent 5 --limit-offset 0.10`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 3 {
 				return fmt.Errorf("requires exactly 3 arguments: symbol, side, quantity")
@@ -58,19 +66,25 @@ Examples:
 				return fmt.Errorf("invalid quantity: %w", err)
 			}
 
-			return runSubmitOrder(symbol, side, qty, orderType, price, tif, remark)
+			return runSubmitOrder(symbol, side, qty, orderType, price, tif, remark, market, cond)
 		},
 	}
 
-	cmd.Flags().StringVar(&orderType, "type", "MARKET", "Order type (MARKET, LIMIT, ELO, ALO)")
+	cmd.Flags().StringVar(&orderType, "type", "MARKET", "Order type (MARKET, LIMIT, ELO, ALO, LIT, MIT, TSLPAMT, TSLPPCT)")
 	cmd.Flags().StringVar(&price, "price", "", "Limit price (required for LIMIT orders)")
 	cmd.Flags().StringVar(&tif, "tif", "DAY", "Time in force (DAY, GTC, GTD)")
 	cmd.Flags().StringVar(&remark, "remark", "", "Order remark/comment")
+	cmd.Flags().StringVar(&market, "market", "US", "Market of a symbol without suffix (US, HK, CN, SG)")
+	cmd.Flags().StringVar(&cond.ExpireDate, "expire-date", "", "Expiry date YYYY-MM-DD (required for GTD)")
+	cmd.Flags().StringVar(&cond.TriggerPrice, "trigger-price", "", "Trigger price (LIT, MIT)")
+	cmd.Flags().StringVar(&cond.TrailingAmount, "trailing-amount", "", "Trailing amount (TSLPAMT)")
+	cmd.Flags().StringVar(&cond.TrailingPercent, "trailing-percent", "", "Trailing percent (TSLPPCT)")
+	cmd.Flags().StringVar(&cond.LimitOffset, "limit-offset", "", "Limit offset from the trigger (TSLPAMT, TSLPPCT)")
 
 	return cmd
 }
 
-func runSubmitOrder(symbol, sideStr string, qty uint64, orderTypeStr, priceStr, tifStr, remark string) error {
+func runSubmitOrder(symbol, sideStr string, qty uint64, orderTypeStr, priceStr, tifStr, remark, market string, cond model.ParsedOrder) error {
 	ctx := context.Background()
 
 	tc, err := createTradeContext()
@@ -78,72 +92,54 @@ func runSubmitOrder(symbol, sideStr string, qty uint64, orderTypeStr, priceStr,
 		return fmt.Errorf("failed to initialize trade context: %w", err)
 	}
 
-	// Map order type
-	var orderType trade.OrderType
-	switch strings.ToUpper(orderTypeStr) {
-	case "LIMIT", "LO":
-		orderType = trade.OrderType("LO")
-	case "MARKET", "MO":
-		orderType = trade.OrderType("MO")
-	case "ELO":
-		orderType = trade.OrderType("ELO")
-	case "ALO":
-		orderType = trade.OrderType("ALO")
-	default:
-		orderType = trade.OrderType("MO")
-	}
-
-	// Map side
-	var side trade.OrderSide
+	// Normalize side
 	switch strings.ToUpper(sideStr) {
 	case "BUY", "B":
-		side = trade.OrderSide("Buy")
+		sideStr = "BUY"
 	case "SELL", "S":
-		side = trade.OrderSide("Sell")
+		sideStr = "SELL"
 	default:
 		return fmt.Errorf("invalid side: %s (must be BUY or SELL)", sideStr)
 	}
 
-	// Map time in force
-	var tif trade.TimeType
-	switch strings.ToUpper(tifStr) {
-	case "DAY":
-		tif = trade.TimeType("Day")
-	case "GTC":
-		tif = trade.TimeType("GoodTilCanceled")
-	case "GTD":
-		tif = trade.TimeType("GoodTilDate")
-	default:
-		tif = trade.TimeType("Day")
+	// A symbol suffix names the market, as in ledger.FullSymbol
+	if i := strings.LastIndex(symbol, "."); i >= 0 {
+		market = symbol[i+1:]
 	}
-
-	// Build order request
-	order := &trade.SubmitOrder{
-		Symbol:            symbol,
-		OrderType:         orderType,
-		Side:              side,
-		SubmittedQuantity: qty,
-		TimeInForce:       tif,
-		Remark:            remark,
+	market = strings.ToUpper(market)
+	if market == "" {
+		return fmt.Errorf("market is required for symbol %s", symbol)
 	}
 
-	// Add price for limit orders
-	if orderType == trade.OrderType("LO") || orderType == trade.OrderType("ELO") || orderType == trade.OrderType("ALO") {
-		if priceStr == "" {
-			return fmt.Errorf("price is required for %s orders", orderTypeStr)
-		}
-		price, err := decimal.NewFromString(priceStr)
-		if err != nil {
-			return fmt.Errorf("invalid price: %w", err)
-		}
-		order.SubmittedPrice = price
+	o := model.ParsedOrder{
+		Side:       sideStr,
+		Symbol:     symbol,
+		Qty:        strconv.FormatUint(qty, 10),
+		OrderType:  strings.ToUpper(orderTypeStr),
+		TIF:        strings.ToUpper(tifStr),
+		Price:      priceStr,
+		ExpireDate: cond.ExpireDate,
+		Market:     market,
+		Remark:     remark,
+
+		TriggerPrice:    cond.TriggerPrice,
+		TrailingAmount:  cond.TrailingAmount,
+		TrailingPercent: cond.TrailingPercent,
+		LimitOffset:     cond.LimitOffset,
+	}
+	if broker.IsGroupOrder(o.OrderType) {
+		return fmt.Errorf("%s orders are only supported through the ledger", o.OrderType)
+	}
+	if err := ledger.ValidateOrder(o); err != nil {
+		return err
 	}
 
 	// Submit order
-	orderID, err := tc.SubmitOrder(ctx, order)
+	info, err := broker.NewLongbridgeBroker(tc).Submit(ctx, o)
 	if err != nil {
 		return fmt.Errorf("failed to submit order: %w", err)
 	}
+	orderID := info.OrderID
 
 	// Output result
 	if outputFormat == "json" {
@@ -200,7 +196,7 @@ func runCancelOrder(orderID string) error {
 	}
 
 	// Cancel order
-	err = tc.CancelOrder(ctx, orderID)
+	err = broker.NewLongbridgeBroker(tc).Cancel(ctx, orderID)
 	if err != nil {
 		return fmt.Errorf("failed to cancel order: %w", err)
 	}
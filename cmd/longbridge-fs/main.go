@@ -20,6 +20,7 @@ import (
 	"longbridge-fs/internal/risk"
 	signalpkg "longbridge-fs/internal/signal"
 
+	"github.com/longbridge/openapi-go/config"
 	"github.com/longbridge/openapi-go/quote"
 	"github.com/longbridge/openapi-go/trade"
 	"github.com/spf13/cobra"
@@ -63,6 +64,7 @@ Designed for scripting, AI-agent tool-calling, and daily trading workflows.`,
 	// Legacy file-system based commands
 	rootCmd.AddCommand(initCmd())
 	rootCmd.AddCommand(controllerCmd())
+	rootCmd.AddCommand(ledgerCmd())
 
 	// New AI-native CLI commands
 
@@ -99,7 +101,7 @@ Designed for scripting, AI-agent tool-calling, and daily trading workflows.`,
 
 // initCmd creates the init subcommand
 func initCmd() *cobra.Command {
-	var root string
+	var root, name string
 
 	cmd := &cobra.Command{
 		Use:   "init",
@@ -107,21 +109,43 @@ func initCmd() *cobra.Command {
 		Long: `Initialize directory structure for longbridge-fs
 
 Creates the required directories and default configuration files
-for the file system-based trading framework.`,
+for the file system-based trading framework. With --account, the account
+tree (account/, trade/, portfolio/) is created under accounts/{name}/
+instead of at the root.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runInit(root)
+			return runInit(root, name)
 		},
 	}
 
 	cmd.Flags().StringVar(&root, "root", ".", "FS root directory")
+	cmd.Flags().StringVar(&name, "account", "", "Create the account tree under accounts/{name}/ instead of the root")
 	return cmd
 }
 
-func runInit(root string) error {
+func runInit(root, name string) error {
+	if err := initShared(root); err != nil {
+		return err
+	}
+	dir := root
+	if name != "" {
+		dir = account.Dir(root, name)
+	}
+	if err := initAccount(dir); err != nil {
+		return err
+	}
+
+	log.Printf("✓ Successfully initialized FS at %s", root)
+	if name != "" {
+		log.Printf("✓ Account %q initialized at %s", name, dir)
+	}
+	log.Printf("✓ Phase 1: Five-layer harness directories created")
+	return nil
+}
+
+// initShared creates what all accounts share: quotes, research, signals and
+// the audit log.
+func initShared(root string) error {
 	dirs := []string{
-		// Existing directories
-		filepath.Join(root, "account"),
-		filepath.Join(root, "trade", "blocks"),
 		filepath.Join(root, "quote", "hold"),
 		filepath.Join(root, "quote", "track"),
 		filepath.Join(root, "quote", "subscribe"),
@@ -134,11 +158,6 @@ func runInit(root string) error {
 		// Phase 1: L2 Signal Layer
 		filepath.Join(root, "signal", "definitions"),
 		filepath.Join(root, "signal", "output"),
-		// Phase 1: L3 Portfolio Layer
-		filepath.Join(root, "portfolio", "rebalance"),
-		filepath.Join(root, "portfolio", "history"),
-		// Phase 1: L4 Risk Control Layer (new structure)
-		filepath.Join(root, "trade", "risk"),
 		// Phase 1: Audit Layer
 		filepath.Join(root, "audit"),
 	}
@@ -151,39 +170,6 @@ func runInit(root string) error {
 		}
 	}
 
-	// Default beancount ledger
-	bcPath := filepath.Join(root, "trade", "beancount.txt")
-	if _, err := os.Stat(bcPath); os.IsNotExist(err) {
-		if err := os.WriteFile(bcPath, []byte("; beancount append-only trade ledger\n"), 0644); err != nil {
-			return fmt.Errorf("failed to create beancount ledger: %w", err)
-		}
-		if verbose {
-			log.Printf("created file: %s", bcPath)
-		}
-	}
-
-	// Default account state
-	statePath := filepath.Join(root, "account", "state.json")
-	if _, err := os.Stat(statePath); os.IsNotExist(err) {
-		if err := os.WriteFile(statePath, []byte(`{"updated_at":"","cash":[],"positions":[],"orders":[]}`+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to create account state: %w", err)
-		}
-		if verbose {
-			log.Printf("created file: %s", statePath)
-		}
-	}
-
-	// Default risk control config (legacy, kept for backward compatibility)
-	rcPath := filepath.Join(root, "trade", "risk_control.json")
-	if _, err := os.Stat(rcPath); os.IsNotExist(err) {
-		if err := os.WriteFile(rcPath, []byte("{}\n"), 0644); err != nil {
-			return fmt.Errorf("failed to create risk control config: %w", err)
-		}
-		if verbose {
-			log.Printf("created file: %s", rcPath)
-		}
-	}
-
 	// Phase 1: L1 Research watchlist
 	watchlistPath := filepath.Join(root, "research", "watchlist.json")
 	if _, err := os.Stat(watchlistPath); os.IsNotExist(err) {
@@ -233,8 +219,96 @@ func runInit(root string) error {
 		}
 	}
 
+	return nil
+}
+
+// initAccount creates the per-account tree under dir: account state, the
+// trade ledger, risk policy and portfolio. The FS root itself is the
+// default account.
+func initAccount(dir string) error {
+	dirs := []string{
+		filepath.Join(dir, "account"),
+		filepath.Join(dir, "trade", "blocks"),
+		// Phase 1: L3 Portfolio Layer
+		filepath.Join(dir, "portfolio", "rebalance"),
+		filepath.Join(dir, "portfolio", "history"),
+		// Phase 1: L4 Risk Control Layer (new structure)
+		filepath.Join(dir, "trade", "risk"),
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", d, err)
+		}
+		if verbose {
+			log.Printf("created directory: %s", d)
+		}
+	}
+
+	// Default beancount ledger
+	bcPath := filepath.Join(dir, "trade", "beancount.txt")
+	if _, err := os.Stat(bcPath); os.IsNotExist(err) {
+		if err := os.WriteFile(bcPath, []byte("; beancount append-only trade ledger\n"), 0644); err != nil {
+			return fmt.Errorf("failed to create beancount ledger: %w", err)
+		}
+		if verbose {
+			log.Printf("created file: %s", bcPath)
+		}
+	}
+
+	// Beancount entry point: commodities, open directives, ledger includes
+	accountsPath := filepath.Join(dir, "trade", ledger.AccountsFile)
+	if _, err := os.Stat(accountsPath); os.IsNotExist(err) {
+		if err := ledger.WriteAccounts(filepath.Join(dir, "trade")); err != nil {
+			return fmt.Errorf("failed to create %s: %w", ledger.AccountsFile, err)
+		}
+		if verbose {
+			log.Printf("created file: %s", accountsPath)
+		}
+	}
+
+	// Default account state
+	statePath := filepath.Join(dir, "account", "state.json")
+	if _, err := os.Stat(statePath); os.IsNotExist(err) {
+		if err := os.WriteFile(statePath, []byte(`{"updated_at":"","cash":[],"positions":[],"orders":[]}`+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to create account state: %w", err)
+		}
+		if verbose {
+			log.Printf("created file: %s", statePath)
+		}
+	}
+
+	// Default risk control config (legacy, kept for backward compatibility)
+	rcPath := filepath.Join(dir, "trade", "risk_control.json")
+	if _, err := os.Stat(rcPath); os.IsNotExist(err) {
+		if err := os.WriteFile(rcPath, []byte("{}\n"), 0644); err != nil {
+			return fmt.Errorf("failed to create risk control config: %w", err)
+		}
+		if verbose {
+			log.Printf("created file: %s", rcPath)
+		}
+	}
+
+	// Paper exchange settings used by --mock mode
+	paperPath := filepath.Join(dir, "trade", "paper.json")
+	if _, err := os.Stat(paperPath); os.IsNotExist(err) {
+		paperDefault := `{
+  "slippage_bps": 5,
+  "commission_per_share": 0.005,
+  "commission_pct": 0,
+  "commission_min": 1.0,
+  "max_volume_pct": 0.1
+}
+`
+		if err := os.WriteFile(paperPath, []byte(paperDefault), 0644); err != nil {
+			return fmt.Errorf("failed to create paper exchange config: %w", err)
+		}
+		if verbose {
+			log.Printf("created file: %s", paperPath)
+		}
+	}
+
 	// Phase 1: L3 Portfolio current
-	currentPortfolioPath := filepath.Join(root, "portfolio", "current.json")
+	currentPortfolioPath := filepath.Join(dir, "portfolio", "current.json")
 	if _, err := os.Stat(currentPortfolioPath); os.IsNotExist(err) {
 		currentDefault := `{
   "updated_at": "",
@@ -253,7 +327,7 @@ func runInit(root string) error {
 	}
 
 	// Phase 1: L4 Risk policy
-	policyPath := filepath.Join(root, "trade", "risk", "policy.json")
+	policyPath := filepath.Join(dir, "trade", "risk", "policy.json")
 	if _, err := os.Stat(policyPath); os.IsNotExist(err) {
 		policyDefault := `{
   "version": 1,
@@ -282,7 +356,7 @@ func runInit(root string) error {
 	}
 
 	// Phase 1: L4 Pre-trade rules
-	preTradeRulesPath := filepath.Join(root, "trade", "risk", "pre_trade.json")
+	preTradeRulesPath := filepath.Join(dir, "trade", "risk", "pre_trade.json")
 	if _, err := os.Stat(preTradeRulesPath); os.IsNotExist(err) {
 		preTradeDefault := `{
   "max_single_order_pct": 0.10,
@@ -303,7 +377,7 @@ func runInit(root string) error {
 	}
 
 	// Phase 1: L4 Position limits
-	positionLimitsPath := filepath.Join(root, "trade", "risk", "position_limits.json")
+	positionLimitsPath := filepath.Join(dir, "trade", "risk", "position_limits.json")
 	if _, err := os.Stat(positionLimitsPath); os.IsNotExist(err) {
 		positionLimitsDefault := `{
   "max_position_pct": 0.25,
@@ -321,7 +395,7 @@ func runInit(root string) error {
 	}
 
 	// Phase 1: L4 Daily limits
-	dailyLimitsPath := filepath.Join(root, "trade", "risk", "daily_limits.json")
+	dailyLimitsPath := filepath.Join(dir, "trade", "risk", "daily_limits.json")
 	if _, err := os.Stat(dailyLimitsPath); os.IsNotExist(err) {
 		dailyLimitsDefault := `{
   "date": "",
@@ -345,7 +419,7 @@ func runInit(root string) error {
 	}
 
 	// Phase 1: L4 Risk status
-	statusPath := filepath.Join(root, "trade", "risk", "status.json")
+	statusPath := filepath.Join(dir, "trade", "risk", "status.json")
 	if _, err := os.Stat(statusPath); os.IsNotExist(err) {
 		statusDefault := `{
   "updated_at": "",
@@ -364,8 +438,6 @@ func runInit(root string) error {
 		}
 	}
 
-	log.Printf("✓ Successfully initialized FS at %s", root)
-	log.Printf("✓ Phase 1: Five-layer harness directories created")
 	return nil
 }
 
@@ -378,6 +450,8 @@ func controllerCmd() *cobra.Command {
 		mock          bool
 		compactAfter  int
 		autoRebalance bool
+		retryWindow   time.Duration
+		lint          bool
 	)
 
 	cmd := &cobra.Command{
@@ -401,7 +475,7 @@ The controller monitors the file system and automatically:
   # Custom polling interval
   longbridge-fs controller --root ./fs --interval 5s`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runController(root, interval, credFile, mock, compactAfter, autoRebalance)
+			return runController(root, interval, credFile, mock, compactAfter, autoRebalance, retryWindow, lint)
 		},
 	}
 
@@ -411,11 +485,13 @@ The controller monitors the file system and automatically:
 	cmd.Flags().BoolVar(&mock, "mock", false, "Use mock execution without API")
 	cmd.Flags().IntVar(&compactAfter, "compact-after", 10, "Compact after N executed orders, 0=disable")
 	cmd.Flags().BoolVar(&autoRebalance, "auto-rebalance", false, "Automatically create rebalance orders when portfolio drift is detected")
+	cmd.Flags().DurationVar(&retryWindow, "retry-window", broker.DefaultRetryWindow, "Keep retrying orders that failed with transient broker errors for this long, 0=disable")
+	cmd.Flags().BoolVar(&lint, "lint", false, "Lint the ledger each cycle it changed and write trade/lint.json")
 
 	return cmd
 }
 
-func runController(root string, interval time.Duration, credFile string, mock bool, compactAfter int, autoRebalance bool) error {
+func runController(root string, interval time.Duration, credFile string, mock bool, compactAfter int, autoRebalance bool, retryWindow time.Duration, lint bool) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -428,42 +504,41 @@ func runController(root string, interval time.Duration, credFile string, mock bo
 		cancel()
 	}()
 
-	var tc *trade.TradeContext
 	var qc *quote.QuoteContext
 	var subManager *market.SubscriptionManager
-	useMock := mock
 
-	if !useMock {
-		cfg, err := credential.Load(credFile)
+	// The FS root is the default account; quotes use its credential
+	def, cfg := newAccountRunner(ctx, "", root, root, credFile, mock, retryWindow)
+	if cfg != nil {
+		qctx, err := quote.NewFromCfg(cfg)
 		if err != nil {
-			log.Printf("⚠ Credential load failed: %v (falling back to mock mode)", err)
-			useMock = true
+			log.Printf("⚠ Quote context init failed: %v (quote disabled)", err)
 		} else {
-			// Initialize trade context
-			tctx, err := trade.NewFromCfg(cfg)
-			if err != nil {
-				log.Printf("⚠ Trade context init failed: %v (falling back to mock mode)", err)
-				useMock = true
-			} else {
-				tc = tctx
-			}
-
-			// Initialize quote context
-			qctx, err := quote.NewFromCfg(cfg)
-			if err != nil {
-				log.Printf("⚠ Quote context init failed: %v (quote disabled)", err)
-			} else {
-				qc = qctx
-			}
-
-			if tc != nil {
-				log.Println("✓ Connected to Longbridge API")
-			}
+			qc = qctx
 		}
 	}
+	useMock := def.tc == nil
+	if def.broker == nil && useMock {
+		return fmt.Errorf("failed to initialize paper exchange")
+	}
+	runners := []*accountRunner{def}
 
-	if useMock {
-		log.Println("🔧 Running in MOCK mode (no API calls)")
+	// Further accounts under accounts/{name}/, each with its own credential
+	names, err := account.List(root)
+	if err != nil {
+		log.Printf("⚠ Account list failed: %v", err)
+	}
+	for _, name := range names {
+		dir := account.Dir(root, name)
+		r, _ := newAccountRunner(ctx, name, dir, root, filepath.Join(dir, "credential"), mock, retryWindow)
+		if r.broker == nil {
+			log.Printf("⚠ [%s] No broker available, account skipped", name)
+			continue
+		}
+		runners = append(runners, r)
+	}
+	for _, r := range runners {
+		defer r.scheduler.Shutdown()
 	}
 
 	// Initialize subscription manager
@@ -472,6 +547,11 @@ func runController(root string, interval time.Duration, credFile string, mock bo
 		log.Println("✓ WebSocket subscription manager initialized")
 	}
 
+	// Trading calendars gate order submission; load them before the first cycle
+	if qc != nil {
+		market.RefreshCalendars(ctx, qc, root)
+	}
+
 	if verbose {
 		log.Printf("Controller configuration:")
 		log.Printf("  Root: %s", root)
@@ -479,17 +559,13 @@ func runController(root string, interval time.Duration, credFile string, mock bo
 		log.Printf("  Compact after: %d orders", compactAfter)
 		log.Printf("  Mock mode: %v", useMock)
 		log.Printf("  Auto-rebalance: %v", autoRebalance)
+		log.Printf("  Retry window: %s", retryWindow)
+		log.Printf("  Lint: %v", lint)
+		log.Printf("  Accounts: %d", len(runners))
 	}
 
-	log.Printf("🚀 Controller started (interval=%s, compact-after=%d)", interval, compactAfter)
-
-	// Phase 4: Initialize algorithm scheduler
-	bcPath := filepath.Join(root, "trade", "beancount.txt")
-	algoScheduler := broker.NewAlgoScheduler(bcPath, tc, useMock)
-	defer algoScheduler.Shutdown()
-	log.Println("✓ Algorithm scheduler initialized")
+	log.Printf("🚀 Controller started (interval=%s, compact-after=%d, accounts=%d)", interval, compactAfter, len(runners))
 
-	executedCount := 0
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -508,25 +584,9 @@ func runController(root string, interval time.Duration, credFile string, mock bo
 				return nil
 			}
 
-			// Process trade ledger
-			n, err := broker.ProcessLedgerWithScheduler(ctx, tc, root, useMock, algoScheduler)
-			if err != nil {
-				log.Printf("❌ Order processing failed: %v", err)
-			} else if n > 0 && verbose {
-				log.Printf("✓ Processed %d order(s)", n)
-			}
-			executedCount += n
-
-			// Cleanup completed algo tasks periodically
-			algoScheduler.CleanupCompleted()
-
-			// Refresh account state (only with real API)
-			if tc != nil {
-				if err := account.RefreshState(ctx, tc, root); err != nil {
-					log.Printf("❌ Account refresh failed: %v", err)
-				} else if verbose {
-					log.Printf("✓ Account state refreshed")
-				}
+			// Orders and account state of every account
+			for _, r := range runners {
+				r.processOrders(ctx, lint)
 			}
 
 			// Process WebSocket subscription requests (subscribe/unsubscribe)
@@ -539,6 +599,8 @@ func runController(root string, interval time.Duration, credFile string, mock bo
 			// Refresh quotes via track files (one-shot poll-based)
 			if qc != nil {
 				market.RefreshQuotes(ctx, qc, root)
+				// Trading calendars in quote/market/ (once a day)
+				market.RefreshCalendars(ctx, qc, root)
 			}
 
 			// Phase 3: Refresh research feeds (news/topics from Content API)
@@ -579,64 +641,209 @@ func runController(root string, interval time.Duration, credFile string, mock bo
 				log.Printf("✓ Signals computed")
 			}
 
-			// Generate PnL report (positions + current prices — file-only, works in mock)
-			if err := account.GeneratePnL(root); err != nil {
-				log.Printf("❌ PnL generation failed: %v", err)
-			} else if verbose {
-				log.Printf("✓ PnL report generated")
-			}
-
-			// Generate portfolio summary (all hold quotes + positions)
+			// Generate portfolio summary (all hold quotes + default account positions)
 			if err := account.GeneratePortfolio(root); err != nil {
 				log.Printf("❌ Portfolio generation failed: %v", err)
 			} else if verbose {
 				log.Printf("✓ Portfolio summary generated")
 			}
 
-			// Phase 2: Portfolio construction - sync current portfolio state
-			if err := portfolio.SyncCurrent(root); err != nil {
-				log.Printf("❌ Portfolio sync failed: %v", err)
-			} else if verbose {
-				log.Printf("✓ Portfolio current state synced")
+			// PnL, portfolio construction, risk rules and compaction per account
+			for _, r := range runners {
+				r.processPortfolio(autoRebalance, compactAfter)
 			}
+		}
+	}
+}
 
-			// Phase 2: Compute portfolio diff (target vs current)
-			if err := portfolio.ComputeDiff(root); err != nil {
-				log.Printf("❌ Portfolio diff computation failed: %v", err)
-			} else if verbose {
-				log.Printf("✓ Portfolio diff computed")
-			}
+// accountRunner is one account driven by the controller: its root (the FS
+// root, or accounts/{name}/), trade connection, broker, algo scheduler and
+// the retry/hold state its ledger processing carries between cycles.
+// quoteRoot is the FS root, whose quote/ tree every account shares.
+type accountRunner struct {
+	name      string // empty for the default account
+	root      string
+	quoteRoot string
+	tc        *trade.TradeContext
+	broker    broker.Broker
+	scheduler *broker.AlgoScheduler
+	state     *broker.LedgerState
+	executed  int         // executed orders since the last compaction
+	linted    os.FileInfo // ledger as of the last lint report
+}
 
-			// Phase 2: Auto-rebalance mode: create pending.json from diff when drift detected
-			if autoRebalance {
-				if err := portfolio.AutoCreatePending(root); err != nil {
-					log.Printf("❌ Auto-rebalance failed: %v", err)
-				} else if verbose {
-					log.Printf("✓ Auto-rebalance check complete")
-				}
+// newAccountRunner connects the account at root with the credential file,
+// using the paper exchange in mock mode. The default account also falls back
+// to it when the credential can't be used; a named account is left without a
+// broker instead, so its real ledger never records simulated fills. It
+// returns the loaded config for reuse (nil if none).
+func newAccountRunner(ctx context.Context, name, root, quoteRoot, credFile string, mock bool, retryWindow time.Duration) (*accountRunner, *config.Config) {
+	r := &accountRunner{name: name, root: root, quoteRoot: quoteRoot, state: broker.NewLedgerState(retryWindow)}
+	var cfg *config.Config
+
+	if !mock {
+		fallback := "falling back to mock mode"
+		if name != "" {
+			fallback = "account not started"
+		}
+		c, err := credential.Load(credFile)
+		if err != nil {
+			log.Printf("⚠ %sCredential load failed: %v (%s)", r.label(), err, fallback)
+		} else {
+			cfg = c
+			tctx, err := trade.NewFromCfg(cfg)
+			if err != nil {
+				log.Printf("⚠ %sTrade context init failed: %v (%s)", r.label(), err, fallback)
+			} else {
+				r.tc = tctx
+				log.Printf("✓ %sConnected to Longbridge API", r.label())
 			}
+		}
+		if r.tc == nil && name != "" {
+			return r, cfg
+		}
+	}
 
-			// Phase 2: Process pending rebalance orders
-			if err := portfolio.ProcessRebalance(root); err != nil {
-				log.Printf("❌ Rebalance processing failed: %v", err)
-			} else if verbose {
-				log.Printf("✓ Rebalance processed")
-			}
+	if r.tc == nil {
+		log.Printf("🔧 %sRunning in MOCK mode (no API calls)", r.label())
+		pb, err := broker.NewPaperBroker(root, quoteRoot)
+		if err != nil {
+			log.Printf("❌ %sPaper exchange init failed: %v", r.label(), err)
+		} else {
+			r.broker = pb
+			log.Printf("✓ %sPaper exchange initialized (trade/paper.json)", r.label())
+		}
+	} else {
+		lb := broker.NewLongbridgeBroker(r.tc)
+		if err := lb.SubscribeOrderEvents(ctx); err != nil {
+			log.Printf("⚠ %sOrder push subscription failed: %v (falling back to polling)", r.label(), err)
+		} else {
+			log.Printf("✓ %sSubscribed to order push events", r.label())
+		}
+		r.broker = lb
+	}
 
-			// Risk control: stop-loss / take-profit
-			if err := risk.CheckRiskRules(root); err != nil {
-				log.Printf("❌ Risk check failed: %v", err)
-			}
+	// Phase 4: Initialize algorithm scheduler
+	r.scheduler = broker.NewAlgoScheduler(filepath.Join(root, "trade", "beancount.txt"), quoteRoot, r.broker)
+	if resumed, abandoned, err := r.scheduler.Restore(); err != nil {
+		log.Printf("⚠ %sAlgo task restore failed: %v", r.label(), err)
+	} else if resumed+abandoned > 0 {
+		log.Printf("✓ %sAlgo tasks restored: %d resumed, %d abandoned", r.label(), resumed, abandoned)
+	}
+	log.Printf("✓ %sAlgorithm scheduler initialized", r.label())
 
-			// Compaction
-			if compactAfter > 0 && executedCount >= compactAfter {
-				if err := ledger.CompactBlocks(root, executedCount); err != nil {
-					log.Printf("❌ Compaction failed: %v", err)
-				} else {
-					log.Printf("✓ Compacted %d executed orders into blocks", executedCount)
-					executedCount = 0
-				}
-			}
+	return r, cfg
+}
+
+// label prefixes log lines of named accounts.
+func (r *accountRunner) label() string {
+	if r.name == "" {
+		return ""
+	}
+	return "[" + r.name + "] "
+}
+
+// processOrders runs the account's ledger and refreshes its state.
+func (r *accountRunner) processOrders(ctx context.Context, lint bool) {
+	if lint {
+		r.lintLedger()
+	}
+
+	// Process trade ledger
+	n, err := broker.ProcessLedgerWithScheduler(ctx, r.broker, r.root, r.quoteRoot, r.scheduler, r.state)
+	if err != nil {
+		log.Printf("❌ %sOrder processing failed: %v", r.label(), err)
+	} else if n > 0 && verbose {
+		log.Printf("✓ %sProcessed %d order(s)", r.label(), n)
+	}
+	r.executed += n
+
+	// Cleanup completed algo tasks periodically
+	r.scheduler.CleanupCompleted()
+
+	// Refresh account state (only with real API)
+	if r.tc != nil {
+		if err := account.RefreshState(ctx, r.tc, r.root); err != nil {
+			log.Printf("❌ %sAccount refresh failed: %v", r.label(), err)
+		} else if verbose {
+			log.Printf("✓ %sAccount state refreshed", r.label())
+		}
+	}
+}
+
+// lintLedger writes trade/lint.json if the ledger changed since the last
+// report, so agents see problems in what they appended.
+func (r *accountRunner) lintLedger() {
+	info, err := os.Stat(filepath.Join(r.root, "trade", "beancount.txt"))
+	if err != nil {
+		return
+	}
+	if r.linted != nil && os.SameFile(info, r.linted) && info.Size() == r.linted.Size() && info.ModTime().Equal(r.linted.ModTime()) {
+		return
+	}
+	report, err := ledger.WriteLintReport(r.root)
+	if err != nil {
+		log.Printf("❌ %sLedger lint failed: %v", r.label(), err)
+		return
+	}
+	r.linted = info
+	if report.Errors+report.Warnings > 0 {
+		log.Printf("⚠ %sLedger lint: %d error(s), %d warning(s), see trade/%s", r.label(), report.Errors, report.Warnings, ledger.LintFile)
+	}
+}
+
+// processPortfolio runs the steps that need fresh quotes: PnL, portfolio
+// construction, risk rules, then compaction of the account's ledger.
+func (r *accountRunner) processPortfolio(autoRebalance bool, compactAfter int) {
+	// Generate PnL report (positions + current prices — file-only, works in mock)
+	if err := account.GeneratePnL(r.root, r.quoteRoot); err != nil {
+		log.Printf("❌ %sPnL generation failed: %v", r.label(), err)
+	} else if verbose {
+		log.Printf("✓ %sPnL report generated", r.label())
+	}
+
+	// Phase 2: Portfolio construction - sync current portfolio state
+	if err := portfolio.SyncCurrent(r.root, r.quoteRoot); err != nil {
+		log.Printf("❌ %sPortfolio sync failed: %v", r.label(), err)
+	} else if verbose {
+		log.Printf("✓ %sPortfolio current state synced", r.label())
+	}
+
+	// Phase 2: Compute portfolio diff (target vs current)
+	if err := portfolio.ComputeDiff(r.root, r.quoteRoot); err != nil {
+		log.Printf("❌ %sPortfolio diff computation failed: %v", r.label(), err)
+	} else if verbose {
+		log.Printf("✓ %sPortfolio diff computed", r.label())
+	}
+
+	// Phase 2: Auto-rebalance mode: create pending.json from diff when drift detected
+	if autoRebalance {
+		if err := portfolio.AutoCreatePending(r.root, r.quoteRoot); err != nil {
+			log.Printf("❌ %sAuto-rebalance failed: %v", r.label(), err)
+		} else if verbose {
+			log.Printf("✓ %sAuto-rebalance check complete", r.label())
+		}
+	}
+
+	// Phase 2: Process pending rebalance orders
+	if err := portfolio.ProcessRebalance(r.root); err != nil {
+		log.Printf("❌ %sRebalance processing failed: %v", r.label(), err)
+	} else if verbose {
+		log.Printf("✓ %sRebalance processed", r.label())
+	}
+
+	// Risk control: stop-loss / take-profit
+	if err := risk.CheckRiskRules(r.root, r.quoteRoot); err != nil {
+		log.Printf("❌ %sRisk check failed: %v", r.label(), err)
+	}
+
+	// Compaction
+	if compactAfter > 0 && r.executed >= compactAfter {
+		if err := ledger.CompactBlocks(r.root, r.executed); err != nil {
+			log.Printf("❌ %sCompaction failed: %v", r.label(), err)
+		} else {
+			log.Printf("✓ %sCompacted %d executed orders into blocks", r.label(), r.executed)
+			r.executed = 0
 		}
 	}
 }
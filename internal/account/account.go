@@ -75,8 +75,8 @@ func RefreshState(ctx context.Context, tc *trade.TradeContext, root string) erro
 
 // GeneratePnL reads account/state.json positions, looks up current prices
 // from quote/hold/{SYMBOL}/overview.json, computes unrealized P&L per position,
-// and writes account/pnl.json.
-func GeneratePnL(root string) error {
+// and writes account/pnl.json. Quotes are read under quoteRoot, the FS root.
+func GeneratePnL(root, quoteRoot string) error {
 	// Read state.json
 	stateData, err := os.ReadFile(filepath.Join(root, "account", "state.json"))
 	if err != nil {
@@ -98,7 +98,7 @@ func GeneratePnL(root string) error {
 		}
 
 		// Look up current price from overview.json
-		holdDir := filepath.Join(root, "quote", "hold", pos.Symbol)
+		holdDir := market.HoldDir(quoteRoot, pos.Symbol)
 		ov := market.ReadOverview(holdDir)
 		lastPrice := 0.0
 		if ov != nil {
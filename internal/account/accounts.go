@@ -0,0 +1,35 @@
+package account
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Dir returns the root of a named account, accounts/{name}/ under the FS
+// root. An account root has the FS root's account/, trade/ and portfolio/
+// layout and its own credential file; quotes are shared: the controller
+// passes the FS root to everything that reads quote/.
+func Dir(root, name string) string {
+	return filepath.Join(root, "accounts", name)
+}
+
+// List returns the names of the accounts under accounts/, sorted.
+func List(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "accounts"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -2,53 +2,112 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/market"
 	"longbridge-fs/internal/model"
+)
+
+// Algo task states, persisted in /trade/algo/{intent_id}.json and journaled
+// as ALGO entries in the ledger.
+const (
+	AlgoRunning   = "RUNNING"
+	AlgoPaused    = "PAUSED"
+	AlgoResumed   = "RESUMED" // journal-only: restarted or resumed after PAUSE
+	AlgoCompleted = "COMPLETED"
+	AlgoCancelled = "CANCELLED"
+	AlgoAbandoned = "ABANDONED"
+)
 
-	"github.com/longbridge/openapi-go/trade"
+// icebergPollInterval is how often the working ICEBERG slice is checked for
+// fills; icebergRepegInterval limits how often it is re-priced.
+const (
+	icebergPollInterval  = time.Second
+	icebergRepegInterval = 5 * time.Second
 )
 
-// AlgoTask represents an active algorithmic order execution task
+// controlPollInterval is how often a waiting task checks its control file.
+const controlPollInterval = time.Second
+
+// maxAlgoErrors caps the slice errors kept on a task.
+const maxAlgoErrors = 10
+
+// AlgoTask represents an active algorithmic order execution task. Everything
+// needed to resume it after a restart is persisted as JSON.
 type AlgoTask struct {
-	IntentID     string
-	Order        model.ParsedOrder
-	TotalQty     int64
-	SliceQty     int64
-	TotalSlices  int
-	CurrentSlice int
-	Interval     time.Duration
-	CreatedAt    time.Time
-	LastSliceAt  time.Time
-	Done         bool
-	Cancel       context.CancelFunc
+	IntentID     string             `json:"intent_id"`
+	Order        model.ParsedOrder  `json:"order"`
+	TotalQty     int64              `json:"total_qty"`
+	SliceQty     int64              `json:"slice_qty"`
+	TotalSlices  int                `json:"total_slices"`
+	CurrentSlice int                `json:"slices_done"`
+	ExecutedQty  int64              `json:"executed_qty"`
+	RemainingQty int64              `json:"remaining_qty"`
+	Interval     time.Duration      `json:"interval"`
+	CreatedAt    time.Time          `json:"created_at"`
+	LastSliceAt  time.Time          `json:"last_slice_at,omitempty"`
+	NextDueAt    time.Time          `json:"next_due_at"`
+	Status       string             `json:"status"`
+	OrderIDs     []string           `json:"order_ids,omitempty"`
+	FilledQty    int64              `json:"filled_qty"`
+	AvgFillPrice float64            `json:"avg_fill_price,omitempty"`
+	Errors       []string           `json:"errors,omitempty"`
+	Working      *AlgoSlice         `json:"working,omitempty"`     // ICEBERG: slice awaiting fills
+	StartAt      time.Time          `json:"start_at,omitempty"`    // VWAP/POV: algo_start
+	EndAt        time.Time          `json:"end_at,omitempty"`      // VWAP/POV: algo_end
+	Schedule     []int64            `json:"schedule,omitempty"`    // VWAP, TWAP in lots: qty per slice
+	VolumeBase   int64              `json:"volume_base,omitempty"` // POV: market volume at start
+	LotSize      int64              `json:"lot_size,omitempty"`    // slices are whole board lots
+	Done         bool               `json:"-"`
+	Cancel       context.CancelFunc `json:"-"`
 	mu           sync.Mutex
 }
 
+// AlgoSlice is an ICEBERG slice working at the venue. Status and FilledQty
+// follow the ledger entries journaled for OrderID.
+type AlgoSlice struct {
+	Slice     int       `json:"slice"`
+	OrderID   string    `json:"order_id"`
+	Qty       int64     `json:"qty"`
+	Price     string    `json:"price,omitempty"`
+	Status    string    `json:"status"`
+	FilledQty int64     `json:"filled_qty"`
+	PeggedAt  time.Time `json:"pegged_at,omitempty"`
+}
+
 // AlgoScheduler manages active algorithmic order execution tasks
 type AlgoScheduler struct {
 	tasks      map[string]*AlgoTask
 	mu         sync.RWMutex
 	bcPath     string
-	tc         *trade.TradeContext
-	useMock    bool
+	quoteRoot  string
+	algoDir    string
+	broker     Broker
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 }
 
-// NewAlgoScheduler creates a new algorithm scheduler
-func NewAlgoScheduler(bcPath string, tc *trade.TradeContext, useMock bool) *AlgoScheduler {
+// NewAlgoScheduler creates a new algorithm scheduler that submits slices
+// through b. Task state is kept under /trade/algo/ next to the ledger;
+// quotes and calendars are read under quoteRoot, the FS root.
+func NewAlgoScheduler(bcPath, quoteRoot string, b Broker) *AlgoScheduler {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &AlgoScheduler{
 		tasks:      make(map[string]*AlgoTask),
 		bcPath:     bcPath,
-		tc:         tc,
-		useMock:    useMock,
+		quoteRoot:  quoteRoot,
+		algoDir:    filepath.Join(filepath.Dir(bcPath), "algo"),
+		broker:     b,
 		ctx:        ctx,
 		cancelFunc: cancel,
 	}
@@ -70,20 +129,39 @@ func (s *AlgoScheduler) CreateTask(o model.ParsedOrder) error {
 		return fmt.Errorf("invalid qty %q: %w", o.Qty, err)
 	}
 
-	// Validate algo parameters
-	if o.AlgoSlices <= 0 {
-		return fmt.Errorf("algo_slices must be > 0, got %d", o.AlgoSlices)
+	// Validate algo parameters. POV sizes its slices from live volume;
+	// algo_slices, if set, only caps each slice at qty/algo_slices.
+	lot := lotSize(market.ReadStatic(s.holdDir(o)))
+	var sliceQty int64
+	if o.Algo != "POV" || o.AlgoSlices != 0 {
+		if o.AlgoSlices <= 0 {
+			return fmt.Errorf("algo_slices must be > 0, got %d", o.AlgoSlices)
+		}
+		sliceQty = totalQty / int64(o.AlgoSlices) / lot * lot
+		if sliceQty <= 0 {
+			return fmt.Errorf("slice qty too small: total=%d slices=%d lot=%d", totalQty, o.AlgoSlices, lot)
+		}
 	}
 
-	// Calculate slice quantity
-	sliceQty := totalQty / int64(o.AlgoSlices)
-	if sliceQty <= 0 {
-		return fmt.Errorf("slice qty too small: total=%d slices=%d", totalQty, o.AlgoSlices)
+	now := time.Now()
+	task := &AlgoTask{
+		IntentID:     o.IntentID,
+		Order:        o,
+		TotalQty:     totalQty,
+		SliceQty:     sliceQty,
+		TotalSlices:  o.AlgoSlices,
+		CurrentSlice: 0,
+		RemainingQty: totalQty,
+		LotSize:      lot,
+		CreatedAt:    now,
+		NextDueAt:    now,
+		Status:       AlgoRunning,
 	}
 
 	// Parse duration for TWAP
 	var interval time.Duration
-	if o.Algo == "TWAP" {
+	switch o.Algo {
+	case "TWAP":
 		if o.AlgoDuration == "" {
 			return fmt.Errorf("TWAP requires algo_duration")
 		}
@@ -93,40 +171,208 @@ func (s *AlgoScheduler) CreateTask(o model.ParsedOrder) error {
 		}
 		// Calculate interval between slices
 		interval = interval / time.Duration(o.AlgoSlices)
+		if lot > 1 {
+			task.Schedule = evenLots(totalQty, o.AlgoSlices, lot)
+		}
+	case "ICEBERG":
+		interval = icebergPollInterval
+	case "VWAP":
+		if task.StartAt, task.EndAt, err = algoWindow(o, now, true); err != nil {
+			return err
+		}
+		interval = task.EndAt.Sub(task.StartAt) / time.Duration(o.AlgoSlices)
+		task.Schedule = vwapSchedule(volumeProfile(s.holdDir(o)), task.StartAt, interval, o.AlgoSlices, totalQty/lot)
+		for i := range task.Schedule {
+			task.Schedule[i] *= lot
+		}
+		task.Schedule[len(task.Schedule)-1] += totalQty % lot
+		task.NextDueAt = task.StartAt
+	case "POV":
+		if o.AlgoPovRate <= 0 {
+			return fmt.Errorf("POV requires algo_pov_rate")
+		}
+		if task.StartAt, task.EndAt, err = algoWindow(o, now, false); err != nil {
+			return err
+		}
+		interval = povInterval
+		task.TotalSlices = 0 // open-ended
+		task.NextDueAt = task.StartAt
+	default:
+		return fmt.Errorf("unsupported algo type: %s", o.Algo)
+	}
+	task.Interval = interval
+	if (o.AlgoRepeg || o.AlgoVariance > 0) && o.Algo != "ICEBERG" {
+		return fmt.Errorf("algo_repeg and algo_variance are only supported for ICEBERG")
+	}
+	if o.AlgoRepeg && !isLimitType(o.OrderType) {
+		return fmt.Errorf("algo_repeg requires a limit order, got type %s", o.OrderType)
 	}
 
-	// Create task context
-	taskCtx, taskCancel := context.WithCancel(s.ctx)
+	if err := s.save(task); err != nil {
+		return fmt.Errorf("persist algo task: %w", err)
+	}
+	AppendAlgoEvent(s.bcPath, task, AlgoRunning, "")
+	s.start(task)
 
-	task := &AlgoTask{
-		IntentID:     o.IntentID,
-		Order:        o,
-		TotalQty:     totalQty,
-		SliceQty:     sliceQty,
-		TotalSlices:  o.AlgoSlices,
-		CurrentSlice: 0,
-		Interval:     interval,
-		CreatedAt:    time.Now(),
-		Done:         false,
-		Cancel:       taskCancel,
+	log.Printf("Created %s task for intent=%s: %d slices of %d shares", o.Algo, o.IntentID, task.TotalSlices, sliceQty)
+	return nil
+}
+
+// Restore reloads tasks persisted under /trade/algo/ after a restart. Tasks
+// that can still run are resumed from their next slice, counting slices the
+// ledger shows were sent after the file was saved; DAY orders whose
+// trading day has passed are marked ABANDONED in the ledger instead.
+func (s *AlgoScheduler) Restore() (resumed, abandoned int, err error) {
+	files, err := filepath.Glob(filepath.Join(s.algoDir, "*.json"))
+	if err != nil {
+		return 0, 0, err
 	}
 
-	s.tasks[o.IntentID] = task
+	// Slices journaled after the task was last saved must not be sent again
+	entries, err := ledger.ParseEntries(s.bcPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
 
-	// Start execution based on algo type
-	switch o.Algo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	today := time.Now().Format("2006-01-02")
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("WARNING: read algo task %s: %v", path, err)
+			continue
+		}
+		task := &AlgoTask{}
+		if err := json.Unmarshal(data, task); err != nil {
+			log.Printf("WARNING: parse algo task %s: %v", path, err)
+			continue
+		}
+		if task.Status != AlgoRunning && task.Status != AlgoPaused {
+			continue
+		}
+		if _, exists := s.tasks[task.IntentID]; exists {
+			continue
+		}
+
+		if n := s.reconcileSlices(task, entries); n > 0 {
+			log.Printf("Algo task %s: %d slice(s) found in the ledger but not in the task file", task.IntentID, n)
+			if err := s.save(task); err != nil {
+				log.Printf("WARNING: persist algo task %s: %v", task.IntentID, err)
+			}
+		}
+
+		if task.Order.TIF != "GTC" && task.Order.TIF != "GTD" && task.CreatedAt.Local().Format("2006-01-02") != today {
+			s.finish(task, AlgoAbandoned, "DAY order's trading day ended while the controller was down")
+			abandoned++
+			continue
+		}
+
+		// A paused task comes back paused and waits for RESUME
+		if task.Status == AlgoRunning {
+			AppendAlgoEvent(s.bcPath, task, AlgoResumed, "")
+		}
+		s.start(task)
+		resumed++
+		log.Printf("Resumed %s task for intent=%s at slice %d/%d (%s)", task.Order.Algo, task.IntentID, task.CurrentSlice+1, task.TotalSlices, task.Status)
+	}
+	return resumed, abandoned, nil
+}
+
+// reconcileSlices brings task up to date with the slices journaled for it.
+// A slice is submitted and journaled before the task file records it, so a
+// crash in between leaves the file one slice behind the ledger. Those
+// slices are counted as sent (an ICEBERG's last one becomes its working
+// slice) and the number recovered is returned.
+func (s *AlgoScheduler) reconcileSlices(task *AlgoTask, entries []model.Entry) int {
+	type journaled struct {
+		slice           int
+		orderID, status string
+		qty, filled     int64
+	}
+	var found []*journaled
+	byOrder := make(map[string]*journaled)
+	for _, e := range entries {
+		if (e.Type != "SUBMITTED" && e.Type != "EXECUTION") || e.Meta["intent_id"] != task.IntentID {
+			continue
+		}
+		id := e.Meta["order_id"]
+		j := byOrder[id]
+		if j == nil {
+			// The first entry of a slice is the one recordSubmission wrote
+			label, _, _ := strings.Cut(e.Meta["slice"], "/")
+			n, err := strconv.Atoi(label)
+			if err != nil || e.Meta["algo"] == "" || n <= task.CurrentSlice {
+				continue
+			}
+			j = &journaled{slice: n, orderID: id}
+			j.qty, _ = strconv.ParseInt(e.Meta["qty"], 10, 64)
+			if e.Meta["status"] == StatusPartialFill && s.broker != nil {
+				// qty is what filled so far; the slice size is the venue's
+				if info, err := s.broker.QueryOrder(context.Background(), id); err == nil {
+					j.qty, _ = strconv.ParseInt(info.Qty, 10, 64)
+				}
+			}
+			byOrder[id] = j
+			found = append(found, j)
+		}
+		if st := e.Meta["status"]; st != StatusReplaced {
+			j.status = st
+		}
+		if e.Type == "EXECUTION" {
+			filled := e.Meta["filled_qty"]
+			if filled == "" {
+				filled = e.Meta["qty"]
+			}
+			j.filled, _ = strconv.ParseInt(filled, 10, 64)
+		}
+	}
+	if len(found) == 0 {
+		return 0
+	}
+	sort.Slice(found, func(a, b int) bool { return found[a].slice < found[b].slice })
+
+	now := time.Now()
+	task.mu.Lock()
+	defer task.mu.Unlock()
+	for i, j := range found {
+		task.CurrentSlice = j.slice
+		task.OrderIDs = append(task.OrderIDs, j.orderID)
+		switch {
+		case task.Order.Algo != "ICEBERG":
+			task.ExecutedQty += j.qty
+		case i == len(found)-1:
+			task.Working = &AlgoSlice{Slice: j.slice, OrderID: j.orderID, Qty: j.qty, Status: j.status, FilledQty: j.filled, PeggedAt: now}
+		default:
+			task.ExecutedQty += j.filled
+		}
+	}
+	task.RemainingQty = task.TotalQty - task.ExecutedQty
+	task.LastSliceAt = now
+	task.NextDueAt = now.Add(task.Interval)
+	if !task.StartAt.IsZero() && task.TotalSlices > 0 {
+		task.NextDueAt = task.StartAt.Add(time.Duration(task.CurrentSlice) * task.Interval)
+	}
+	return len(found)
+}
+
+// start registers task and launches its execution goroutine. Callers hold s.mu.
+func (s *AlgoScheduler) start(task *AlgoTask) {
+	taskCtx, taskCancel := context.WithCancel(s.ctx)
+	task.Cancel = taskCancel
+	s.tasks[task.IntentID] = task
+
+	switch task.Order.Algo {
 	case "TWAP":
 		go s.executeTWAP(taskCtx, task)
 	case "ICEBERG":
 		go s.executeICEBERG(taskCtx, task)
-	default:
-		taskCancel()
-		delete(s.tasks, o.IntentID)
-		return fmt.Errorf("unsupported algo type: %s", o.Algo)
+	case "VWAP":
+		go s.executeVWAP(taskCtx, task)
+	case "POV":
+		go s.executePOV(taskCtx, task)
 	}
-
-	log.Printf("Created %s task for intent=%s: %d slices of %d shares", o.Algo, o.IntentID, o.AlgoSlices, sliceQty)
-	return nil
 }
 
 // GetActiveCount returns the number of active algo tasks
@@ -135,9 +381,11 @@ func (s *AlgoScheduler) GetActiveCount() int {
 	defer s.mu.RUnlock()
 	count := 0
 	for _, task := range s.tasks {
+		task.mu.Lock()
 		if !task.Done {
 			count++
 		}
+		task.mu.Unlock()
 	}
 	return count
 }
@@ -148,13 +396,17 @@ func (s *AlgoScheduler) CleanupCompleted() {
 	defer s.mu.Unlock()
 
 	for intentID, task := range s.tasks {
-		if task.Done {
+		task.mu.Lock()
+		done := task.Done
+		task.mu.Unlock()
+		if done {
 			delete(s.tasks, intentID)
 		}
 	}
 }
 
-// Shutdown gracefully stops all active tasks
+// Shutdown gracefully stops all active tasks. Their persisted state is left
+// RUNNING so Restore picks them up on the next start.
 func (s *AlgoScheduler) Shutdown() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -166,41 +418,478 @@ func (s *AlgoScheduler) Shutdown() {
 	time.Sleep(100 * time.Millisecond)
 }
 
-// executeSlice submits a single slice of an algorithmic order
-func (s *AlgoScheduler) executeSlice(task *AlgoTask, sliceNum int, qty int64) error {
+// runSlices submits the remaining slices of task, one every task.Interval,
+// persisting progress after each. It returns false if the task was stopped
+// (ctx cancelled or CANCEL control) before the last slice.
+func (s *AlgoScheduler) runSlices(ctx context.Context, task *AlgoTask) bool {
+	for {
+		task.mu.Lock()
+		slice := task.CurrentSlice + 1
+		task.mu.Unlock()
+
+		if slice > task.TotalSlices {
+			return true
+		}
+		if !s.await(ctx, task) {
+			log.Printf("%s execution stopped: intent=%s before slice %d/%d", task.Order.Algo, task.IntentID, slice, task.TotalSlices)
+			return false
+		}
+
+		// A VWAP bucket with no historical volume gets no slice
+		qty := task.sliceQty(slice)
+		var info *OrderInfo
+		var err error
+		if qty > 0 {
+			info, err = s.executeSlice(ctx, task, slice, qty, "")
+		}
+		if err != nil {
+			log.Printf("%s slice %d/%d failed: intent=%s err=%v", task.Order.Algo, slice, task.TotalSlices, task.IntentID, err)
+			// Continue with remaining slices even if one fails
+		}
+
+		now := time.Now()
+		task.mu.Lock()
+		task.CurrentSlice = slice
+		if err != nil {
+			task.addError(fmt.Sprintf("slice %d/%d: %v", slice, task.TotalSlices, err))
+		} else if info != nil {
+			task.ExecutedQty += qty
+			task.OrderIDs = append(task.OrderIDs, info.OrderID)
+		}
+		task.RemainingQty = task.TotalQty - task.ExecutedQty
+		task.LastSliceAt = now
+		task.NextDueAt = now.Add(task.Interval)
+		if !task.StartAt.IsZero() {
+			// Windowed algos keep slices on their bucket boundaries
+			task.NextDueAt = task.StartAt.Add(time.Duration(slice) * task.Interval)
+		}
+		task.mu.Unlock()
+
+		if err := s.save(task); err != nil {
+			log.Printf("WARNING: persist algo task %s: %v", task.IntentID, err)
+		}
+	}
+}
+
+// await blocks until the next slice of task is due, honoring control
+// commands while it waits. A paused task waits until RESUME, and a due slice
+// waits for the market session (see sessionCheck). It returns false if ctx
+// was cancelled or the task was cancelled or abandoned.
+func (s *AlgoScheduler) await(ctx context.Context, task *AlgoTask) bool {
+	for {
+		if !s.applyControl(task) {
+			return false
+		}
+
+		task.mu.Lock()
+		paused := task.Status == AlgoPaused
+		wait := time.Until(task.NextDueAt)
+		task.mu.Unlock()
+
+		if !paused && wait <= 0 {
+			// Due: send only while the market is in session
+			hold, reason, _, _ := sessionCheck(s.quoteRoot, task.Order, time.Now())
+			if reason != "" {
+				s.finish(task, AlgoAbandoned, reason)
+				log.Printf("Algo task abandoned: intent=%s reason=%s", task.IntentID, reason)
+				return false
+			}
+			if !hold {
+				return true
+			}
+			wait = controlPollInterval
+		}
+		if paused || wait > controlPollInterval {
+			wait = controlPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// applyControl reads and consumes /trade/algo/control/{intent_id}, whose
+// content is one of PAUSE, RESUME or CANCEL. It returns false once the task
+// has been cancelled.
+func (s *AlgoScheduler) applyControl(task *AlgoTask) bool {
+	path := filepath.Join(s.algoDir, "control", task.IntentID)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return true
+	}
+	os.Remove(path)
+
+	cmd := strings.ToUpper(strings.TrimSpace(string(data)))
 	task.mu.Lock()
-	order := task.Order
-	intentID := task.IntentID
+	status := task.Status
 	task.mu.Unlock()
 
-	sym := ledger.FullSymbol(order.Symbol, order.Market)
-	sliceLabel := fmt.Sprintf("%d/%d", sliceNum, task.TotalSlices)
+	switch {
+	case cmd == "PAUSE" && status == AlgoRunning:
+		s.setStatus(task, AlgoPaused)
+		AppendAlgoEvent(s.bcPath, task, AlgoPaused, "")
+		log.Printf("Algo task paused: intent=%s", task.IntentID)
+	case cmd == "RESUME" && status == AlgoPaused:
+		s.setStatus(task, AlgoRunning)
+		AppendAlgoEvent(s.bcPath, task, AlgoResumed, "")
+		log.Printf("Algo task resumed: intent=%s", task.IntentID)
+	case cmd == "CANCEL":
+		s.cancelSlices(task)
+		s.finish(task, AlgoCancelled, "cancelled via control file")
+		log.Printf("Algo task cancelled: intent=%s", task.IntentID)
+		return false
+	case cmd == "PAUSE" || cmd == "RESUME":
+		// Already in the requested state
+	default:
+		task.mu.Lock()
+		task.addError(fmt.Sprintf("unknown control command %q (want PAUSE, RESUME or CANCEL)", cmd))
+		task.mu.Unlock()
+		s.writeStatus(task)
+	}
+	return true
+}
 
-	var orderID string
-	var price string
-	var err error
+// setStatus changes the state of a running or paused task and persists it.
+func (s *AlgoScheduler) setStatus(task *AlgoTask, status string) {
+	task.mu.Lock()
+	task.Status = status
+	task.mu.Unlock()
+	if err := s.save(task); err != nil {
+		log.Printf("WARNING: persist algo task %s: %v", task.IntentID, err)
+	}
+}
 
-	if s.useMock {
-		orderID, price = ExecuteOrderMock(order)
-	} else if s.tc != nil {
-		// Create slice order with adjusted quantity
-		sliceOrder := order
-		sliceOrder.Qty = strconv.FormatInt(qty, 10)
-		orderID, err = ExecuteOrder(context.Background(), s.tc, sliceOrder)
-		if err != nil {
-			log.Printf("Algo slice execution failed: intent=%s slice=%s err=%v", intentID, sliceLabel, err)
-			return err
+// cancelSlices cancels slice orders that are still working at the venue.
+func (s *AlgoScheduler) cancelSlices(task *AlgoTask) {
+	if s.broker == nil {
+		return
+	}
+	task.mu.Lock()
+	ids := append([]string(nil), task.OrderIDs...)
+	task.mu.Unlock()
+
+	ctx := context.Background()
+	for _, id := range ids {
+		info, err := s.broker.QueryOrder(ctx, id)
+		if err != nil || (info.Status != StatusSubmitted && info.Status != StatusPartialFill) {
+			continue
+		}
+		if err := s.broker.Cancel(ctx, id); err != nil {
+			log.Printf("WARNING: cancel algo slice %s of %s: %v", id, task.IntentID, err)
 		}
-		price = order.Price
 	}
+}
 
-	// Append execution with slice metadata
-	AppendSliceExecution(s.bcPath, intentID, orderID, sym, order.Side, price, strconv.FormatInt(qty, 10), sliceLabel, order.Algo)
-	log.Printf("Algo slice executed: intent=%s slice=%s order_id=%s", intentID, sliceLabel, orderID)
+// addError records a slice error, keeping the most recent maxAlgoErrors.
+// Callers hold t.mu.
+func (t *AlgoTask) addError(msg string) {
+	t.Errors = append(t.Errors, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), msg))
+	if len(t.Errors) > maxAlgoErrors {
+		t.Errors = t.Errors[len(t.Errors)-maxAlgoErrors:]
+	}
+}
+
+// sliceQty returns the quantity of slice n: from the VWAP schedule if there
+// is one, otherwise SliceQty with the remainder on the last slice.
+func (t *AlgoTask) sliceQty(n int) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.Schedule) >= n {
+		return t.Schedule[n-1]
+	}
+	if n == t.TotalSlices {
+		return t.TotalQty - t.SliceQty*int64(n-1)
+	}
+	return t.SliceQty
+}
+
+// evenLots splits total into n slices of whole lots, the larger slices
+// first; a remainder below one lot goes to the last slice.
+func evenLots(total int64, n int, lot int64) []int64 {
+	lots := total / lot
+	qty := make([]int64, n)
+	for i := range qty {
+		qty[i] = lots / int64(n) * lot
+		if int64(i) < lots%int64(n) {
+			qty[i] += lot
+		}
+	}
+	qty[n-1] += total % lot
+	return qty
+}
+
+// finish records a terminal state: the ledger gets an ALGO entry, the
+// persisted task file is removed and the status file shows the final state.
+func (s *AlgoScheduler) finish(task *AlgoTask, status, reason string) {
+	task.mu.Lock()
+	task.Status = status
+	task.Done = true
+	task.mu.Unlock()
+
+	AppendAlgoEvent(s.bcPath, task, status, reason)
+	if err := os.Remove(s.taskPath(task.IntentID)); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: remove algo task %s: %v", task.IntentID, err)
+	}
+	s.writeStatus(task)
+}
 
+// holdDir returns the quote directory of the order's symbol.
+func (s *AlgoScheduler) holdDir(o model.ParsedOrder) string {
+	return market.HoldDir(s.quoteRoot, ledger.FullSymbol(o.Symbol, o.Market))
+}
+
+// algoWindow resolves algo_start/algo_end of o. Start defaults to now (and
+// is never earlier); end falls back to start+algo_duration and is required
+// only if needEnd.
+func algoWindow(o model.ParsedOrder, now time.Time, needEnd bool) (start, end time.Time, err error) {
+	start = now
+	if o.AlgoStart != "" {
+		if start, err = parseAlgoTime("algo_start", o.AlgoStart, now); err != nil {
+			return
+		}
+		if start.Before(now) {
+			start = now
+		}
+	}
+	switch {
+	case o.AlgoEnd != "":
+		if end, err = parseAlgoTime("algo_end", o.AlgoEnd, now); err != nil {
+			return
+		}
+	case o.AlgoDuration != "":
+		d, perr := time.ParseDuration(o.AlgoDuration)
+		if perr != nil {
+			err = fmt.Errorf("invalid algo_duration %q: %w", o.AlgoDuration, perr)
+			return
+		}
+		end = start.Add(d)
+	case needEnd:
+		err = fmt.Errorf("%s requires algo_end or algo_duration", o.Algo)
+		return
+	}
+	if !end.IsZero() && !end.After(start) {
+		err = fmt.Errorf("algo_end %s is not after the start %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	return
+}
+
+// parseAlgoTime accepts RFC3339 or HH:MM (today, controller local time).
+func parseAlgoTime(field, v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	hm, err := time.Parse("15:04", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be HH:MM or RFC3339, got %q", field, v)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), hm.Hour(), hm.Minute(), 0, 0, now.Location()), nil
+}
+
+func (s *AlgoScheduler) taskPath(intentID string) string {
+	return filepath.Join(s.algoDir, intentID+".json")
+}
+
+// save persists task to /trade/algo/{intent_id}.json, replacing the file
+// atomically so a crash never leaves a truncated task, and refreshes its
+// status file.
+func (s *AlgoScheduler) save(task *AlgoTask) error {
+	task.mu.Lock()
+	data, err := json.MarshalIndent(task, "", "  ")
+	task.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.algoDir, 0755); err != nil {
+		return err
+	}
+	if err := ledger.WriteFileAtomic(s.taskPath(task.IntentID), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	s.writeStatus(task)
 	return nil
 }
 
+// AlgoStatus is the progress report written to
+// /trade/algo/status/{intent_id}.json for monitoring.
+type AlgoStatus struct {
+	IntentID     string   `json:"intent_id"`
+	Algo         string   `json:"algo"`
+	Symbol       string   `json:"symbol"`
+	Side         string   `json:"side"`
+	Status       string   `json:"status"`
+	SlicesDone   int      `json:"slices_done"`
+	TotalSlices  int      `json:"total_slices"`
+	Progress     float64  `json:"progress"`
+	TotalQty     int64    `json:"total_qty"`
+	ExecutedQty  int64    `json:"executed_qty"`
+	FilledQty    int64    `json:"filled_qty"`
+	RemainingQty int64    `json:"remaining_qty"`
+	AvgFillPrice string   `json:"avg_fill_price,omitempty"`
+	NextSliceAt  string   `json:"next_slice_at,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+// writeStatus writes the current progress of task to its status file.
+func (s *AlgoScheduler) writeStatus(task *AlgoTask) {
+	task.mu.Lock()
+	st := AlgoStatus{
+		IntentID:     task.IntentID,
+		Algo:         task.Order.Algo,
+		Symbol:       task.Order.Symbol,
+		Side:         task.Order.Side,
+		Status:       task.Status,
+		SlicesDone:   task.CurrentSlice,
+		TotalSlices:  task.TotalSlices,
+		TotalQty:     task.TotalQty,
+		ExecutedQty:  task.ExecutedQty,
+		FilledQty:    task.FilledQty,
+		RemainingQty: task.TotalQty - task.ExecutedQty,
+		Errors:       task.Errors,
+		UpdatedAt:    time.Now().Format(time.RFC3339),
+	}
+	if task.TotalQty > 0 {
+		st.Progress = roundPrice(float64(task.FilledQty) / float64(task.TotalQty))
+	}
+	if task.FilledQty > 0 {
+		st.AvgFillPrice = formatFloat(roundPrice(task.AvgFillPrice))
+	}
+	if task.Status == AlgoRunning && (task.TotalSlices == 0 || task.CurrentSlice < task.TotalSlices) {
+		st.NextSliceAt = task.NextDueAt.Format(time.RFC3339)
+	}
+	task.mu.Unlock()
+
+	dir := filepath.Join(s.algoDir, "status")
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = ledger.WriteFileAtomic(filepath.Join(dir, st.IntentID+".json"), append(data, '\n'), 0644)
+	}
+	if err != nil {
+		log.Printf("WARNING: write algo status %s: %v", st.IntentID, err)
+	}
+}
+
+// UpdateFills refreshes filled quantity and average fill price of the active
+// tasks from the EXECUTION entries journaled for their slices, so the status
+// files follow fills reported after a slice was submitted. It is also how a
+// working ICEBERG slice learns it has filled or ended.
+func (s *AlgoScheduler) UpdateFills(entries []model.Entry) {
+	s.mu.RLock()
+	tasks := make([]*AlgoTask, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	s.mu.RUnlock()
+	if len(tasks) == 0 {
+		return
+	}
+
+	type fill struct {
+		qty   int64
+		price float64
+	}
+	latest := make(map[string]map[string]fill) // intent -> order_id -> cumulative fill
+	statuses := make(map[string]string)        // order_id -> latest status
+	for _, e := range entries {
+		if (e.Type != "EXECUTION" && e.Type != "SUBMITTED") || e.Meta["order_id"] == "" {
+			continue
+		}
+		status := e.Meta["status"]
+		if status != StatusReplaced {
+			statuses[e.Meta["order_id"]] = status
+		}
+		if e.Type != "EXECUTION" {
+			continue
+		}
+		qty, price := e.Meta["filled_qty"], e.Meta["avg_price"]
+		if qty == "" && (status == "" || status == StatusFilled) {
+			qty, price = e.Meta["qty"], e.Meta["price"]
+		}
+		n, _ := strconv.ParseInt(qty, 10, 64)
+		if n <= 0 {
+			continue
+		}
+		p, _ := strconv.ParseFloat(price, 64)
+		id := e.Meta["intent_id"]
+		if latest[id] == nil {
+			latest[id] = make(map[string]fill)
+		}
+		latest[id][e.Meta["order_id"]] = fill{n, p}
+	}
+
+	for _, task := range tasks {
+		var qty int64
+		var notional float64
+		for _, f := range latest[task.IntentID] {
+			qty += f.qty
+			notional += float64(f.qty) * f.price
+		}
+		task.mu.Lock()
+		changed := qty != task.FilledQty
+		task.FilledQty = qty
+		if qty > 0 {
+			task.AvgFillPrice = notional / float64(qty)
+		}
+		if w := task.Working; w != nil {
+			if status, ok := statuses[w.OrderID]; ok {
+				if status == "" {
+					status = StatusFilled
+				}
+				w.Status = status
+				w.FilledQty = latest[task.IntentID][w.OrderID].qty
+			}
+		}
+		task.mu.Unlock()
+		if changed {
+			s.writeStatus(task)
+		}
+	}
+}
+
+// executeSlice submits a single slice of an algorithmic order, at price if
+// set and the order's own price otherwise.
+func (s *AlgoScheduler) executeSlice(ctx context.Context, task *AlgoTask, sliceNum int, qty int64, price string) (*OrderInfo, error) {
+	task.mu.Lock()
+	order := task.Order
+	intentID := task.IntentID
+	task.mu.Unlock()
+
+	sliceLabel := strconv.Itoa(sliceNum)
+	if task.TotalSlices > 0 {
+		sliceLabel = fmt.Sprintf("%d/%d", sliceNum, task.TotalSlices)
+	}
+
+	if s.broker == nil {
+		return nil, fmt.Errorf("no broker configured")
+	}
+
+	// Create slice order with adjusted quantity
+	sliceOrder := order
+	sliceOrder.Qty = strconv.FormatInt(qty, 10)
+	if price != "" {
+		sliceOrder.Price = price
+	}
+	info, err := s.broker.Submit(ctx, sliceOrder)
+	if err != nil {
+		log.Printf("Algo slice execution failed: intent=%s slice=%s err=%v", intentID, sliceLabel, err)
+		return nil, err
+	}
+
+	// Journal the slice with its algo metadata
+	recordSubmission(s.bcPath, s.broker, sliceOrder, info, map[string]string{
+		"slice": sliceLabel,
+		"algo":  order.Algo,
+	})
+	log.Printf("Algo slice executed: intent=%s slice=%s order_id=%s", intentID, sliceLabel, info.OrderID)
+
+	return info, nil
+}
+
 // AppendSliceExecution appends an EXECUTION entry with slice metadata
 func AppendSliceExecution(bcPath, intentID, orderID, symbol, side, price, qty, slice, algo string) {
 	AppendExecutionWithMeta(bcPath, intentID, orderID, symbol, side, price, qty, map[string]string{
@@ -208,3 +897,31 @@ func AppendSliceExecution(bcPath, intentID, orderID, symbol, side, price, qty, s
 		"algo":  algo,
 	})
 }
+
+// AppendAlgoEvent appends an ALGO entry recording a task lifecycle change.
+// The parent intent counts as processed from its first ALGO entry on and is
+// only compacted after a terminal one (COMPLETED, CANCELLED, ABANDONED).
+func AppendAlgoEvent(bcPath string, task *AlgoTask, status, reason string) {
+	task.mu.Lock()
+	o := task.Order
+	text := fmt.Sprintf("\n%s * \"ALGO\" \"%s %s %s\"\n", time.Now().Format("2006-01-02"), o.Algo, o.Side, o.Symbol)
+	text += fmt.Sprintf("  ; intent_id: %s\n", task.IntentID)
+	text += fmt.Sprintf("  ; algo: %s\n", o.Algo)
+	text += fmt.Sprintf("  ; status: %s\n", status)
+	if task.TotalSlices > 0 {
+		text += fmt.Sprintf("  ; slices_done: %d/%d\n", task.CurrentSlice, task.TotalSlices)
+	} else {
+		text += fmt.Sprintf("  ; slices_done: %d\n", task.CurrentSlice)
+	}
+	text += fmt.Sprintf("  ; executed_qty: %d\n", task.ExecutedQty)
+	text += fmt.Sprintf("  ; remaining_qty: %d\n", task.TotalQty-task.ExecutedQty)
+	task.mu.Unlock()
+	if reason != "" {
+		text += fmt.Sprintf("  ; reason: %s\n", strings.ReplaceAll(reason, "\n", " "))
+	}
+	text += fmt.Sprintf("  ; updated_at: %s\n", time.Now().Format(time.RFC3339))
+	text += "\n"
+	if err := ledger.Append(bcPath, text); err != nil {
+		log.Printf("append algo event failed: %v", err)
+	}
+}
@@ -2,13 +2,25 @@ package broker
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
+	"strconv"
 	"time"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/market"
+	"longbridge-fs/internal/model"
 )
 
+// maxIcebergFailures is how many slices in a row may fail to submit (or be
+// rejected by the venue) before the task gives up.
+const maxIcebergFailures = 3
+
 // executeICEBERG executes an Iceberg algorithm
-// Submits partial orders sequentially, revealing only a portion at a time
-// Each slice is submitted after the previous one, simulating fill-based progression
+// Keeps a single visible slice working at a time and submits the next one
+// only after the previous slice has filled
 func (s *AlgoScheduler) executeICEBERG(ctx context.Context, task *AlgoTask) {
 	defer func() {
 		task.mu.Lock()
@@ -16,55 +28,229 @@ func (s *AlgoScheduler) executeICEBERG(ctx context.Context, task *AlgoTask) {
 		task.mu.Unlock()
 	}()
 
-	log.Printf("Starting ICEBERG execution: intent=%s total_qty=%d slices=%d visible_qty=%d",
-		task.IntentID, task.TotalQty, task.TotalSlices, task.SliceQty)
-
-	// For ICEBERG, we submit slices sequentially without time delay
-	// In a real implementation, we would wait for fills, but for this implementation
-	// we simulate by submitting each slice with a small delay to represent processing time
-	for i := 1; i <= task.TotalSlices; i++ {
-		select {
-		case <-ctx.Done():
-			log.Printf("ICEBERG execution cancelled: intent=%s at slice %d/%d", task.IntentID, i, task.TotalSlices)
-			return
-		default:
+	log.Printf("Starting ICEBERG execution: intent=%s total_qty=%d visible_qty=%d repeg=%t variance=%g",
+		task.IntentID, task.TotalQty, task.SliceQty, task.Order.AlgoRepeg, task.Order.AlgoVariance)
+
+	if !s.runIceberg(ctx, task) {
+		return
+	}
+
+	s.finish(task, AlgoCompleted, "")
+	log.Printf("ICEBERG execution completed: intent=%s slices=%d", task.IntentID, task.CurrentSlice)
+}
+
+// runIceberg drives task one slice at a time. A slice that ends without
+// filling completely (cancelled, expired, rejected) hands its unfilled
+// quantity back to the remainder. Slice states arrive through UpdateFills,
+// i.e. from the order events the ledger processor journals. It returns false
+// if the task was stopped before the total quantity filled.
+func (s *AlgoScheduler) runIceberg(ctx context.Context, task *AlgoTask) bool {
+	failures := 0
+	for {
+		if !s.await(ctx, task) {
+			log.Printf("ICEBERG execution stopped: intent=%s", task.IntentID)
+			return false
 		}
 
-		// Calculate quantity for this slice
-		var sliceQty int64
-		if i == task.TotalSlices {
-			// Last slice gets remainder to handle rounding
+		task.mu.Lock()
+		var w AlgoSlice
+		working := task.Working != nil
+		if working {
+			w = *task.Working
+		}
+		remaining := task.TotalQty - task.ExecutedQty
+		task.mu.Unlock()
+
+		switch {
+		case working && (w.Status == StatusSubmitted || w.Status == StatusPartialFill):
+			s.repegSlice(task, w)
 			task.mu.Lock()
-			executedQty := task.SliceQty * int64(i-1)
-			sliceQty = task.TotalQty - executedQty
+			task.NextDueAt = time.Now().Add(icebergPollInterval)
 			task.mu.Unlock()
-		} else {
-			sliceQty = task.SliceQty
-		}
 
-		// Execute the slice
-		if err := s.executeSlice(task, i, sliceQty); err != nil {
-			log.Printf("ICEBERG slice %d/%d failed: intent=%s err=%v", i, task.TotalSlices, task.IntentID, err)
-			// Continue with remaining slices even if one fails
+		case working:
+			// The slice ended: credit its fills and move on
+			task.mu.Lock()
+			task.ExecutedQty += w.FilledQty
+			task.RemainingQty = task.TotalQty - task.ExecutedQty
+			task.Working = nil
+			task.NextDueAt = time.Now()
+			if w.Status != StatusFilled {
+				task.addError(fmt.Sprintf("slice %d order %s ended %s with %d/%d filled", w.Slice, w.OrderID, w.Status, w.FilledQty, w.Qty))
+			}
+			task.mu.Unlock()
+			if w.Status == StatusRejected {
+				failures++
+			} else {
+				failures = 0
+			}
+			s.persist(task)
+
+		case remaining <= 0:
+			return true
+
+		default:
+			if failures >= maxIcebergFailures {
+				s.finish(task, AlgoCancelled, fmt.Sprintf("%d slices in a row failed", failures))
+				return false
+			}
+			if err := s.submitIcebergSlice(ctx, task, remaining); err != nil {
+				failures++
+				log.Printf("ICEBERG slice failed: intent=%s err=%v", task.IntentID, err)
+			} else {
+				failures = 0
+			}
 		}
+	}
+}
 
-		task.mu.Lock()
-		task.CurrentSlice = i
-		task.LastSliceAt = time.Now()
+// submitIcebergSlice submits the next visible slice out of remaining and
+// makes it the working slice.
+func (s *AlgoScheduler) submitIcebergSlice(ctx context.Context, task *AlgoTask, remaining int64) error {
+	qty := task.visibleQty(remaining)
+	price := ""
+	if task.Order.AlgoRepeg {
+		price = s.pegPrice(task.Order)
+	}
+
+	task.mu.Lock()
+	slice := task.CurrentSlice + 1
+	// An estimate: unfilled remainders handed back add slices
+	n := remaining / task.SliceQty
+	if r := remaining % task.SliceQty; n == 0 || r >= task.SliceQty/2 && r > 0 {
+		n++
+	}
+	task.TotalSlices = task.CurrentSlice + int(n)
+	task.mu.Unlock()
+
+	info, err := s.executeSlice(ctx, task, slice, qty, price)
+	now := time.Now()
+
+	task.mu.Lock()
+	if err != nil {
+		task.addError(fmt.Sprintf("slice %d: %v", slice, err))
+		task.NextDueAt = now.Add(icebergPollInterval)
 		task.mu.Unlock()
+		s.persist(task)
+		return err
+	}
+	if price == "" {
+		price = task.Order.Price
+	}
+	filled, _ := strconv.ParseInt(info.FilledQty, 10, 64)
+	task.CurrentSlice = slice
+	task.OrderIDs = append(task.OrderIDs, info.OrderID)
+	task.Working = &AlgoSlice{
+		Slice:     slice,
+		OrderID:   info.OrderID,
+		Qty:       qty,
+		Price:     price,
+		Status:    info.Status,
+		FilledQty: filled,
+		PeggedAt:  now,
+	}
+	task.LastSliceAt = now
+	task.NextDueAt = now
+	task.mu.Unlock()
+	s.persist(task)
+	return nil
+}
 
-		// Small delay between slices to simulate fill detection and next order submission
-		// In a real implementation, this would wait for order fill confirmation
-		if i < task.TotalSlices {
-			select {
-			case <-ctx.Done():
-				log.Printf("ICEBERG execution cancelled: intent=%s after slice %d/%d", task.IntentID, i, task.TotalSlices)
-				return
-			case <-time.After(2 * time.Second):
-				// Continue to next slice
-			}
+// repegSlice moves the working slice to the current bid (BUY) or ask (SELL)
+// when the quote has moved, at most once per icebergRepegInterval.
+func (s *AlgoScheduler) repegSlice(task *AlgoTask, w AlgoSlice) {
+	o := task.Order
+	if !o.AlgoRepeg || time.Since(w.PeggedAt) < icebergRepegInterval {
+		return
+	}
+	price := s.pegPrice(o)
+	if price == "" || price == w.Price {
+		return
+	}
+
+	qty := strconv.FormatInt(w.Qty, 10)
+	err := s.broker.Replace(context.Background(), ReplaceRequest{OrderID: w.OrderID, Qty: qty, Price: price})
+
+	task.mu.Lock()
+	if task.Working != nil && task.Working.OrderID == w.OrderID {
+		task.Working.PeggedAt = time.Now()
+		if err == nil {
+			task.Working.Price = price
+		}
+	}
+	if err != nil {
+		task.addError(fmt.Sprintf("re-peg slice %d to %s: %v", w.Slice, price, err))
+	}
+	label := fmt.Sprintf("%d/%d", w.Slice, task.TotalSlices)
+	task.mu.Unlock()
+
+	if err != nil {
+		log.Printf("ICEBERG re-peg failed: intent=%s order_id=%s err=%v", task.IntentID, w.OrderID, err)
+	} else {
+		appendExecution(s.bcPath, StatusReplaced, task.IntentID, w.OrderID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, price, qty, map[string]string{
+			"slice": label,
+			"algo":  o.Algo,
+		})
+		log.Printf("ICEBERG slice re-pegged: intent=%s order_id=%s %s -> %s", task.IntentID, w.OrderID, w.Price, price)
+	}
+	s.persist(task)
+}
+
+// pegPrice returns the best bid (BUY) or ask (SELL) from the symbol's
+// overview.json, capped by the order's limit price. Empty if no quote.
+func (s *AlgoScheduler) pegPrice(o model.ParsedOrder) string {
+	ov := market.ReadOverview(s.holdDir(o))
+	if ov == nil {
+		return ""
+	}
+	peg := ov.Bid
+	if o.Side == "SELL" {
+		peg = ov.Ask
+	}
+	if peg <= 0 {
+		return ""
+	}
+	if limit, err := strconv.ParseFloat(o.Price, 64); err == nil && limit > 0 {
+		if (o.Side == "BUY" && peg > limit) || (o.Side == "SELL" && peg < limit) {
+			peg = limit
 		}
 	}
+	return formatFloat(market.TickPrice(market.ReadStatic(s.holdDir(o)), roundPrice(peg), o.Side == "SELL"))
+}
+
+// visibleQty returns the size of the next slice: SliceQty, randomized by
+// +/- AlgoVariance in whole lots, never more than remaining. A remainder smaller than half
+// a slice is folded into this one rather than left as a separate slice.
+func (t *AlgoTask) visibleQty(remaining int64) int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	log.Printf("ICEBERG execution completed: intent=%s total_slices=%d", task.IntentID, task.TotalSlices)
+	qty := t.SliceQty
+	if v := t.Order.AlgoVariance; v > 0 {
+		qty = int64(math.Round(float64(qty) * (1 + v*(2*rand.Float64()-1))))
+	}
+	lot := max(t.LotSize, 1)
+	if qty = qty / lot * lot; qty < lot {
+		qty = lot
+	}
+	if qty > remaining || remaining-qty < t.SliceQty/2 {
+		qty = remaining
+	}
+	return qty
+}
+
+// persist saves task, logging failures.
+func (s *AlgoScheduler) persist(task *AlgoTask) {
+	if err := s.save(task); err != nil {
+		log.Printf("WARNING: persist algo task %s: %v", task.IntentID, err)
+	}
+}
+
+// isLimitType reports whether an order type carries a limit price.
+func isLimitType(t string) bool {
+	switch MapOrderType(t) {
+	case "LO", "ELO", "ALO":
+		return true
+	}
+	return false
 }
@@ -0,0 +1,111 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"longbridge-fs/internal/market"
+)
+
+// povInterval is how often POV compares its executed quantity with the
+// market volume traded since it started. A var so tests can shorten it.
+var povInterval = 10 * time.Second
+
+// executePOV executes a Percentage-of-Volume algorithm
+// Keeps the executed quantity at algo_pov_rate of the volume the market has
+// traded since the start, read from the subscribed quote in overview.json
+func (s *AlgoScheduler) executePOV(ctx context.Context, task *AlgoTask) {
+	defer func() {
+		task.mu.Lock()
+		task.Done = true
+		task.mu.Unlock()
+	}()
+
+	log.Printf("Starting POV execution: intent=%s total_qty=%d rate=%g start=%s",
+		task.IntentID, task.TotalQty, task.Order.AlgoPovRate, task.StartAt.Format(time.RFC3339))
+
+	reason, ok := s.runPOV(ctx, task)
+	if !ok {
+		return
+	}
+
+	s.finish(task, AlgoCompleted, reason)
+	log.Printf("POV execution completed: intent=%s slices=%d executed=%d", task.IntentID, task.CurrentSlice, task.ExecutedQty)
+}
+
+// runPOV submits a slice whenever the executed quantity falls behind
+// rate * (market volume - volume at start), capped at SliceQty if set. It
+// ends when the total is executed or at algo_end, returning a reason if
+// quantity was left over. ok is false if the task was stopped.
+func (s *AlgoScheduler) runPOV(ctx context.Context, task *AlgoTask) (reason string, ok bool) {
+	o := task.Order
+	for {
+		if !s.await(ctx, task) {
+			log.Printf("POV execution stopped: intent=%s", task.IntentID)
+			return "", false
+		}
+
+		now := time.Now()
+		task.mu.Lock()
+		executed, base := task.ExecutedQty, task.VolumeBase
+		ended := !task.EndAt.IsZero() && !now.Before(task.EndAt)
+		task.NextDueAt = now.Add(task.Interval)
+		task.mu.Unlock()
+
+		if executed >= task.TotalQty {
+			return "", true
+		}
+		if ended {
+			return fmt.Sprintf("algo_end reached with %d of %d executed", executed, task.TotalQty), true
+		}
+
+		ov := market.ReadOverview(s.holdDir(o))
+		if ov == nil || ov.Volume <= 0 {
+			continue // no live volume yet; subscribe the symbol
+		}
+		if base == 0 || ov.Volume < base {
+			// First observation, or a new session reset the day volume
+			task.mu.Lock()
+			task.VolumeBase = ov.Volume
+			task.mu.Unlock()
+			s.persist(task)
+			continue
+		}
+
+		target := int64(math.Floor(o.AlgoPovRate * float64(ov.Volume-base)))
+		if target > task.TotalQty {
+			target = task.TotalQty
+		}
+		qty := target - executed
+		if task.SliceQty > 0 && qty > task.SliceQty {
+			qty = task.SliceQty
+		}
+		if lot := max(task.LotSize, 1); qty < task.TotalQty-executed {
+			qty = qty / lot * lot // whole lots until the last slice
+		}
+		if qty <= 0 {
+			continue
+		}
+
+		task.mu.Lock()
+		slice := task.CurrentSlice + 1
+		task.mu.Unlock()
+		info, err := s.executeSlice(ctx, task, slice, qty, "")
+
+		task.mu.Lock()
+		task.CurrentSlice = slice
+		if err != nil {
+			task.addError(fmt.Sprintf("slice %d: %v", slice, err))
+		} else {
+			task.ExecutedQty += qty
+			task.RemainingQty = task.TotalQty - task.ExecutedQty
+			task.OrderIDs = append(task.OrderIDs, info.OrderID)
+			task.LastSliceAt = now
+		}
+		task.mu.Unlock()
+		s.persist(task)
+	}
+}
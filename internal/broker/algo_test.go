@@ -2,10 +2,15 @@ package broker
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"longbridge-fs/internal/model"
 )
 
 func TestTWAPExecution(t *testing.T) {
@@ -36,13 +41,14 @@ func TestTWAPExecution(t *testing.T) {
 	}
 
 	// Create scheduler
-	scheduler := NewAlgoScheduler(bcPath, nil, true)
+	b := NewMockBroker()
+	scheduler := NewAlgoScheduler(bcPath, tmpDir, b)
 	defer scheduler.Shutdown()
 
 	ctx := context.Background()
 
 	// Process ledger
-	n, err := ProcessLedgerWithScheduler(ctx, nil, tmpDir, true, scheduler)
+	n, err := ProcessLedgerWithScheduler(ctx, b, tmpDir, tmpDir, scheduler, NewLedgerState(DefaultRetryWindow))
 	if err != nil {
 		t.Fatalf("ProcessLedger failed: %v", err)
 	}
@@ -116,13 +122,14 @@ func TestICEBERGExecution(t *testing.T) {
 	}
 
 	// Create scheduler
-	scheduler := NewAlgoScheduler(bcPath, nil, true)
+	b := NewMockBroker()
+	scheduler := NewAlgoScheduler(bcPath, tmpDir, b)
 	defer scheduler.Shutdown()
 
 	ctx := context.Background()
 
 	// Process ledger
-	n, err := ProcessLedgerWithScheduler(ctx, nil, tmpDir, true, scheduler)
+	n, err := ProcessLedgerWithScheduler(ctx, b, tmpDir, tmpDir, scheduler, NewLedgerState(DefaultRetryWindow))
 	if err != nil {
 		t.Fatalf("ProcessLedger failed: %v", err)
 	}
@@ -131,7 +138,7 @@ func TestICEBERGExecution(t *testing.T) {
 		t.Errorf("Expected 1 order processed, got %d", n)
 	}
 
-	// Wait for ICEBERG to complete (3 slices * 2s delay)
+	// Wait for ICEBERG to complete (mock fills release each next slice at once)
 	time.Sleep(8 * time.Second)
 
 	// Verify executions were written
@@ -161,3 +168,376 @@ func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) &&
 		(s[:len(substr)] == substr || contains(s[1:], substr)))
 }
+
+func TestAlgoTaskRestore(t *testing.T) {
+	tmpDir := t.TempDir()
+	algoDir := filepath.Join(tmpDir, "trade", "algo")
+	if err := os.MkdirAll(algoDir, 0755); err != nil {
+		t.Fatalf("Failed to create algo dir: %v", err)
+	}
+	bcPath := filepath.Join(tmpDir, "trade", "beancount.txt")
+	if err := os.WriteFile(bcPath, nil, 0644); err != nil {
+		t.Fatalf("Failed to write ledger: %v", err)
+	}
+
+	// A GTC TWAP interrupted after 1 of 2 slices, and a DAY ICEBERG from yesterday
+	yesterday := time.Now().AddDate(0, 0, -1)
+	tasks := map[string]string{
+		"resume-001": `{"intent_id":"resume-001","order":{"IntentID":"resume-001","Side":"BUY","Symbol":"AAPL","Market":"US","Qty":"200","OrderType":"MARKET","TIF":"GTC","Algo":"TWAP"},
+			"total_qty":200,"slice_qty":100,"total_slices":2,"slices_done":1,"executed_qty":100,"remaining_qty":100,
+			"interval":1000000,"created_at":"` + yesterday.Format(time.RFC3339) + `","next_due_at":"` + yesterday.Format(time.RFC3339) + `","status":"RUNNING"}`,
+		"stale-001": `{"intent_id":"stale-001","order":{"IntentID":"stale-001","Side":"SELL","Symbol":"TSLA","Market":"US","Qty":"300","OrderType":"MARKET","TIF":"DAY","Algo":"ICEBERG"},
+			"total_qty":300,"slice_qty":100,"total_slices":3,"slices_done":1,"executed_qty":100,"remaining_qty":200,
+			"interval":1000000,"created_at":"` + yesterday.Format(time.RFC3339) + `","next_due_at":"` + yesterday.Format(time.RFC3339) + `","status":"RUNNING"}`,
+	}
+	for id, body := range tasks {
+		if err := os.WriteFile(filepath.Join(algoDir, id+".json"), []byte(body), 0644); err != nil {
+			t.Fatalf("Failed to write task: %v", err)
+		}
+	}
+
+	scheduler := NewAlgoScheduler(bcPath, tmpDir, NewMockBroker())
+	defer scheduler.Shutdown()
+
+	resumed, abandoned, err := scheduler.Restore()
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if resumed != 1 || abandoned != 1 {
+		t.Fatalf("Expected 1 resumed and 1 abandoned, got %d and %d", resumed, abandoned)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("Failed to read beancount: %v", err)
+	}
+	content := string(data)
+	for _, want := range []string{"slice 2/2", "status: COMPLETED", "status: ABANDONED", "remaining_qty: 200"} {
+		if !contains(content, want) {
+			t.Errorf("Expected %q in ledger", want)
+		}
+	}
+	if contains(content, "slice 1/2") {
+		t.Errorf("Resumed task re-submitted a finished slice")
+	}
+	if _, err := os.Stat(filepath.Join(algoDir, "resume-001.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected task file removed after completion")
+	}
+	if t.Failed() {
+		t.Logf("Beancount content:\n%s", content)
+	}
+}
+
+func TestAlgoRestoreSkipsJournaledSlice(t *testing.T) {
+	tmpDir := t.TempDir()
+	algoDir := filepath.Join(tmpDir, "trade", "algo")
+	if err := os.MkdirAll(algoDir, 0755); err != nil {
+		t.Fatalf("Failed to create algo dir: %v", err)
+	}
+
+	// Slice 2 was submitted and journaled, then the controller died before
+	// the task file recorded it
+	bcPath := filepath.Join(tmpDir, "trade", "beancount.txt")
+	journal := `
+2026-03-31 * "SUBMITTED" "TWAP slice 2/3 BUY AAPL.US"
+  ; intent_id: crash-001
+  ; order_id: 42
+  ; status: SUBMITTED
+  ; symbol: AAPL.US
+  ; side: BUY
+  ; qty: 100
+  ; algo: TWAP
+  ; slice: 2/3
+`
+	if err := os.WriteFile(bcPath, []byte(journal), 0644); err != nil {
+		t.Fatalf("Failed to write ledger: %v", err)
+	}
+	now := time.Now().Format(time.RFC3339)
+	task := `{"intent_id":"crash-001","order":{"IntentID":"crash-001","Side":"BUY","Symbol":"AAPL","Market":"US","Qty":"300","OrderType":"MARKET","TIF":"GTC","Algo":"TWAP"},
+		"total_qty":300,"slice_qty":100,"total_slices":3,"slices_done":1,"executed_qty":100,"remaining_qty":200,
+		"interval":1000000,"created_at":"` + now + `","next_due_at":"` + now + `","status":"RUNNING","order_ids":["41"]}`
+	if err := os.WriteFile(filepath.Join(algoDir, "crash-001.json"), []byte(task), 0644); err != nil {
+		t.Fatalf("Failed to write task: %v", err)
+	}
+
+	scheduler := NewAlgoScheduler(bcPath, tmpDir, NewMockBroker())
+	defer scheduler.Shutdown()
+	if resumed, _, err := scheduler.Restore(); err != nil || resumed != 1 {
+		t.Fatalf("Restore = %d, %v; want 1 resumed", resumed, err)
+	}
+	// The status file is written last when the task finishes
+	statusPath := filepath.Join(algoDir, "status", "crash-001.json")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if st, _ := os.ReadFile(statusPath); strings.Contains(string(st), AlgoCompleted) {
+			break
+		}
+	}
+
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("Failed to read beancount: %v", err)
+	}
+	content := string(data)
+	if n := strings.Count(content, "slice 2/3"); n != 1 {
+		t.Errorf("Expected slice 2/3 sent once, found %d times", n)
+	}
+	for _, want := range []string{"slice 3/3", "status: COMPLETED", "executed_qty: 300"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected %q in ledger", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("Beancount content:\n%s", content)
+	}
+}
+
+func TestAlgoControlPauseResumeCancel(t *testing.T) {
+	tmpDir := t.TempDir()
+	algoDir := filepath.Join(tmpDir, "trade", "algo")
+	if err := os.MkdirAll(filepath.Join(algoDir, "control"), 0755); err != nil {
+		t.Fatalf("Failed to create control dir: %v", err)
+	}
+	bcPath := filepath.Join(tmpDir, "trade", "beancount.txt")
+	order := `2026-03-31 * "ORDER" "BUY AAPL.US 400 via TWAP"
+  ; intent_id: ctl-001
+  ; side: BUY
+  ; symbol: AAPL
+  ; qty: 400
+  ; type: LIMIT
+  ; price: 182.00
+  ; tif: DAY
+  ; algo: TWAP
+  ; algo_duration: 20s
+  ; algo_slices: 4
+`
+	if err := os.WriteFile(bcPath, []byte(order), 0644); err != nil {
+		t.Fatalf("Failed to write order: %v", err)
+	}
+
+	control := func(cmd string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(algoDir, "control", "ctl-001"), []byte(cmd+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write control: %v", err)
+		}
+		time.Sleep(1500 * time.Millisecond)
+	}
+	status := func() AlgoStatus {
+		t.Helper()
+		var st AlgoStatus
+		data, err := os.ReadFile(filepath.Join(algoDir, "status", "ctl-001.json"))
+		if err != nil {
+			t.Fatalf("Failed to read status: %v", err)
+		}
+		if err := json.Unmarshal(data, &st); err != nil {
+			t.Fatalf("Failed to parse status: %v", err)
+		}
+		return st
+	}
+
+	// Paused before the first slice is due
+	control("PAUSE")
+	b := NewMockBroker()
+	scheduler := NewAlgoScheduler(bcPath, tmpDir, b)
+	defer scheduler.Shutdown()
+	ctx := context.Background()
+	state := NewLedgerState(DefaultRetryWindow)
+	if _, err := ProcessLedgerWithScheduler(ctx, b, tmpDir, tmpDir, scheduler, state); err != nil {
+		t.Fatalf("ProcessLedger failed: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if st := status(); st.Status != AlgoPaused || st.SlicesDone != 0 {
+		t.Fatalf("Expected paused task with no slices, got %+v", st)
+	}
+
+	// Resumed: first slice goes out, the next is 5s away
+	control("RESUME")
+	if _, err := ProcessLedgerWithScheduler(ctx, b, tmpDir, tmpDir, scheduler, state); err != nil {
+		t.Fatalf("ProcessLedger failed: %v", err)
+	}
+	if st := status(); st.Status != AlgoRunning || st.SlicesDone != 1 || st.FilledQty != 100 || st.AvgFillPrice != "182" {
+		t.Fatalf("Expected one filled slice after resume, got %+v", st)
+	}
+
+	control("CANCEL")
+	if st := status(); st.Status != AlgoCancelled || st.SlicesDone != 1 {
+		t.Fatalf("Expected cancelled task, got %+v", st)
+	}
+	if _, err := os.Stat(filepath.Join(algoDir, "control", "ctl-001")); !os.IsNotExist(err) {
+		t.Errorf("Expected control file consumed")
+	}
+
+	data, _ := os.ReadFile(bcPath)
+	content := string(data)
+	for _, want := range []string{"status: PAUSED", "status: RESUMED", "status: CANCELLED"} {
+		if !contains(content, want) {
+			t.Errorf("Expected %q in ledger:\n%s", want, content)
+		}
+	}
+	if contains(content, "slice 2/4") {
+		t.Errorf("Cancelled task submitted another slice")
+	}
+}
+
+func TestICEBERGWaitsForSliceFill(t *testing.T) {
+	root, bcPath := newLedger(t, "")
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":100.00,"bid":99.50,"ask":100.10,"updated_at":"t1"}`, "")
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+
+	order := `2026-03-31 * "ORDER" "BUY AAPL.US 300 via ICEBERG"
+  ; intent_id: ice-fill-001
+  ; side: BUY
+  ; symbol: AAPL
+  ; qty: 300
+  ; type: LIMIT
+  ; price: 99.00
+  ; tif: DAY
+  ; algo: ICEBERG
+  ; algo_slices: 3
+  ; algo_repeg: true
+`
+	if err := os.WriteFile(bcPath, []byte(order), 0644); err != nil {
+		t.Fatalf("Failed to write order: %v", err)
+	}
+
+	scheduler := NewAlgoScheduler(bcPath, root, b)
+	defer scheduler.Shutdown()
+	ctx := context.Background()
+	state := NewLedgerState(DefaultRetryWindow)
+	run := func() string {
+		t.Helper()
+		if _, err := ProcessLedgerWithScheduler(ctx, b, root, root, scheduler, state); err != nil {
+			t.Fatalf("ProcessLedger failed: %v", err)
+		}
+		time.Sleep(1500 * time.Millisecond)
+		data, _ := os.ReadFile(bcPath)
+		return string(data)
+	}
+
+	// The first slice rests at the limit (bid is above it); nothing more is shown
+	content := run()
+	content = run()
+	if !contains(content, "slice 1/3") || contains(content, "slice 2/3") {
+		t.Fatalf("Expected only the first slice while it is unfilled:\n%s", content)
+	}
+	if book, _ := os.ReadFile(b.ordersPath()); !contains(string(book), `"limit_price": 99,`) {
+		t.Fatalf("Expected the peg capped at the limit price:\n%s", book)
+	}
+
+	// Price falls through the limit: each fill releases the next slice, pegged
+	// to the bid, which trades once the following snapshot prints below it
+	for i := 0; i < 6 && !contains(content, "status: COMPLETED"); i++ {
+		last := 97.0 - float64(i)
+		writeQuote(t, root, "AAPL.US", fmt.Sprintf(`{"symbol":"AAPL.US","last":%.2f,"bid":%.2f,"ask":%.2f,"updated_at":"t%d"}`, last, last+0.5, last+0.7, i+2), "")
+		content = run()
+	}
+	if book, _ := os.ReadFile(b.ordersPath()); !contains(string(book), `"limit_price": 97.5`) {
+		t.Errorf("Expected the second slice pegged to the bid:\n%s", book)
+	}
+	for _, want := range []string{"slice 2/3", "slice 3/3", "status: COMPLETED"} {
+		if !contains(content, want) {
+			t.Errorf("Expected %q in ledger", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("Beancount content:\n%s", content)
+	}
+}
+
+func TestICEBERGVisibleQtyVariance(t *testing.T) {
+	task := &AlgoTask{SliceQty: 100, Order: model.ParsedOrder{AlgoVariance: 0.2}}
+	for i := 0; i < 100; i++ {
+		if qty := task.visibleQty(1000); qty < 80 || qty > 120 {
+			t.Fatalf("visible qty %d outside 100 +/- 20%%", qty)
+		}
+	}
+	// A remainder below half a slice is folded into the last one
+	task.Order.AlgoVariance = 0
+	if qty := task.visibleQty(140); qty != 140 {
+		t.Errorf("Expected remainder folded into slice, got %d", qty)
+	}
+}
+
+func TestVWAPScheduleFollowsVolumeProfile(t *testing.T) {
+	holdDir := filepath.Join(t.TempDir(), "AAPL.US")
+	if err := os.MkdirAll(holdDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bars := `[
+  {"date":"2026-03-30 14:00","volume":300},
+  {"date":"2026-03-30 14:05","volume":100},
+  {"date":"2026-03-31 14:00","volume":300}
+]`
+	if err := os.WriteFile(filepath.Join(holdDir, "5D.json"), []byte(bars), 0644); err != nil {
+		t.Fatalf("write 5D.json: %v", err)
+	}
+
+	start := time.Date(2026, 4, 1, 14, 0, 0, 0, time.UTC)
+	got := vwapSchedule(volumeProfile(holdDir), start, 5*time.Minute, 3, 701)
+	if len(got) != 3 || got[0] != 601 || got[1] != 100 || got[2] != 0 {
+		t.Fatalf("Expected schedule [601 100 0], got %v", got)
+	}
+
+	// No history in the window: even split
+	got = vwapSchedule(volumeProfile(holdDir), start.Add(time.Hour), time.Minute, 3, 10)
+	if got[0]+got[1]+got[2] != 10 || got[0] < 3 || got[0] > 4 {
+		t.Fatalf("Expected an even split of 10, got %v", got)
+	}
+}
+
+func TestPOVTracksMarketVolume(t *testing.T) {
+	defer func(d time.Duration) { povInterval = d }(povInterval)
+	povInterval = 100 * time.Millisecond
+
+	order := `2026-03-31 * "ORDER" "BUY AAPL.US 300 via POV"
+  ; intent_id: pov-001
+  ; side: BUY
+  ; symbol: AAPL
+  ; qty: 300
+  ; type: MARKET
+  ; tif: DAY
+  ; algo: POV
+  ; algo_pov_rate: 0.1
+  ; algo_duration: 1h
+`
+	root, bcPath := newLedger(t, order)
+	volume := func(v int) {
+		writeQuote(t, root, "AAPL.US", fmt.Sprintf(`{"symbol":"AAPL.US","last":100.00,"volume":%d,"updated_at":"t%d"}`, v, v), "")
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	volume(10000)
+	b := NewMockBroker()
+	scheduler := NewAlgoScheduler(bcPath, root, b)
+	defer scheduler.Shutdown()
+	if _, err := ProcessLedgerWithScheduler(context.Background(), b, root, root, scheduler, NewLedgerState(DefaultRetryWindow)); err != nil {
+		t.Fatalf("ProcessLedger failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	// 2000 shares traded since start: 10% is 200
+	volume(12000)
+	data, _ := os.ReadFile(bcPath)
+	if !contains(string(data), "qty: 200") || contains(string(data), "status: COMPLETED") {
+		t.Fatalf("Expected a 200 share slice after 2000 traded:\n%s", data)
+	}
+
+	// 4000 traded: the remaining 100 completes the order
+	volume(14000)
+	data, _ = os.ReadFile(bcPath)
+	content := string(data)
+	for _, want := range []string{"slice 2", "qty: 100", "status: COMPLETED", "slices_done: 2\n"} {
+		if !contains(content, want) {
+			t.Errorf("Expected %q in ledger", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("Beancount content:\n%s", content)
+	}
+}
@@ -3,7 +3,6 @@ package broker
 import (
 	"context"
 	"log"
-	"time"
 )
 
 // executeTWAP executes a Time-Weighted Average Price algorithm
@@ -18,48 +17,10 @@ func (s *AlgoScheduler) executeTWAP(ctx context.Context, task *AlgoTask) {
 	log.Printf("Starting TWAP execution: intent=%s total_qty=%d slices=%d interval=%s",
 		task.IntentID, task.TotalQty, task.TotalSlices, task.Interval)
 
-	for i := 1; i <= task.TotalSlices; i++ {
-		select {
-		case <-ctx.Done():
-			log.Printf("TWAP execution cancelled: intent=%s at slice %d/%d", task.IntentID, i, task.TotalSlices)
-			return
-		default:
-		}
-
-		// Calculate quantity for this slice
-		var sliceQty int64
-		if i == task.TotalSlices {
-			// Last slice gets remainder to handle rounding
-			task.mu.Lock()
-			executedQty := task.SliceQty * int64(i-1)
-			sliceQty = task.TotalQty - executedQty
-			task.mu.Unlock()
-		} else {
-			sliceQty = task.SliceQty
-		}
-
-		// Execute the slice
-		if err := s.executeSlice(task, i, sliceQty); err != nil {
-			log.Printf("TWAP slice %d/%d failed: intent=%s err=%v", i, task.TotalSlices, task.IntentID, err)
-			// Continue with remaining slices even if one fails
-		}
-
-		task.mu.Lock()
-		task.CurrentSlice = i
-		task.LastSliceAt = time.Now()
-		task.mu.Unlock()
-
-		// Wait for interval before next slice (except after last slice)
-		if i < task.TotalSlices {
-			select {
-			case <-ctx.Done():
-				log.Printf("TWAP execution cancelled: intent=%s after slice %d/%d", task.IntentID, i, task.TotalSlices)
-				return
-			case <-time.After(task.Interval):
-				// Continue to next slice
-			}
-		}
+	if !s.runSlices(ctx, task) {
+		return
 	}
 
+	s.finish(task, AlgoCompleted, "")
 	log.Printf("TWAP execution completed: intent=%s total_slices=%d", task.IntentID, task.TotalSlices)
 }
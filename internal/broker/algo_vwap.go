@@ -0,0 +1,100 @@
+package broker
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"longbridge-fs/internal/market"
+)
+
+// executeVWAP executes a Volume-Weighted Average Price algorithm
+// Splits the algo window into equal buckets and sizes each bucket's slice by
+// the volume that traded at that time of day historically
+func (s *AlgoScheduler) executeVWAP(ctx context.Context, task *AlgoTask) {
+	defer func() {
+		task.mu.Lock()
+		task.Done = true
+		task.mu.Unlock()
+	}()
+
+	log.Printf("Starting VWAP execution: intent=%s total_qty=%d slices=%d window=%s-%s schedule=%v",
+		task.IntentID, task.TotalQty, task.TotalSlices, task.StartAt.Format("15:04"), task.EndAt.Format("15:04"), task.Schedule)
+
+	if !s.runSlices(ctx, task) {
+		return
+	}
+
+	s.finish(task, AlgoCompleted, "")
+	log.Printf("VWAP execution completed: intent=%s total_slices=%d", task.IntentID, task.TotalSlices)
+}
+
+// volumeProfile returns the traded volume per minute of day (UTC) from the
+// 5-minute bars in 5D.json, each bar spread evenly over its five minutes.
+// Without 5D.json it falls back to today's minute bars in intraday.json.
+func volumeProfile(holdDir string) map[int]float64 {
+	profile := make(map[int]float64)
+	for _, c := range market.ReadCandlesticks(holdDir, "5D") {
+		t, err := time.Parse("2006-01-02 15:04", c.Date)
+		if err != nil || c.Volume <= 0 {
+			continue
+		}
+		m := t.Hour()*60 + t.Minute()
+		for i := 0; i < 5; i++ {
+			profile[(m+i)%(24*60)] += float64(c.Volume) / 5
+		}
+	}
+	if len(profile) > 0 {
+		return profile
+	}
+	for _, p := range market.ReadIntraday(holdDir) {
+		t, err := time.Parse("15:04", p.Time)
+		if err != nil || p.Volume <= 0 {
+			continue
+		}
+		profile[t.Hour()*60+t.Minute()] += float64(p.Volume)
+	}
+	return profile
+}
+
+// vwapSchedule splits total over n slices of interval starting at start, in
+// proportion to the profile volume inside each slice's time span. Rounding
+// leftovers go to the slices with the largest fractional share; without any
+// profile volume in the window the split is even.
+func vwapSchedule(profile map[int]float64, start time.Time, interval time.Duration, n int, total int64) []int64 {
+	weights := make([]float64, n)
+	var sum float64
+	for i := range weights {
+		from := start.Add(time.Duration(i) * interval).UTC()
+		to := from.Add(interval)
+		for t := from.Truncate(time.Minute); t.Before(to); t = t.Add(time.Minute) {
+			weights[i] += profile[t.Hour()*60+t.Minute()]
+		}
+		sum += weights[i]
+	}
+	if sum == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		sum = float64(n)
+	}
+
+	qty := make([]int64, n)
+	order := make([]int, n)
+	frac := make([]float64, n)
+	var assigned int64
+	for i, w := range weights {
+		exact := float64(total) * w / sum
+		qty[i] = int64(exact)
+		frac[i] = exact - float64(qty[i])
+		assigned += qty[i]
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return frac[order[a]] > frac[order[b]] })
+	for k := 0; assigned < total; k++ {
+		qty[order[k%n]]++
+		assigned++
+	}
+	return qty
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,23 +20,104 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// LedgerState is what the ledger processor remembers between cycles of one
+// account: orders waiting out a retry backoff and orders held for their
+// session. Entries are keyed by root and intent_id, so accounts never share
+// them even if their ledgers reuse an intent_id.
+type LedgerState struct {
+	retryWindow time.Duration
+	retries     map[string]*submitRetry
+	held        map[string]string // session state an order was last held in
+}
+
+// NewLedgerState returns an empty state whose transient submission errors
+// are retried for retryWindow (0 disables retries).
+func NewLedgerState(retryWindow time.Duration) *LedgerState {
+	return &LedgerState{
+		retryWindow: retryWindow,
+		retries:     make(map[string]*submitRetry),
+		held:        make(map[string]string),
+	}
+}
+
+func stateKey(root, intentID string) string {
+	return root + "\x00" + intentID
+}
+
 // ProcessLedger reads the beancount ledger, finds unprocessed ORDER entries,
-// and executes them. Returns the number of new executions.
-func ProcessLedger(ctx context.Context, tc *trade.TradeContext, root string, useMock bool) (int, error) {
-	return ProcessLedgerWithScheduler(ctx, tc, root, useMock, nil)
+// and executes them through b. Returns the number of new executions.
+// Retry and hold state last for this call only.
+func ProcessLedger(ctx context.Context, b Broker, root string) (int, error) {
+	return ProcessLedgerWithScheduler(ctx, b, root, root, nil, NewLedgerState(DefaultRetryWindow))
 }
 
-// ProcessLedgerWithScheduler processes ledger with optional algo scheduler
-func ProcessLedgerWithScheduler(ctx context.Context, tc *trade.TradeContext, root string, useMock bool, scheduler *AlgoScheduler) (int, error) {
+// ProcessLedgerWithScheduler processes ledger with optional algo scheduler.
+// A nil broker leaves orders, CANCELs and REPLACEs unexecuted and unjournaled;
+// it still records the rejections that need no venue (invalid or duplicate
+// orders, risk and session checks).
+// quoteRoot is the FS root whose quote/ tree (calendars, static.json) serves
+// the account at root; the two differ for accounts/{name}/.
+// state carries retries and session holds over to the account's next cycle.
+func ProcessLedgerWithScheduler(ctx context.Context, b Broker, root, quoteRoot string, scheduler *AlgoScheduler, state *LedgerState) (int, error) {
 	bcPath := filepath.Join(root, "trade", "beancount.txt")
-	entries, err := ledger.ParseEntries(bcPath)
+	index := ledger.OpenIndex(root)
+	entries, err := index.Refresh()
 	if err != nil {
 		return 0, err
 	}
 
-	processed, orders := ledger.BuildLedgerState(entries)
+	// Journal fills, cancels and expiries of orders that are already working
+	if es, ok := b.(EventSource); ok {
+		for _, info := range WorkingOrders(entries) {
+			es.Track(info)
+		}
+		events := es.DrainEvents(ctx)
+		for _, ev := range events {
+			AppendOrderEvent(bcPath, ev)
+			log.Printf("order %s: intent=%s order_id=%s filled=%s/%s",
+				strings.ToLower(ev.Order.Status), ev.Order.IntentID, ev.Order.OrderID, ev.Order.FilledQty, ev.Order.Qty)
+		}
+		if len(events) > 0 {
+			if entries, err = index.Refresh(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// Submit exit legs and cancel siblings of BRACKET/OCO groups
+	if b != nil {
+		advanceGroups(ctx, b, bcPath, entries)
+	}
+
+	// Refresh fill progress of running algo tasks
+	if scheduler != nil {
+		scheduler.UpdateFills(entries)
+	}
+
+	// Intents handled in this cycle; earlier ones are in the index
+	processed := make(map[string]bool)
+	orders, duplicates := index.Pending()
 	executed := 0
 
+	// An intent_id is used once: ORDERs reusing one are rejected, never
+	// executed, whether the original is live or compacted
+	for _, d := range duplicates {
+		o, _ := ledger.OrderFromEntry(d.Entry)
+		reason := fmt.Sprintf("%s: intent_id %s already used", ledger.ReasonDuplicateIntent, o.IntentID)
+		switch {
+		case d.Original.Parent != "":
+			reason += " by a leg of order group " + d.Original.Parent
+		case d.Original.Date != "":
+			reason += " by the ORDER of " + d.Original.Date
+		}
+		if d.Original.Block != "" {
+			reason += " (block " + d.Original.Block + ")"
+		}
+		AppendRejection(bcPath, o.IntentID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, o.Qty, reason)
+		log.Printf("order rejected: intent=%s reason=%s", o.IntentID, reason)
+		executed++
+	}
+
 	// Phase 1: Initialize risk gate
 	gate, err := riskgate.NewGate(root)
 	if err != nil {
@@ -53,8 +135,11 @@ func ProcessLedgerWithScheduler(ctx context.Context, tc *trade.TradeContext, roo
 		}
 	}
 
+	// Today's venue orders, to recover intents submitted before a crash
+	placed := newPlacedOrders(b)
+
 	for _, oe := range orders {
-		o := ledger.OrderFromEntry(oe)
+		o, invalid := ledger.OrderFromEntry(oe)
 		if o.IntentID == "" {
 			continue
 		}
@@ -62,16 +147,31 @@ func ProcessLedgerWithScheduler(ctx context.Context, tc *trade.TradeContext, roo
 			continue
 		}
 
+		// Orders the controller cannot submit as written are rejected, never
+		// downgraded to another type
+		if invalid != nil {
+			AppendRejection(bcPath, o.IntentID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, o.Qty, "INVALID_ORDER: "+invalid.Error())
+			log.Printf("order rejected: intent=%s err=%v", o.IntentID, invalid)
+			processed[o.IntentID] = true
+			executed++
+			continue
+		}
+
 		// Handle CANCEL action
-		if strings.ToUpper(o.Side) == "" && oe.Meta["action"] == "CANCEL" {
-			orderID := oe.Meta["order_id"]
-			if orderID == "" {
-				continue
-			}
-			if !useMock && tc != nil {
-				if err := tc.CancelOrder(ctx, orderID); err != nil {
-					AppendRejection(bcPath, o.IntentID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, o.Qty, err.Error())
+		if o.Action == "CANCEL" {
+			orderID := o.OrderID
+			if b != nil {
+				if state.retryPending(root, o.IntentID, time.Now()) {
+					continue
+				}
+				if err := b.Cancel(ctx, orderID); err != nil {
+					retry, meta := state.retryLater(root, o.IntentID, err, time.Now())
+					if retry {
+						continue
+					}
+					appendRejection(bcPath, o.IntentID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, o.Qty, err.Error(), meta)
 				} else {
+					state.submitted(root, o.IntentID)
 					AppendExecution(bcPath, o.IntentID, "CANCEL-"+orderID, ledger.FullSymbol(o.Symbol, o.Market), "", "", "0")
 					log.Printf("cancelled order: intent=%s order_id=%s", o.IntentID, orderID)
 				}
@@ -81,39 +181,58 @@ func ProcessLedgerWithScheduler(ctx context.Context, tc *trade.TradeContext, roo
 			continue
 		}
 
-		// Phase 1: Pre-trade risk check
-		if gate != nil && gate.IsEnabled() && accountState != nil {
-			result := gate.CheckOrder(&o, accountState)
-			gate.UpdateStatus(result.Passed)
-
-			if !result.Passed {
-				// Record violation
-				if err := gate.RecordViolation(&o, result); err != nil {
-					log.Printf("WARNING: failed to record violation: %v", err)
-				}
+		// Handle REPLACE action (amend a working order in place)
+		if o.Action == "REPLACE" {
+			processReplace(ctx, b, root, quoteRoot, entries, o, gate, accountState)
+			processed[o.IntentID] = true
+			executed++
+			continue
+		}
 
-				// Reject order based on mode
-				if !gate.ShouldWarnOnly() {
-					sym := ledger.FullSymbol(o.Symbol, o.Market)
-					reason := fmt.Sprintf("RISK_%s: %s", strings.ToUpper(result.Rule), result.Reason)
-					AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, reason)
-					log.Printf("order rejected by risk gate: intent=%s rule=%s", o.IntentID, result.Rule)
-					processed[o.IntentID] = true
-					executed++
-					continue
-				} else {
-					log.Printf("WARNING: order violates risk rule but allowed in WARN mode: intent=%s rule=%s", o.IntentID, result.Rule)
-				}
-			}
+		// Trading calendar: wait for the session, or reject a DAY order
+		// whose session is over
+		if hold, reason := state.holdForSession(root, quoteRoot, o); hold {
+			continue
+		} else if reason != "" {
+			AppendRejection(bcPath, o.IntentID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, o.Qty, reason)
+			log.Printf("order rejected: intent=%s reason=%s", o.IntentID, reason)
+			processed[o.IntentID] = true
+			executed++
+			continue
+		}
 
-			// Increment order count for frequency tracking
-			if err := gate.IncrementOrderCount(); err != nil {
-				log.Printf("WARNING: failed to increment order count: %v", err)
-			}
+		// Board lots and ticks from the symbol's static.json
+		note, err := normalizeOrder(root, quoteRoot, &o)
+		if err != nil {
+			AppendRejection(bcPath, o.IntentID, ledger.FullSymbol(o.Symbol, o.Market), o.Side, o.Qty, err.Error())
+			log.Printf("order rejected: intent=%s err=%v", o.IntentID, err)
+			processed[o.IntentID] = true
+			executed++
+			continue
+		}
+		var meta map[string]string
+		if note != "" {
+			meta = map[string]string{"normalized": note}
+			log.Printf("order normalized: intent=%s %s", o.IntentID, note)
+		}
+
+		// BRACKET/OCO groups run their own risk check and submit legs
+		if IsGroupOrder(o.OrderType) {
+			submitGroup(ctx, b, bcPath, o, gate, accountState)
+			processed[o.IntentID] = true
+			executed++
+			continue
+		}
+
+		// Phase 1: Pre-trade risk check
+		if !preTradeCheck(gate, accountState, bcPath, &o) {
+			processed[o.IntentID] = true
+			executed++
+			continue
 		}
 
 		// Phase 4: Check if this is an algorithmic order
-		if scheduler != nil && (o.Algo == "TWAP" || o.Algo == "ICEBERG") {
+		if scheduler != nil && o.Algo != "" && o.Algo != "NONE" {
 			// Create algo task instead of direct execution
 			if err := scheduler.CreateTask(o); err != nil {
 				sym := ledger.FullSymbol(o.Symbol, o.Market)
@@ -129,18 +248,36 @@ func ProcessLedgerWithScheduler(ctx context.Context, tc *trade.TradeContext, roo
 
 		sym := ledger.FullSymbol(o.Symbol, o.Market)
 
-		if useMock {
-			orderID, price := ExecuteOrderMock(o)
-			AppendExecution(bcPath, o.IntentID, orderID, sym, o.Side, price, o.Qty)
-			log.Printf("mock execution: intent=%s -> %s", o.IntentID, orderID)
-		} else if tc != nil {
-			orderID, err := ExecuteOrder(ctx, tc, o)
+		if b != nil {
+			if state.retryPending(root, o.IntentID, time.Now()) {
+				continue
+			}
+			recovered, err := placed.find(ctx, o)
 			if err != nil {
-				AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, err.Error())
+				log.Printf("order reconcile failed, retrying next cycle: intent=%s err=%v", o.IntentID, err)
+				continue
+			}
+			if recovered != nil {
+				state.submitted(root, o.IntentID)
+				recordRecovered(bcPath, b, o, recovered, meta)
+				log.Printf("order recovered: intent=%s -> %s (%s), not resubmitted", o.IntentID, recovered.OrderID, recovered.Status)
+				processed[o.IntentID] = true
+				executed++
+				continue
+			}
+
+			info, err := b.Submit(ctx, o)
+			if err != nil {
+				retry, errMeta := state.retryLater(root, o.IntentID, err, time.Now())
+				if retry {
+					continue
+				}
+				appendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, err.Error(), errMeta)
 				log.Printf("order rejected: intent=%s err=%v", o.IntentID, err)
 			} else {
-				AppendExecution(bcPath, o.IntentID, orderID, sym, o.Side, o.Price, o.Qty)
-				log.Printf("order submitted: intent=%s -> %s", o.IntentID, orderID)
+				state.submitted(root, o.IntentID)
+				recordSubmission(bcPath, b, o, info, meta)
+				log.Printf("order submitted: intent=%s -> %s (%s)", o.IntentID, info.OrderID, info.Status)
 			}
 		}
 
@@ -151,6 +288,92 @@ func ProcessLedgerWithScheduler(ctx context.Context, tc *trade.TradeContext, roo
 	return executed, nil
 }
 
+// preTradeCheck runs the risk gate on o. It returns false when the order was
+// rejected (a REJECTION has been appended); WARN mode only logs violations.
+func preTradeCheck(gate *riskgate.Gate, accountState *model.AccountState, bcPath string, o *model.ParsedOrder) bool {
+	if gate == nil || !gate.IsEnabled() || accountState == nil {
+		return true
+	}
+
+	result := gate.CheckOrder(o, accountState)
+	gate.UpdateStatus(result.Passed)
+
+	if !result.Passed {
+		// Record violation
+		if err := gate.RecordViolation(o, result); err != nil {
+			log.Printf("WARNING: failed to record violation: %v", err)
+		}
+
+		// Reject order based on mode
+		if !gate.ShouldWarnOnly() {
+			sym := ledger.FullSymbol(o.Symbol, o.Market)
+			reason := fmt.Sprintf("RISK_%s: %s", strings.ToUpper(result.Rule), result.Reason)
+			AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, reason)
+			log.Printf("order rejected by risk gate: intent=%s rule=%s", o.IntentID, result.Rule)
+			return false
+		}
+		log.Printf("WARNING: order violates risk rule but allowed in WARN mode: intent=%s rule=%s", o.IntentID, result.Rule)
+	}
+
+	// Increment order count for frequency tracking
+	if err := gate.IncrementOrderCount(); err != nil {
+		log.Printf("WARNING: failed to increment order count: %v", err)
+	}
+	return true
+}
+
+// WorkingOrders returns the orders the ledger still considers open: those
+// whose latest SUBMITTED/EXECUTION entry is SUBMITTED or PARTIAL_FILL.
+func WorkingOrders(entries []model.Entry) []OrderInfo {
+	latest := make(map[string]OrderInfo)
+	var order []string
+	for _, e := range entries {
+		if e.Type != "SUBMITTED" && e.Type != "EXECUTION" {
+			continue
+		}
+		id := e.Meta["order_id"]
+		if id == "" {
+			continue
+		}
+		info, seen := latest[id]
+		if !seen {
+			order = append(order, id)
+			info = OrderInfo{OrderID: id, FilledQty: "0"}
+		}
+		if e.Meta["status"] == StatusReplaced {
+			// An amendment keeps the order working under its original intent
+			if v := e.Meta["qty"]; v != "" {
+				info.Qty = v
+			}
+			latest[id] = info
+			continue
+		}
+		info.IntentID = e.Meta["intent_id"]
+		info.Symbol = e.Meta["symbol"]
+		info.Side = e.Meta["side"]
+		info.Status = e.Meta["status"]
+		if e.Type == "SUBMITTED" {
+			info.Qty = e.Meta["qty"]
+			info.GroupID = e.Meta["group_id"]
+		} else {
+			if v := e.Meta["filled_qty"]; v != "" {
+				info.FilledQty = v
+			}
+			info.AvgPrice = e.Meta["avg_price"]
+		}
+		latest[id] = info
+	}
+
+	var working []OrderInfo
+	for _, id := range order {
+		info := latest[id]
+		if info.Status == StatusSubmitted || info.Status == StatusPartialFill {
+			working = append(working, info)
+		}
+	}
+	return working
+}
+
 // loadAccountState loads the account state for risk checks
 func loadAccountState(root string) (*model.AccountState, error) {
 	statePath := filepath.Join(root, "account", "state.json")
@@ -171,6 +394,10 @@ func loadAccountState(root string) (*model.AccountState, error) {
 func ExecuteOrder(ctx context.Context, tc *trade.TradeContext, o model.ParsedOrder) (string, error) {
 	sym := ledger.FullSymbol(o.Symbol, o.Market)
 
+	// Last line of defence for callers that bypass the ledger
+	if err := ledger.ValidateOrder(o); err != nil {
+		return "", err
+	}
 	qty, err := strconv.ParseUint(o.Qty, 10, 64)
 	if err != nil {
 		return "", fmt.Errorf("invalid qty %q: %w", o.Qty, err)
@@ -182,7 +409,14 @@ func ExecuteOrder(ctx context.Context, tc *trade.TradeContext, o model.ParsedOrd
 		Side:              MapOrderSide(o.Side),
 		SubmittedQuantity: qty,
 		TimeInForce:       MapTimeInForce(o.TIF),
-		Remark:            "longbridge-fs:" + o.IntentID,
+		Remark:            orderRemark(o),
+	}
+	if o.ExpireDate != "" {
+		d, err := time.ParseInLocation("2006-01-02", o.ExpireDate, time.Local)
+		if err != nil {
+			return "", fmt.Errorf("invalid expire_date %q: %w", o.ExpireDate, err)
+		}
+		req.ExpireDate = &d
 	}
 
 	if o.Price != "" {
@@ -191,6 +425,30 @@ func ExecuteOrder(ctx context.Context, tc *trade.TradeContext, o model.ParsedOrd
 			req.SubmittedPrice = p
 		}
 	}
+	if o.TriggerPrice != "" {
+		p, err := decimal.NewFromString(o.TriggerPrice)
+		if err == nil {
+			req.TriggerPrice = p
+		}
+	}
+	if o.TrailingAmount != "" {
+		p, err := decimal.NewFromString(o.TrailingAmount)
+		if err == nil {
+			req.TrailingAmount = p
+		}
+	}
+	if o.TrailingPercent != "" {
+		p, err := decimal.NewFromString(o.TrailingPercent)
+		if err == nil {
+			req.TrailingPercent = p
+		}
+	}
+	if o.LimitOffset != "" {
+		p, err := decimal.NewFromString(o.LimitOffset)
+		if err == nil {
+			req.LimitOffset = p
+		}
+	}
 
 	orderID, err := tc.SubmitOrder(ctx, req)
 	if err != nil {
@@ -214,15 +472,83 @@ func AppendExecution(bcPath, intentID, orderID, symbol, side, price, qty string)
 	AppendExecutionWithMeta(bcPath, intentID, orderID, symbol, side, price, qty, nil)
 }
 
-// AppendExecutionWithMeta appends an EXECUTION entry with additional metadata
+// AppendExecutionWithMeta appends a FILLED EXECUTION entry with additional metadata
 func AppendExecutionWithMeta(bcPath, intentID, orderID, symbol, side, price, qty string, meta map[string]string) {
-	f, err := os.OpenFile(bcPath, os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Printf("append execution failed: %v", err)
+	appendExecution(bcPath, StatusFilled, intentID, orderID, symbol, side, price, qty, meta)
+}
+
+// AppendOrderEvent appends an EXECUTION entry describing a broker order
+// event. qty/price are those of this event; filled_qty/avg_price/fee carry
+// the order's cumulative state. Venue rejections become REJECTION entries.
+func AppendOrderEvent(bcPath string, ev OrderEvent) {
+	if ev.Order.Status == StatusRejected {
+		reason := "EXCHANGE_REJECTED"
+		if ev.Order.Msg != "" {
+			reason += ": " + ev.Order.Msg
+		}
+		AppendRejection(bcPath, ev.Order.IntentID, ev.Order.Symbol, ev.Order.Side, ev.Order.Qty, reason)
 		return
 	}
-	defer f.Close()
+	appendExecution(bcPath, ev.Order.Status, ev.Order.IntentID, ev.Order.OrderID, ev.Order.Symbol, ev.Order.Side,
+		ev.FillPrice, ev.FillQty, map[string]string{
+			"filled_qty": ev.Order.FilledQty,
+			"avg_price":  ev.Order.AvgPrice,
+			"fee":        ev.Fee,
+			"total_fees": ev.Order.Fees,
+			"group_id":   ev.Order.GroupID,
+		})
+}
 
+// AppendSubmitted appends a SUBMITTED entry: the venue accepted the order
+// but nothing has filled yet. Fills follow as EXECUTION entries.
+func AppendSubmitted(bcPath, intentID, orderID, symbol, side, qty string, meta map[string]string) {
+	date := time.Now().Format("2006-01-02")
+	desc := fmt.Sprintf("%s %s", side, symbol)
+	if meta != nil && meta["slice"] != "" && meta["algo"] != "" {
+		desc = fmt.Sprintf("%s slice %s %s %s", meta["algo"], meta["slice"], side, symbol)
+	}
+	text := fmt.Sprintf("\n%s * \"SUBMITTED\" \"%s\"\n", date, desc)
+	text += fmt.Sprintf("  ; intent_id: %s\n", intentID)
+	text += fmt.Sprintf("  ; order_id: %s\n", orderID)
+	text += fmt.Sprintf("  ; status: %s\n", StatusSubmitted)
+	text += fmt.Sprintf("  ; symbol: %s\n", symbol)
+	text += fmt.Sprintf("  ; side: %s\n", side)
+	text += fmt.Sprintf("  ; qty: %s\n", qty)
+	text += fmt.Sprintf("  ; submitted_at: %s\n", time.Now().Format(time.RFC3339))
+	text += formatMeta(meta)
+	text += "\n"
+	if err := ledger.Append(bcPath, text); err != nil {
+		log.Printf("append submitted failed: %v", err)
+	}
+}
+
+// recordSubmission journals the result of a successful Submit. Brokers that
+// report fills asynchronously (EventSource) get a SUBMITTED entry unless the
+// order already traded; others are assumed filled on acceptance.
+func recordSubmission(bcPath string, b Broker, o model.ParsedOrder, info *OrderInfo, meta map[string]string) {
+	sym := ledger.FullSymbol(o.Symbol, o.Market)
+	_, async := b.(EventSource)
+
+	switch {
+	case !async:
+		appendExecution(bcPath, StatusFilled, o.IntentID, info.OrderID, sym, o.Side, info.Price, o.Qty, meta)
+	case info.Status == StatusFilled || info.Status == StatusPartialFill:
+		m := map[string]string{
+			"filled_qty": info.FilledQty,
+			"avg_price":  info.AvgPrice,
+			"fee":        info.Fees,
+			"total_fees": info.Fees,
+		}
+		for k, v := range meta {
+			m[k] = v
+		}
+		appendExecution(bcPath, info.Status, o.IntentID, info.OrderID, sym, o.Side, info.AvgPrice, info.FilledQty, m)
+	default:
+		AppendSubmitted(bcPath, o.IntentID, info.OrderID, sym, o.Side, o.Qty, meta)
+	}
+}
+
+func appendExecution(bcPath, status, intentID, orderID, symbol, side, price, qty string, meta map[string]string) {
 	date := time.Now().Format("2006-01-02")
 	executedAt := time.Now().Format(time.RFC3339)
 
@@ -235,7 +561,7 @@ func AppendExecutionWithMeta(bcPath, intentID, orderID, symbol, side, price, qty
 	text := fmt.Sprintf("\n%s * \"EXECUTION\" \"%s\"\n", date, desc)
 	text += fmt.Sprintf("  ; intent_id: %s\n", intentID)
 	text += fmt.Sprintf("  ; order_id: %s\n", orderID)
-	text += fmt.Sprintf("  ; status: FILLED\n")
+	text += fmt.Sprintf("  ; status: %s\n", status)
 	text += fmt.Sprintf("  ; symbol: %s\n", symbol)
 	text += fmt.Sprintf("  ; side: %s\n", side)
 	text += fmt.Sprintf("  ; qty: %s\n", qty)
@@ -245,27 +571,51 @@ func AppendExecutionWithMeta(bcPath, intentID, orderID, symbol, side, price, qty
 	text += fmt.Sprintf("  ; executed_at: %s\n", executedAt)
 
 	// Add additional metadata
-	if meta != nil {
-		for k, v := range meta {
-			if k != "" && v != "" {
-				text += fmt.Sprintf("  ; %s: %s\n", k, v)
-			}
-		}
+	text += formatMeta(meta)
+
+	// Double-entry postings for the quantity this entry filled
+	postings := ""
+	if status != StatusReplaced && status != StatusSubmitted {
+		postings = ledger.Postings(symbol, side, qty, price, meta["fee"])
 	}
+	text += postings
 
 	text += "\n"
-	f.WriteString(text)
+	if err := ledger.Append(bcPath, text); err != nil {
+		log.Printf("append execution failed: %v", err)
+		return
+	}
+
+	if postings != "" {
+		if err := ledger.EnsureAccounts(filepath.Dir(bcPath), symbol); err != nil {
+			log.Printf("write %s failed: %v", ledger.AccountsFile, err)
+		}
+	}
+}
+
+// formatMeta renders extra meta lines in a stable key order, skipping empties.
+func formatMeta(meta map[string]string) string {
+	keys := make([]string, 0, len(meta))
+	for k, v := range meta {
+		if k != "" && v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var text string
+	for _, k := range keys {
+		text += fmt.Sprintf("  ; %s: %s\n", k, meta[k])
+	}
+	return text
 }
 
 // AppendRejection appends a REJECTION entry to the beancount ledger.
 func AppendRejection(bcPath, intentID, symbol, side, qty, reason string) {
-	f, err := os.OpenFile(bcPath, os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Printf("append rejection failed: %v", err)
-		return
-	}
-	defer f.Close()
+	appendRejection(bcPath, intentID, symbol, side, qty, reason, nil)
+}
 
+func appendRejection(bcPath, intentID, symbol, side, qty, reason string, meta map[string]string) {
 	date := time.Now().Format("2006-01-02")
 	text := fmt.Sprintf("\n%s * \"REJECTION\" \"%s %s\"\n", date, side, symbol)
 	text += fmt.Sprintf("  ; intent_id: %s\n", intentID)
@@ -274,11 +624,15 @@ func AppendRejection(bcPath, intentID, symbol, side, qty, reason string) {
 	text += fmt.Sprintf("  ; symbol: %s\n", symbol)
 	text += fmt.Sprintf("  ; side: %s\n", side)
 	text += fmt.Sprintf("  ; qty: %s\n", qty)
+	text += formatMeta(meta)
 	text += "\n"
-	f.WriteString(text)
+	if err := ledger.Append(bcPath, text); err != nil {
+		log.Printf("append rejection failed: %v", err)
+	}
 }
 
-// MapOrderType converts string to SDK OrderType.
+// MapOrderType converts string to SDK OrderType. Unknown types are passed
+// through unchanged so the venue rejects them instead of trading at market.
 func MapOrderType(s string) trade.OrderType {
 	switch strings.ToUpper(s) {
 	case "LIMIT", "LO":
@@ -289,33 +643,45 @@ func MapOrderType(s string) trade.OrderType {
 		return trade.OrderType("ELO")
 	case "ALO":
 		return trade.OrderType("ALO")
-	default:
+	case "LIT":
+		return trade.OrderType("LIT")
+	case "MIT":
+		return trade.OrderType("MIT")
+	case "TSLPAMT":
+		return trade.OrderType("TSLPAMT")
+	case "TSLPPCT":
+		return trade.OrderType("TSLPPCT")
+	case "":
 		return trade.OrderType("MO")
+	default:
+		return trade.OrderType(strings.ToUpper(s))
 	}
 }
 
-// MapOrderSide converts string to SDK OrderSide.
+// MapOrderSide converts string to SDK OrderSide. Unknown sides are passed
+// through unchanged so the venue rejects them instead of buying.
 func MapOrderSide(s string) trade.OrderSide {
 	switch strings.ToUpper(s) {
 	case "BUY":
-		return trade.OrderSide("Buy")
+		return trade.OrderSideBuy
 	case "SELL":
-		return trade.OrderSide("Sell")
+		return trade.OrderSideSell
 	default:
-		return trade.OrderSide("Buy")
+		return trade.OrderSide(s)
 	}
 }
 
-// MapTimeInForce converts string to SDK TimeType.
+// MapTimeInForce converts string to SDK TimeType. An empty value means DAY;
+// unknown values are passed through unchanged so the venue rejects them.
 func MapTimeInForce(s string) trade.TimeType {
 	switch strings.ToUpper(s) {
-	case "DAY":
-		return trade.TimeType("Day")
+	case "DAY", "":
+		return trade.TimeTypeDay
 	case "GTC":
-		return trade.TimeType("GoodTilCanceled")
+		return trade.TimeTypeGTC
 	case "GTD":
-		return trade.TimeType("GoodTilDate")
+		return trade.TimeTypeGTD
 	default:
-		return trade.TimeType("Day")
+		return trade.TimeType(s)
 	}
 }
@@ -0,0 +1,208 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/risk"
+)
+
+// newLedger writes ledgerText as the ledger of a fresh root and returns the
+// root and the ledger path.
+func newLedger(t *testing.T, ledgerText string) (root, bcPath string) {
+	t.Helper()
+	root = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "trade"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bcPath = filepath.Join(root, "trade", "beancount.txt")
+	if err := os.WriteFile(bcPath, []byte(ledgerText), 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	return root, bcPath
+}
+
+// processText writes ledger text under a fresh root, runs one ProcessLedger
+// pass against a mock broker and returns the resulting ledger.
+func processText(t *testing.T, ledgerText string) string {
+	t.Helper()
+	root, bcPath := newLedger(t, ledgerText)
+	if _, err := ProcessLedger(context.Background(), NewMockBroker(), root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	return string(data)
+}
+
+func TestConditionalOrdersValidated(t *testing.T) {
+	tests := []struct {
+		name   string
+		meta   string
+		reason string // empty: expect an EXECUTION
+	}{
+		{"unknown type", "  ; type: STOP\n", "INVALID_ORDER: unsupported order type \"STOP\""},
+		{"MIT without trigger", "  ; type: MIT\n", "INVALID_ORDER: trigger_price is required"},
+		{"TSLPPCT without offset", "  ; type: TSLPPCT\n  ; trailing_percent: 2\n", "INVALID_ORDER: limit_offset is required"},
+		{"valid MIT", "  ; type: MIT\n  ; trigger_price: 170\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := processText(t, "\n2026-01-01 * \"ORDER\" \"SELL AAPL\"\n"+
+				"  ; intent_id: c-1\n  ; side: SELL\n  ; symbol: AAPL.US\n  ; qty: 10\n  ; tif: GTC\n"+tt.meta)
+			if tt.reason == "" {
+				if !strings.Contains(text, "\"EXECUTION\"") {
+					t.Fatalf("expected execution:\n%s", text)
+				}
+				return
+			}
+			if !strings.Contains(text, "reason: "+tt.reason) {
+				t.Fatalf("expected rejection %q:\n%s", tt.reason, text)
+			}
+		})
+	}
+}
+
+func TestOrderValidationRejectsInsteadOfDefaulting(t *testing.T) {
+	tests := []struct {
+		name   string
+		meta   string
+		reason string
+	}{
+		{"typo side", "  ; side: SEL\n  ; qty: 10\n", `unknown side "SEL" (want BUY or SELL)`},
+		{"missing qty", "  ; side: BUY\n", "qty is required"},
+		{"fractional qty", "  ; side: BUY\n  ; qty: 1.5\n", `qty must be a positive integer, got "1.5"`},
+		{"limit without price", "  ; side: BUY\n  ; qty: 10\n  ; type: LIMIT\n", "price is required"},
+		{"unknown tif", "  ; side: BUY\n  ; qty: 10\n  ; tif: GTX\n", `unknown tif "GTX" (want DAY, GTC or GTD)`},
+		{"gtd without expiry", "  ; side: BUY\n  ; qty: 10\n  ; tif: GTD\n", "expire_date is required for GTD orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := processText(t, "\n2026-01-01 * \"ORDER\" \"AAPL\"\n  ; intent_id: v-1\n  ; symbol: AAPL.US\n"+tt.meta)
+			if !strings.Contains(text, "reason: INVALID_ORDER: "+tt.reason+"\n") {
+				t.Fatalf("expected rejection %q:\n%s", tt.reason, text)
+			}
+			if strings.Contains(text, "\"EXECUTION\"") {
+				t.Fatalf("invalid order was executed:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestExecutionPostingsAndAccounts(t *testing.T) {
+	ledgerText := `
+2026-01-01 * "ORDER" "BUY AAPL"
+  ; intent_id: pb-1
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qty: 100
+  ; type: LIMIT
+  ; price: 180.50
+  ; tif: DAY
+
+2026-01-01 * "ORDER" "SELL AAPL"
+  ; intent_id: pb-2
+  ; side: SELL
+  ; symbol: AAPL.US
+  ; qty: 40
+  ; type: LIMIT
+  ; price: 190
+  ; tif: DAY
+
+2026-01-01 * "ORDER" "BUY 700.HK"
+  ; intent_id: pb-3
+  ; side: BUY
+  ; symbol: 700.HK
+  ; qty: 200
+  ; type: LIMIT
+  ; price: 300.2
+  ; tif: DAY
+`
+	root, bcPath := newLedger(t, ledgerText)
+	if _, err := ProcessLedger(context.Background(), NewMockBroker(), root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"  Assets:Broker:US:AAPL  100 AAPL {180.5 USD}\n  Assets:Broker:US:Cash  -18050 USD\n",
+		"  Assets:Broker:US:AAPL  -40 AAPL {} @ 190 USD\n  Assets:Broker:US:Cash  7600 USD\n  Income:Broker:US:PnL\n",
+		"  Assets:Broker:HK:HK700  200 HK700 {300.2 HKD}\n  Assets:Broker:HK:Cash  -60040 HKD\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected postings %q in ledger:\n%s", want, text)
+		}
+	}
+
+	data, err = os.ReadFile(filepath.Join(root, "trade", "accounts.beancount"))
+	if err != nil {
+		t.Fatalf("read accounts.beancount: %v", err)
+	}
+	accounts := string(data)
+	for _, want := range []string{
+		"1970-01-01 commodity AAPL\n",
+		"1970-01-01 commodity HK700\n",
+		"1970-01-01 open Assets:Broker:US:AAPL AAPL \"FIFO\"\n",
+		"1970-01-01 open Assets:Broker:HK:Cash HKD\n",
+		"1970-01-01 open Income:Broker:US:PnL USD\n",
+		"include \"beancount.txt\"\n",
+	} {
+		if !strings.Contains(accounts, want) {
+			t.Errorf("expected %q in accounts.beancount:\n%s", want, accounts)
+		}
+	}
+}
+
+func TestRiskTriggerOrdersExecute(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"trade/beancount.txt":              "; beancount append-only trade ledger\n",
+		"trade/risk_control.json":          `{"AAPL.US": {"stop_loss": 150}, "MSFT.US": {"stop_loss": 300, "qty": "ALL"}}`,
+		"quote/hold/AAPL.US/overview.json": `{"symbol": "AAPL.US", "last": 149.5}`,
+		"quote/hold/MSFT.US/overview.json": `{"symbol": "MSFT.US", "last": 299}`,
+		"account/state.json":               `{"positions": [{"symbol": "AAPL.US", "quantity": "120", "available": "100"}]}`,
+	}
+	for name, text := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	if err := risk.CheckRiskRules(root, root); err != nil {
+		t.Fatalf("CheckRiskRules: %v", err)
+	}
+	bcPath := filepath.Join(root, "trade", "beancount.txt")
+	data, _ := os.ReadFile(bcPath)
+	if diags := ledger.Lint(string(data)); len(diags) != 0 {
+		t.Errorf("risk ORDER does not lint clean: %+v\n%s", diags, data)
+	}
+	if n, err := ProcessLedger(context.Background(), NewMockBroker(), root); err != nil || n != 1 {
+		t.Fatalf("ProcessLedger = %d, %v; want the AAPL stop-loss executed", n, err)
+	}
+
+	history, _ := ledger.LoadHistory(root)
+	fills := ledger.Query(history, ledger.QueryFilter{Types: []string{"EXECUTION"}, Source: "risk_trigger"})
+	if len(fills) != 1 || fills[0].Meta["symbol"] != "AAPL.US" || fills[0].Meta["side"] != "SELL" || fills[0].Meta["qty"] != "100" {
+		t.Fatalf("expected a risk_trigger SELL of the 100 available AAPL, got %+v", fills)
+	}
+
+	// MSFT has no position to close: the rule stays for a later cycle
+	rules, _ := os.ReadFile(filepath.Join(root, "trade", "risk_control.json"))
+	if strings.Contains(string(rules), "AAPL.US") || !strings.Contains(string(rules), "MSFT.US") {
+		t.Errorf("expected only the executed rule removed, got %s", rules)
+	}
+}
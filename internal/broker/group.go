@@ -0,0 +1,386 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/model"
+	"longbridge-fs/internal/riskgate"
+)
+
+// Legs of a BRACKET/OCO order group. Each leg is journaled under its own
+// intent_id ({parent}-entry, {parent}-tp, {parent}-sl) with group_id,
+// parent_id and leg meta on its first entry.
+const (
+	LegEntry      = "ENTRY"
+	LegTakeProfit = "TAKE_PROFIT"
+	LegStopLoss   = "STOP_LOSS"
+)
+
+var legSuffix = map[string]string{
+	LegEntry:      "-entry",
+	LegTakeProfit: "-tp",
+	LegStopLoss:   "-sl",
+}
+
+// cancelRetryInterval limits how often a sibling cancel is re-sent while the
+// venue has not yet confirmed it.
+const cancelRetryInterval = 30 * time.Second
+
+var (
+	cancelMu       sync.Mutex
+	pendingCancels = make(map[string]time.Time) // order_id -> last request
+)
+
+// groupLeg is the journaled state of one leg of an order group.
+type groupLeg struct {
+	IntentID string
+	OrderID  string
+	Symbol   string
+	Side     string
+	Status   string
+	Qty      int64
+	Filled   int64
+}
+
+func (l *groupLeg) working() bool {
+	return l.Status == StatusSubmitted || l.Status == StatusPartialFill
+}
+
+// IsGroupOrder reports whether an ORDER type declares an order group.
+func IsGroupOrder(orderType string) bool {
+	return orderType == "BRACKET" || orderType == "OCO"
+}
+
+// submitGroup handles a new BRACKET or OCO ORDER entry. A BRACKET submits
+// its entry leg only; the exit legs follow once it has filled (see
+// advanceGroups). An OCO submits both exit legs at once.
+func submitGroup(ctx context.Context, b Broker, bcPath string, o model.ParsedOrder, gate *riskgate.Gate, accountState *model.AccountState) {
+	sym := ledger.FullSymbol(o.Symbol, o.Market)
+	if err := validateGroup(o); err != nil {
+		AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, fmt.Sprintf("INVALID_%s: %v", o.OrderType, err))
+		log.Printf("order group rejected: intent=%s err=%v", o.IntentID, err)
+		return
+	}
+
+	// The group passes the risk gate once, priced at its entry (BRACKET)
+	// or take-profit (OCO) leg.
+	check := o
+	if o.OrderType == "BRACKET" {
+		check.OrderType = groupLegOrder(o, LegEntry, o.Qty).OrderType
+	} else {
+		check.OrderType = "LIMIT"
+		check.Price = o.TakeProfit
+	}
+	if !preTradeCheck(gate, accountState, bcPath, &check) {
+		return
+	}
+	if b == nil {
+		return
+	}
+
+	if o.OrderType == "BRACKET" {
+		submitGroupLeg(ctx, b, bcPath, o, LegEntry, o.Qty)
+	} else {
+		submitGroupLeg(ctx, b, bcPath, o, LegTakeProfit, o.Qty)
+		submitGroupLeg(ctx, b, bcPath, o, LegStopLoss, o.Qty)
+	}
+	log.Printf("order group submitted: intent=%s type=%s group=%s", o.IntentID, o.OrderType, o.GroupID)
+}
+
+// validateGroup checks that the exit prices of a group are usable and lie on
+// the correct side of each other (and of the entry limit, if any).
+func validateGroup(o model.ParsedOrder) error {
+	if o.Side != "BUY" && o.Side != "SELL" {
+		return fmt.Errorf("side must be BUY or SELL, got %q", o.Side)
+	}
+	if n, err := strconv.ParseInt(o.Qty, 10, 64); err != nil || n <= 0 {
+		return fmt.Errorf("qty must be a positive integer, got %q", o.Qty)
+	}
+
+	tp, err := strconv.ParseFloat(o.TakeProfit, 64)
+	if err != nil || tp <= 0 {
+		return fmt.Errorf("take_profit must be a positive price, got %q", o.TakeProfit)
+	}
+	sl, err := strconv.ParseFloat(o.StopLoss, 64)
+	if err != nil || sl <= 0 {
+		return fmt.Errorf("stop_loss must be a positive price, got %q", o.StopLoss)
+	}
+	if o.StopLimit != "" {
+		if p, err := strconv.ParseFloat(o.StopLimit, 64); err != nil || p <= 0 {
+			return fmt.Errorf("stop_limit must be a positive price, got %q", o.StopLimit)
+		}
+	}
+
+	switch o.ExitTIF {
+	case "DAY", "GTC":
+	case "GTD":
+		if o.ExpireDate == "" {
+			return fmt.Errorf("expire_date is required for GTD exit legs")
+		}
+	default:
+		return fmt.Errorf("unknown exit_tif %q (want DAY, GTC or GTD)", o.ExitTIF)
+	}
+
+	// Exits that SELL protect a long: stop below target. BUY exits the reverse.
+	sellExit := groupExitSide(o) == "SELL"
+	if sellExit && sl >= tp || !sellExit && sl <= tp {
+		return fmt.Errorf("stop_loss %s and take_profit %s are on the wrong sides", o.StopLoss, o.TakeProfit)
+	}
+
+	if o.OrderType == "BRACKET" && o.Price != "" {
+		entry, err := strconv.ParseFloat(o.Price, 64)
+		if err != nil || entry <= 0 {
+			return fmt.Errorf("price must be a positive number, got %q", o.Price)
+		}
+		if sellExit && (entry <= sl || entry >= tp) || !sellExit && (entry >= sl || entry <= tp) {
+			return fmt.Errorf("entry price %s must lie between stop_loss and take_profit", o.Price)
+		}
+	}
+	return nil
+}
+
+// groupExitSide is the side of the take-profit and stop-loss legs: the
+// opposite of the entry for a BRACKET, the declared side for an OCO.
+func groupExitSide(o model.ParsedOrder) string {
+	if o.OrderType == "OCO" {
+		return o.Side
+	}
+	if o.Side == "BUY" {
+		return "SELL"
+	}
+	return "BUY"
+}
+
+// groupLegOrder builds the order submitted for one leg of group o.
+func groupLegOrder(o model.ParsedOrder, leg, qty string) model.ParsedOrder {
+	lo := o
+	lo.IntentID = o.IntentID + legSuffix[leg]
+	lo.Qty = qty
+	lo.TriggerPrice = ""
+	lo.TrailingAmount = ""
+	lo.TrailingPercent = ""
+	lo.LimitOffset = ""
+
+	switch leg {
+	case LegEntry:
+		lo.OrderType = "MARKET"
+		if o.Price != "" {
+			lo.OrderType = "LIMIT"
+		}
+	case LegTakeProfit:
+		lo.Side = groupExitSide(o)
+		lo.OrderType = "LIMIT"
+		lo.Price = o.TakeProfit
+		lo.TIF = o.ExitTIF
+	case LegStopLoss:
+		lo.Side = groupExitSide(o)
+		lo.OrderType = "MIT"
+		lo.Price = ""
+		lo.TriggerPrice = o.StopLoss
+		if o.StopLimit != "" {
+			lo.OrderType = "LIT"
+			lo.Price = o.StopLimit
+		}
+		lo.TIF = o.ExitTIF
+	}
+	return lo
+}
+
+// submitGroupLeg submits one leg and journals it with its group metadata.
+func submitGroupLeg(ctx context.Context, b Broker, bcPath string, o model.ParsedOrder, leg, qty string) {
+	lo := groupLegOrder(o, leg, qty)
+	meta := map[string]string{
+		"group_id":  o.GroupID,
+		"parent_id": o.IntentID,
+		"leg":       leg,
+	}
+
+	info, err := b.Submit(ctx, lo)
+	if err != nil {
+		appendRejection(bcPath, lo.IntentID, ledger.FullSymbol(lo.Symbol, lo.Market), lo.Side, lo.Qty, err.Error(), meta)
+		log.Printf("group leg rejected: intent=%s leg=%s err=%v", lo.IntentID, leg, err)
+		return
+	}
+	info.GroupID = o.GroupID
+	recordSubmission(bcPath, b, lo, info, meta)
+	log.Printf("group leg submitted: intent=%s leg=%s -> %s (%s)", lo.IntentID, leg, info.OrderID, info.Status)
+}
+
+// advanceGroups moves every open order group forward from its journaled
+// state: it submits the exit legs of a BRACKET whose entry has filled, and
+// once one exit leg trades it shrinks (partial fill) or cancels (full fill)
+// the other.
+func advanceGroups(ctx context.Context, b Broker, bcPath string, entries []model.Entry) {
+	parents := make(map[string]model.ParsedOrder)
+	var order []string
+	for _, e := range entries {
+		if e.Type != "ORDER" {
+			continue
+		}
+		if o, _ := ledger.OrderFromEntry(e); IsGroupOrder(o.OrderType) && o.IntentID != "" {
+			parents[o.IntentID] = o
+			order = append(order, o.IntentID)
+		}
+	}
+	if len(parents) == 0 {
+		return
+	}
+
+	groups := groupLegs(entries)
+	for _, id := range order {
+		legs := groups[id]
+		if len(legs) == 0 {
+			continue // not submitted yet, or rejected as a whole
+		}
+		o := parents[id]
+
+		if o.OrderType == "BRACKET" {
+			entry := legs[LegEntry]
+			if entry == nil {
+				continue
+			}
+			// Exits follow once the entry is done trading
+			if entry.Filled > 0 && ledger.IsTerminalStatus(entry.Status) {
+				qty := strconv.FormatInt(entry.Filled, 10)
+				for _, leg := range []string{LegTakeProfit, LegStopLoss} {
+					if legs[leg] == nil {
+						submitGroupLeg(ctx, b, bcPath, o, leg, qty)
+					}
+				}
+			}
+		}
+
+		tp, sl := legs[LegTakeProfit], legs[LegStopLoss]
+		if tp == nil || sl == nil {
+			continue
+		}
+		balanceExitLegs(ctx, b, bcPath, o, tp, sl, LegStopLoss)
+		balanceExitLegs(ctx, b, bcPath, o, sl, tp, LegTakeProfit)
+	}
+}
+
+// balanceExitLegs keeps sibling within what leg has left to close: a full
+// fill cancels it, a partial fill shrinks it to leg's remaining quantity.
+// siblingLeg names the sibling's leg, whose prices the resize resends.
+func balanceExitLegs(ctx context.Context, b Broker, bcPath string, o model.ParsedOrder, leg, sibling *groupLeg, siblingLeg string) {
+	if leg.Filled == 0 || !sibling.working() {
+		return
+	}
+
+	if leg.Status == StatusFilled || leg.Filled >= leg.Qty {
+		cancelGroupLeg(ctx, b, bcPath, o, sibling)
+		return
+	}
+
+	remaining := leg.Qty - leg.Filled
+	if sibling.Filled > 0 || sibling.Qty == remaining {
+		return
+	}
+	qty := strconv.FormatInt(remaining, 10)
+	lo := groupLegOrder(o, siblingLeg, qty)
+	req := ReplaceRequest{
+		OrderID:      sibling.OrderID,
+		Qty:          qty,
+		Price:        lo.Price,
+		TriggerPrice: lo.TriggerPrice,
+		LimitOffset:  lo.LimitOffset,
+		Remark:       orderRemark(lo),
+	}
+	if err := b.Replace(ctx, req); err != nil {
+		log.Printf("group leg resize failed: intent=%s order_id=%s err=%v", sibling.IntentID, sibling.OrderID, err)
+		return
+	}
+	appendExecution(bcPath, StatusReplaced, sibling.IntentID, sibling.OrderID, sibling.Symbol, sibling.Side, lo.Price, qty, map[string]string{
+		"group_id":      o.GroupID,
+		"trigger_price": lo.TriggerPrice,
+	})
+	log.Printf("group leg resized: intent=%s order_id=%s qty=%s", sibling.IntentID, sibling.OrderID, qty)
+}
+
+// cancelGroupLeg cancels a sibling leg. Brokers that report changes
+// asynchronously journal the CANCELLED execution themselves; for the others
+// it is written here.
+func cancelGroupLeg(ctx context.Context, b Broker, bcPath string, o model.ParsedOrder, leg *groupLeg) {
+	cancelMu.Lock()
+	last, pending := pendingCancels[leg.OrderID]
+	if pending && time.Since(last) < cancelRetryInterval {
+		cancelMu.Unlock()
+		return
+	}
+	pendingCancels[leg.OrderID] = time.Now()
+	cancelMu.Unlock()
+
+	if err := b.Cancel(ctx, leg.OrderID); err != nil {
+		log.Printf("group leg cancel failed: intent=%s order_id=%s err=%v", leg.IntentID, leg.OrderID, err)
+		return
+	}
+	if _, async := b.(EventSource); !async {
+		appendExecution(bcPath, StatusCancelled, leg.IntentID, leg.OrderID, leg.Symbol, leg.Side, "", "0", map[string]string{
+			"group_id":   o.GroupID,
+			"filled_qty": strconv.FormatInt(leg.Filled, 10),
+		})
+	}
+	log.Printf("group leg cancelled: intent=%s order_id=%s (sibling filled)", leg.IntentID, leg.OrderID)
+}
+
+// groupLegs rebuilds the legs of every order group from the ledger, keyed by
+// parent intent_id and leg name.
+func groupLegs(entries []model.Entry) map[string]map[string]*groupLeg {
+	groups := make(map[string]map[string]*groupLeg)
+	byIntent := make(map[string]*groupLeg)
+
+	for _, e := range entries {
+		if e.Type != "SUBMITTED" && e.Type != "EXECUTION" && e.Type != "REJECTION" || ledger.IsDuplicateRejection(e) {
+			continue
+		}
+		id := e.Meta["intent_id"]
+		l := byIntent[id]
+		if l == nil {
+			parent := e.Meta["parent_id"]
+			if parent == "" {
+				continue
+			}
+			l = &groupLeg{IntentID: id, Symbol: e.Meta["symbol"], Side: e.Meta["side"]}
+			byIntent[id] = l
+			if groups[parent] == nil {
+				groups[parent] = make(map[string]*groupLeg)
+			}
+			groups[parent][strings.ToUpper(e.Meta["leg"])] = l
+		}
+
+		qty, _ := strconv.ParseInt(e.Meta["qty"], 10, 64)
+		switch e.Type {
+		case "SUBMITTED":
+			l.OrderID = e.Meta["order_id"]
+			l.Status = StatusSubmitted
+			l.Qty = qty
+		case "REJECTION":
+			l.Status = StatusRejected
+		case "EXECUTION":
+			status := e.Meta["status"]
+			if status == StatusReplaced {
+				l.Qty = qty
+				continue
+			}
+			l.OrderID = e.Meta["order_id"]
+			l.Status = status
+			if l.Qty == 0 {
+				// Filled on submission, no SUBMITTED entry
+				l.Qty = qty
+			}
+			if v := e.Meta["filled_qty"]; v != "" {
+				l.Filled, _ = strconv.ParseInt(v, 10, 64)
+			} else if status == StatusFilled || status == "" {
+				l.Filled = l.Qty
+			}
+		}
+	}
+	return groups
+}
@@ -0,0 +1,137 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/model"
+)
+
+func TestBracketSubmitsExitsAfterFillAndCancelsSibling(t *testing.T) {
+	root, bcPath := newLedger(t, "")
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":100.00,"updated_at":"t1"}`, "")
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+
+	ledgerText := `
+2026-01-01 * "ORDER" "BRACKET BUY AAPL"
+  ; intent_id: g-1
+  ; type: BRACKET
+  ; side: BUY
+  ; symbol: AAPL
+  ; market: US
+  ; qty: 50
+  ; price: 100.00
+  ; take_profit: 110.00
+  ; stop_loss: 95.00
+`
+	if err := os.WriteFile(bcPath, []byte(ledgerText), 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+
+	ctx := context.Background()
+	run := func() string {
+		t.Helper()
+		if _, err := ProcessLedger(ctx, b, root); err != nil {
+			t.Fatalf("ProcessLedger: %v", err)
+		}
+		data, _ := os.ReadFile(bcPath)
+		return string(data)
+	}
+
+	// Entry fills at once; exits are submitted on the next pass
+	text := run()
+	if !strings.Contains(text, "intent_id: g-1-entry") || strings.Contains(text, "g-1-tp") {
+		t.Fatalf("expected only the entry leg after first pass:\n%s", text)
+	}
+	text = run()
+	if !strings.Contains(text, "intent_id: g-1-tp") || !strings.Contains(text, "intent_id: g-1-sl") {
+		t.Fatalf("expected both exit legs after entry fill:\n%s", text)
+	}
+
+	// Price reaches the target: take-profit fills, stop-loss is cancelled
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":111.00,"updated_at":"t2"}`, "")
+	run()
+	text = run()
+	if !strings.Contains(text, "status: CANCELLED") {
+		t.Fatalf("expected stop-loss leg cancelled:\n%s", text)
+	}
+
+	entries, err := ledger.ParseEntries(bcPath)
+	if err != nil {
+		t.Fatalf("ParseEntries: %v", err)
+	}
+	legs := groupLegs(entries)["g-1"]
+	if legs[LegTakeProfit].Status != StatusFilled || legs[LegStopLoss].Status != StatusCancelled {
+		t.Fatalf("unexpected leg states tp=%+v sl=%+v", legs[LegTakeProfit], legs[LegStopLoss])
+	}
+
+	// The finished group compacts as a unit
+	if err := ledger.CompactBlocks(root, 1); err != nil {
+		t.Fatalf("CompactBlocks: %v", err)
+	}
+	data, _ := os.ReadFile(bcPath)
+	if strings.Contains(string(data), "g-1") {
+		t.Fatalf("expected group compacted out of the ledger:\n%s", data)
+	}
+}
+
+func TestExitLegResizeKeepsPrices(t *testing.T) {
+	root, bcPath := newLedger(t, "")
+	pb, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b := &replaceRecorder{PaperBroker: pb}
+	o := model.ParsedOrder{IntentID: "g-3", GroupID: "g-3", OrderType: "BRACKET", Side: "BUY", Symbol: "AAPL", Market: "US",
+		TakeProfit: "110.00", StopLoss: "95.00", StopLimit: "94.50"}
+	tp := &groupLeg{IntentID: "g-3-tp", OrderID: "tp-1", Status: StatusPartialFill, Qty: 50, Filled: 20}
+	sl := &groupLeg{IntentID: "g-3-sl", OrderID: "sl-1", Status: StatusSubmitted, Qty: 50}
+
+	balanceExitLegs(context.Background(), b, bcPath, o, tp, sl, LegStopLoss)
+	if len(b.reqs) != 1 {
+		t.Fatalf("expected one resize, got %+v", b.reqs)
+	}
+	want := ReplaceRequest{OrderID: "sl-1", Qty: "30", Price: "94.50", TriggerPrice: "95.00", Remark: RemarkPrefix + "g-3-sl"}
+	if b.reqs[0] != want {
+		t.Fatalf("stop-loss resize sent %+v, want %+v", b.reqs[0], want)
+	}
+
+	b.reqs = nil
+	tp.Status, tp.Filled = StatusSubmitted, 0
+	sl.Status, sl.Filled = StatusPartialFill, 10
+	balanceExitLegs(context.Background(), b, bcPath, o, sl, tp, LegTakeProfit)
+	want = ReplaceRequest{OrderID: "tp-1", Qty: "40", Price: "110.00", Remark: RemarkPrefix + "g-3-tp"}
+	if len(b.reqs) != 1 || b.reqs[0] != want {
+		t.Fatalf("take-profit resize sent %+v, want %+v", b.reqs, want)
+	}
+}
+
+func TestValidateGroupRejectsInvertedExits(t *testing.T) {
+	ledgerText := `
+2026-01-01 * "ORDER" "OCO SELL AAPL"
+  ; intent_id: g-2
+  ; type: OCO
+  ; side: SELL
+  ; symbol: AAPL
+  ; market: US
+  ; qty: 50
+  ; take_profit: 90.00
+  ; stop_loss: 95.00
+`
+	root, bcPath := newLedger(t, ledgerText)
+	if _, err := ProcessLedger(context.Background(), NewMockBroker(), root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, _ := os.ReadFile(bcPath)
+	if !strings.Contains(string(data), "reason: INVALID_OCO") {
+		t.Fatalf("expected INVALID_OCO rejection:\n%s", data)
+	}
+}
@@ -0,0 +1,96 @@
+package broker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/market"
+	"longbridge-fs/internal/model"
+)
+
+// staticInfo reads the cached static.json of the order's symbol, nil if the
+// symbol has none (orders then go out as written).
+func staticInfo(root string, o model.ParsedOrder) *model.StaticInfo {
+	return market.ReadStatic(market.HoldDir(root, ledger.FullSymbol(o.Symbol, o.Market)))
+}
+
+// availableQty returns the available quantity of symbol in the account's
+// state.json, 0 if it holds none.
+func availableQty(root, symbol string) int64 {
+	state, err := loadAccountState(root)
+	if err != nil {
+		return 0
+	}
+	for _, p := range state.Positions {
+		if strings.EqualFold(p.Symbol, symbol) {
+			n, _ := strconv.ParseFloat(p.Available, 64)
+			return int64(n)
+		}
+	}
+	return 0
+}
+
+// lotSize returns the board lot of the order's symbol, 1 if unknown.
+func lotSize(info *model.StaticInfo) int64 {
+	if info == nil || info.LotSize <= 1 {
+		return 1
+	}
+	return info.LotSize
+}
+
+// normalizeOrder rounds o's quantity down to whole board lots and its prices
+// to valid ticks, never in the counterparty's favour: BUY prices round down,
+// SELL prices up, and the exit legs of a group the other way. A SELL that
+// leaves whole lots of the position at root behind keeps its odd lot, so
+// odd-lot holdings can be closed. note describes the adjustments, empty if
+// none. A quantity below one lot is an error. static.json is read under
+// quoteRoot.
+func normalizeOrder(root, quoteRoot string, o *model.ParsedOrder) (note string, err error) {
+	info := staticInfo(quoteRoot, *o)
+	if info == nil {
+		return "", nil
+	}
+	var notes []string
+
+	if qty, perr := strconv.ParseInt(o.Qty, 10, 64); perr == nil {
+		lq := market.LotQty(info, qty)
+		if lq != qty && o.Side == "SELL" {
+			if held := availableQty(root, ledger.FullSymbol(o.Symbol, o.Market)); qty <= held && (held-qty)%info.LotSize == 0 {
+				lq = qty
+			}
+		}
+		if lq <= 0 {
+			return "", fmt.Errorf("LOT_SIZE: qty %d is below the board lot of %d", qty, info.LotSize)
+		}
+		if lq != qty {
+			o.Qty = strconv.FormatInt(lq, 10)
+			notes = append(notes, fmt.Sprintf("qty %d->%d (lot %d)", qty, lq, info.LotSize))
+		}
+	}
+
+	sell := o.Side == "SELL"
+	for _, p := range []struct {
+		name string
+		v    *string
+		up   bool
+	}{
+		{"price", &o.Price, sell},
+		{"trigger_price", &o.TriggerPrice, sell},
+		{"take_profit", &o.TakeProfit, !sell},
+		{"stop_loss", &o.StopLoss, !sell},
+		{"stop_limit", &o.StopLimit, !sell},
+	} {
+		f, perr := strconv.ParseFloat(*p.v, 64)
+		if *p.v == "" || perr != nil {
+			continue
+		}
+		if t := market.TickPrice(info, f, p.up); t != f {
+			adj := formatFloat(t)
+			notes = append(notes, fmt.Sprintf("%s %s->%s", p.name, *p.v, adj))
+			*p.v = adj
+		}
+	}
+	return strings.Join(notes, ", "), nil
+}
@@ -0,0 +1,232 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"longbridge-fs/internal/model"
+)
+
+// writeHKStatic writes a static.json with a 500-share lot and the HK ladder.
+func writeHKStatic(t *testing.T, root, symbol string) {
+	t.Helper()
+	dir := filepath.Join(root, "quote", "hold", symbol)
+	for _, d := range []string{dir, filepath.Join(root, "trade")} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+	body := `{"symbol":"` + symbol + `","lot_size":500,"tick_sizes":[{"from":0,"tick":0.001},{"from":0.25,"tick":0.005},{"from":0.5,"tick":0.01},{"from":10,"tick":0.02},{"from":20,"tick":0.05}]}`
+	if err := os.WriteFile(filepath.Join(dir, "static.json"), []byte(body), 0644); err != nil {
+		t.Fatalf("write static: %v", err)
+	}
+}
+
+func TestNormalizeOrderLotsAndTicks(t *testing.T) {
+	root := t.TempDir()
+	writeHKStatic(t, root, "9988.HK")
+
+	cases := []struct {
+		side, qty, price string
+		wantQty, wantPx  string
+	}{
+		{"BUY", "1200", "12.33", "1000", "12.32"},
+		{"SELL", "1200", "12.33", "1000", "12.34"},
+		{"SELL", "500", "0.333", "500", "0.335"},
+		{"BUY", "500", "25.00", "500", "25.00"},
+	}
+	for _, c := range cases {
+		o := model.ParsedOrder{IntentID: "n", Side: c.side, Symbol: "9988.HK", Qty: c.qty, OrderType: "LIMIT", Price: c.price}
+		note, err := normalizeOrder(root, root, &o)
+		if err != nil {
+			t.Fatalf("normalizeOrder(%s %s @ %s): %v", c.side, c.qty, c.price, err)
+		}
+		if o.Qty != c.wantQty || o.Price != c.wantPx {
+			t.Errorf("%s %s @ %s -> %s @ %s (%s), want %s @ %s", c.side, c.qty, c.price, o.Qty, o.Price, note, c.wantQty, c.wantPx)
+		}
+	}
+
+	o := model.ParsedOrder{IntentID: "n", Side: "BUY", Symbol: "9988.HK", Qty: "300"}
+	if _, err := normalizeOrder(root, root, &o); err == nil || !strings.HasPrefix(err.Error(), "LOT_SIZE") {
+		t.Errorf("expected LOT_SIZE error for an odd lot, got %v", err)
+	}
+
+	// No static.json: unchanged
+	o = model.ParsedOrder{IntentID: "n", Side: "BUY", Symbol: "AAPL.US", Qty: "7", Price: "1.23456"}
+	if note, err := normalizeOrder(root, root, &o); err != nil || note != "" || o.Qty != "7" || o.Price != "1.23456" {
+		t.Errorf("expected order without static info untouched, got %+v note=%q err=%v", o, note, err)
+	}
+}
+
+func TestNormalizeSellClosesOddLot(t *testing.T) {
+	root := t.TempDir()
+	writeHKStatic(t, root, "9988.HK")
+	if err := os.MkdirAll(filepath.Join(root, "account"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	state := `{"positions":[{"symbol":"9988.HK","quantity":"1200","available":"1200"}]}`
+	if err := os.WriteFile(filepath.Join(root, "account", "state.json"), []byte(state), 0644); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+
+	cases := []struct {
+		side, qty, want string // want "" expects LOT_SIZE
+	}{
+		{"SELL", "1200", "1200"}, // the whole position
+		{"SELL", "200", "200"},   // just the odd lot
+		{"SELL", "700", "700"},   // a lot and the odd lot
+		{"SELL", "1100", "1000"}, // would leave an odd lot behind
+		{"SELL", "1700", "1500"}, // more than held
+		{"SELL", "300", ""},
+		{"BUY", "200", ""},
+	}
+	for _, c := range cases {
+		o := model.ParsedOrder{IntentID: "n", Side: c.side, Symbol: "9988.HK", Qty: c.qty}
+		_, err := normalizeOrder(root, root, &o)
+		if c.want == "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "LOT_SIZE") {
+				t.Errorf("%s %s: expected LOT_SIZE, got qty %s err=%v", c.side, c.qty, o.Qty, err)
+			}
+			continue
+		}
+		if err != nil || o.Qty != c.want {
+			t.Errorf("%s %s: got qty %s err=%v, want %s", c.side, c.qty, o.Qty, err, c.want)
+		}
+	}
+}
+
+func TestReplaceNormalized(t *testing.T) {
+	root, bcPath := newLedger(t, `
+2026-03-31 * "ORDER" "BUY 9988.HK"
+  ; intent_id: lot-r1
+  ; side: BUY
+  ; symbol: 9988.HK
+  ; qty: 1000
+  ; type: LIMIT
+  ; price: 70.00
+  ; tif: DAY
+`)
+	writeHKStatic(t, root, "9988.HK")
+	writeQuote(t, root, "9988.HK", `{"symbol":"9988.HK","last":80.00,"updated_at":"t1"}`, "")
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+	ctx := context.Background()
+	if _, err := ProcessLedger(ctx, b, root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	working := workingFromFile(t, bcPath)
+	if len(working) != 1 {
+		t.Fatalf("expected one working order, got %+v", working)
+	}
+	orderID := working[0].OrderID
+
+	appendLedger(t, bcPath, `
+2026-03-31 * "ORDER" "REPLACE"
+  ; intent_id: lot-r2
+  ; action: REPLACE
+  ; order_id: `+orderID+`
+  ; qty: 1700
+  ; price: 70.07
+
+2026-03-31 * "ORDER" "REPLACE"
+  ; intent_id: lot-r3
+  ; action: REPLACE
+  ; order_id: `+orderID+`
+  ; qty: 200
+`)
+	if _, err := ProcessLedger(ctx, b, root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	for _, want := range []string{
+		"normalized: qty 1700->1500 (lot 500), price 70.07->70.05",
+		"reason: LOT_SIZE: qty 200 is below the board lot of 500",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in ledger:\n%s", want, data)
+		}
+	}
+	if got, err := b.QueryOrder(ctx, orderID); err != nil || got.Qty != "1500" || got.Price != "70.05" {
+		t.Fatalf("expected amended order 1500 @ 70.05, got %+v err=%v", got, err)
+	}
+}
+
+func TestNormalizedOrderJournaled(t *testing.T) {
+	root := t.TempDir()
+	writeHKStatic(t, root, "9988.HK")
+	bcPath := filepath.Join(root, "trade", "beancount.txt")
+	ledgerText := `
+2026-03-31 * "ORDER" "BUY 9988.HK"
+  ; intent_id: lot-001
+  ; side: BUY
+  ; symbol: 9988.HK
+  ; qty: 1700
+  ; type: LIMIT
+  ; price: 80.07
+  ; tif: DAY
+
+2026-03-31 * "ORDER" "BUY 9988.HK"
+  ; intent_id: lot-002
+  ; side: BUY
+  ; symbol: 9988.HK
+  ; qty: 200
+  ; tif: DAY
+`
+	if err := os.WriteFile(bcPath, []byte(ledgerText), 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	if _, err := ProcessLedger(context.Background(), NewMockBroker(), root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, _ := os.ReadFile(bcPath)
+	text := string(data)
+	for _, want := range []string{
+		"qty: 1500",
+		"price: 80.05",
+		"normalized: qty 1700->1500 (lot 500), price 80.07->80.05",
+		"reason: LOT_SIZE: qty 200 is below the board lot of 500",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in ledger:\n%s", want, text)
+		}
+	}
+}
+
+func TestTWAPSlicesInBoardLots(t *testing.T) {
+	root := t.TempDir()
+	writeHKStatic(t, root, "9988.HK")
+	bcPath := filepath.Join(root, "trade", "beancount.txt")
+	if err := os.WriteFile(bcPath, nil, 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	scheduler := NewAlgoScheduler(bcPath, root, NewMockBroker())
+	defer scheduler.Shutdown()
+
+	o := model.ParsedOrder{IntentID: "lot-twap", Side: "BUY", Symbol: "9988.HK", Qty: "4000", OrderType: "MARKET", TIF: "DAY",
+		Algo: "TWAP", AlgoDuration: "1h", AlgoSlices: 3}
+	if err := scheduler.CreateTask(o); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	task := scheduler.tasks["lot-twap"]
+	got := []int64{task.sliceQty(1), task.sliceQty(2), task.sliceQty(3)}
+	want := []int64{1500, 1500, 1000}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("slice qty = %v, want %v", got, want)
+		}
+	}
+
+	o.IntentID, o.Qty, o.AlgoSlices = "lot-twap-2", "1000", 3
+	if err := scheduler.CreateTask(o); err == nil {
+		t.Errorf("expected slices below one lot to be rejected")
+	}
+}
@@ -0,0 +1,82 @@
+package broker
+
+import (
+	"context"
+
+	"longbridge-fs/internal/model"
+)
+
+// placedOrders is a Reconciler's list of today's orders, fetched once per
+// ledger pass on first use.
+type placedOrders struct {
+	r        Reconciler
+	fetched  bool
+	err      error
+	byRemark map[string]*OrderInfo
+}
+
+// newPlacedOrders returns nil if b cannot reconcile.
+func newPlacedOrders(b Broker) *placedOrders {
+	r, ok := b.(Reconciler)
+	if !ok {
+		return nil
+	}
+	return &placedOrders{r: r}
+}
+
+// find returns the venue order already placed for o, nil if there is none.
+// Orders with a custom remark are not looked up: only the default remark
+// is known to be unique per intent. An error means the venue could not be
+// asked; the caller should not submit.
+func (p *placedOrders) find(ctx context.Context, o model.ParsedOrder) (*OrderInfo, error) {
+	if p == nil || o.Remark != "" {
+		return nil, nil
+	}
+	if !p.fetched {
+		p.byRemark, p.err = p.r.OrdersByRemark(ctx)
+		p.fetched = true
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	info := p.byRemark[RemarkPrefix+o.IntentID]
+	if info == nil {
+		return nil, nil
+	}
+	recovered := *info
+	recovered.IntentID = o.IntentID
+	recovered.GroupID = o.GroupID
+	return &recovered, nil
+}
+
+// orderRemark is the remark an order is submitted with. Orders without an
+// intent_id, such as those placed from the CLI, get none unless they set
+// one: a bare prefix would put them all in one reconcile bucket.
+func orderRemark(o model.ParsedOrder) string {
+	if o.Remark != "" || o.IntentID == "" {
+		return o.Remark
+	}
+	return RemarkPrefix + o.IntentID
+}
+
+// recordRecovered journals an order found at the venue instead of
+// submitting it again, in whatever state it has reached since.
+func recordRecovered(bcPath string, b Broker, o model.ParsedOrder, info *OrderInfo, meta map[string]string) {
+	m := map[string]string{"recovered": "true"}
+	for k, v := range meta {
+		m[k] = v
+	}
+	switch info.Status {
+	case StatusSubmitted, StatusPartialFill, StatusFilled:
+		if info.AvgPrice != "" {
+			info.Price = info.AvgPrice
+		}
+		recordSubmission(bcPath, b, o, info, m)
+		if es, ok := b.(EventSource); ok && info.Status != StatusFilled {
+			es.Track(*info)
+		}
+	default:
+		// Ended while the controller was down
+		AppendOrderEvent(bcPath, OrderEvent{Order: *info, FillQty: info.FilledQty, FillPrice: info.AvgPrice, Fee: info.Fees})
+	}
+}
@@ -0,0 +1,177 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/model"
+	"longbridge-fs/internal/riskgate"
+)
+
+// processReplace handles an `action: REPLACE` ORDER entry: it amends the
+// working order named by order_id with the entry's qty/price/trigger_price.
+// The amended order is normalized to board lots and ticks and passes the risk
+// gate like a new one, then a REPLACED EXECUTION (or a REJECTION) is
+// journaled under the REPLACE intent.
+func processReplace(ctx context.Context, b Broker, root, quoteRoot string, entries []model.Entry, o model.ParsedOrder, gate *riskgate.Gate, accountState *model.AccountState) {
+	bcPath := filepath.Join(root, "trade", "beancount.txt")
+	sym := ledger.FullSymbol(o.Symbol, o.Market)
+	if o.OrderID == "" {
+		AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, "INVALID_REPLACE: order_id is required")
+		return
+	}
+	if o.Qty == "" && o.Price == "" && o.TriggerPrice == "" && o.TrailingAmount == "" && o.TrailingPercent == "" && o.LimitOffset == "" {
+		AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, "INVALID_REPLACE: nothing to amend (qty, price, trigger_price, trailing_amount, trailing_percent or limit_offset)")
+		return
+	}
+	if b == nil {
+		return
+	}
+
+	orig, status, err := resolveOrder(ctx, b, entries, o.OrderID)
+	if err != nil {
+		AppendRejection(bcPath, o.IntentID, sym, o.Side, o.Qty, fmt.Sprintf("INVALID_REPLACE: %v", err))
+		log.Printf("replace rejected: intent=%s order_id=%s err=%v", o.IntentID, o.OrderID, err)
+		return
+	}
+	if status != "" && status != StatusSubmitted && status != StatusPartialFill {
+		AppendRejection(bcPath, o.IntentID, ledger.FullSymbol(orig.Symbol, orig.Market), orig.Side, o.Qty,
+			fmt.Sprintf("INVALID_REPLACE: order %s is %s", o.OrderID, status))
+		return
+	}
+
+	// The amended order keeps the original's symbol, side and type
+	amended := orig
+	amended.IntentID = o.IntentID
+	if o.Qty != "" {
+		amended.Qty = o.Qty
+	}
+	if o.Price != "" {
+		amended.Price = o.Price
+	}
+	if o.TriggerPrice != "" {
+		amended.TriggerPrice = o.TriggerPrice
+	}
+	if o.TrailingAmount != "" {
+		amended.TrailingAmount = o.TrailingAmount
+	}
+	if o.TrailingPercent != "" {
+		amended.TrailingPercent = o.TrailingPercent
+	}
+	if o.LimitOffset != "" {
+		amended.LimitOffset = o.LimitOffset
+	}
+	if err := ledger.ValidateAmendment(o); err != nil {
+		AppendRejection(bcPath, o.IntentID, sym, amended.Side, amended.Qty, fmt.Sprintf("INVALID_REPLACE: %v", err))
+		return
+	}
+	sym = ledger.FullSymbol(amended.Symbol, amended.Market)
+
+	note, err := normalizeOrder(root, quoteRoot, &amended)
+	if err != nil {
+		AppendRejection(bcPath, o.IntentID, sym, amended.Side, amended.Qty, err.Error())
+		log.Printf("replace rejected: intent=%s order_id=%s err=%v", o.IntentID, o.OrderID, err)
+		return
+	}
+	if note != "" {
+		log.Printf("replace normalized: intent=%s %s", o.IntentID, note)
+	}
+
+	if !preTradeCheck(gate, accountState, bcPath, &amended) {
+		return
+	}
+
+	// Unchanged fields carry the working order's values: the venue treats
+	// a missing price as zero, and a blank remark would break reconciliation
+	req := ReplaceRequest{
+		OrderID:         o.OrderID,
+		Qty:             amended.Qty,
+		Price:           amended.Price,
+		TriggerPrice:    amended.TriggerPrice,
+		TrailingAmount:  amended.TrailingAmount,
+		TrailingPercent: amended.TrailingPercent,
+		LimitOffset:     amended.LimitOffset,
+		Remark:          orderRemark(orig),
+	}
+	if err := b.Replace(ctx, req); err != nil {
+		AppendRejection(bcPath, o.IntentID, sym, amended.Side, amended.Qty, err.Error())
+		log.Printf("replace rejected: intent=%s order_id=%s err=%v", o.IntentID, o.OrderID, err)
+		return
+	}
+
+	appendExecution(bcPath, StatusReplaced, o.IntentID, o.OrderID, sym, amended.Side, amended.Price, amended.Qty, map[string]string{
+		"replaces":         orig.IntentID,
+		"trigger_price":    amended.TriggerPrice,
+		"trailing_amount":  amended.TrailingAmount,
+		"trailing_percent": amended.TrailingPercent,
+		"limit_offset":     amended.LimitOffset,
+		"normalized":       note,
+	})
+	log.Printf("replaced order: intent=%s order_id=%s qty=%s price=%s", o.IntentID, o.OrderID, amended.Qty, amended.Price)
+}
+
+// resolveOrder finds the order a REPLACE targets. The ledger is authoritative:
+// the SUBMITTED/EXECUTION entries for orderID lead back to the original ORDER
+// entry, with the values of earlier REPLACED entries applied. Orders placed
+// outside the ledger are looked up on the venue.
+// The returned status is the order's latest journaled status, if any.
+func resolveOrder(ctx context.Context, b Broker, entries []model.Entry, orderID string) (model.ParsedOrder, string, error) {
+	var intentID, status string
+	replaced := map[string]string{}
+	for _, e := range entries {
+		if (e.Type != "SUBMITTED" && e.Type != "EXECUTION") || e.Meta["order_id"] != orderID {
+			continue
+		}
+		switch e.Meta["status"] {
+		case StatusReplaced:
+			for _, k := range []string{"qty", "price", "trigger_price", "trailing_amount", "trailing_percent", "limit_offset"} {
+				if v := e.Meta[k]; v != "" {
+					replaced[k] = v
+				}
+			}
+		default:
+			intentID = e.Meta["intent_id"]
+			status = e.Meta["status"]
+			if e.Type == "SUBMITTED" && e.Meta["qty"] != "" {
+				replaced["qty"] = e.Meta["qty"]
+			}
+		}
+	}
+
+	if intentID != "" {
+		for _, e := range entries {
+			if e.Type == "ORDER" && e.Meta["intent_id"] == intentID {
+				orig, _ := ledger.OrderFromEntry(e)
+				for k, dst := range map[string]*string{
+					"qty":              &orig.Qty,
+					"price":            &orig.Price,
+					"trigger_price":    &orig.TriggerPrice,
+					"trailing_amount":  &orig.TrailingAmount,
+					"trailing_percent": &orig.TrailingPercent,
+					"limit_offset":     &orig.LimitOffset,
+				} {
+					if v := replaced[k]; v != "" {
+						*dst = v
+					}
+				}
+				return orig, status, nil
+			}
+		}
+	}
+
+	info, err := b.QueryOrder(ctx, orderID)
+	if err != nil {
+		return model.ParsedOrder{}, "", fmt.Errorf("order %s not found: %v", orderID, err)
+	}
+	return model.ParsedOrder{
+		IntentID: info.IntentID,
+		Side:     info.Side,
+		Symbol:   info.Symbol, // already carries the market suffix
+		Qty:      info.Qty,
+		Price:    info.Price,
+		Remark:   info.Remark,
+	}, info.Status, nil
+}
@@ -0,0 +1,212 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/model"
+)
+
+func TestReplaceAmendsWorkingOrder(t *testing.T) {
+	b, bcPath, orderID := paperWorkingOrder(t)
+	ctx := context.Background()
+
+	appendLedger(t, bcPath, `
+2026-01-01 * "ORDER" "REPLACE"
+  ; intent_id: r-2
+  ; action: REPLACE
+  ; order_id: `+orderID+`
+  ; qty: 150
+  ; price: 181.50
+`)
+	if _, err := ProcessLedger(ctx, b, b.root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, _ := os.ReadFile(bcPath)
+	if !strings.Contains(string(data), "status: REPLACED") || !strings.Contains(string(data), "replaces: r-1") {
+		t.Fatalf("expected REPLACED execution, got:\n%s", data)
+	}
+
+	got, err := b.QueryOrder(ctx, orderID)
+	if err != nil || got.Qty != "150" || got.Price != "181.5" {
+		t.Fatalf("expected amended order 150 @ 181.5, got %+v err=%v", got, err)
+	}
+	working := workingFromFile(t, bcPath)
+	if len(working) != 1 || working[0].IntentID != "r-1" || working[0].Qty != "150" {
+		t.Fatalf("expected order still working under r-1 with qty 150, got %+v", working)
+	}
+}
+
+func TestReplaceOrderPlacedOutsideLedger(t *testing.T) {
+	b, bcPath, _ := paperWorkingOrder(t)
+	ctx := context.Background()
+
+	// Placed through the venue directly, so only QueryOrder knows it
+	info, err := b.Submit(ctx, model.ParsedOrder{IntentID: "ext-1", Side: "SELL", Symbol: "AAPL", Market: "US",
+		Qty: "50", OrderType: "LIMIT", Price: "190", TIF: "GTC"})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	appendLedger(t, bcPath, `
+2026-01-01 * "ORDER" "REPLACE"
+  ; intent_id: r-3
+  ; action: REPLACE
+  ; order_id: `+info.OrderID+`
+  ; price: 191
+`)
+	if _, err := ProcessLedger(ctx, b, b.root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, _ := os.ReadFile(bcPath)
+	if !strings.Contains(string(data), "status: REPLACED") || strings.Contains(string(data), "INVALID_REPLACE") {
+		t.Fatalf("expected REPLACED execution, got:\n%s", data)
+	}
+	if got, err := b.QueryOrder(ctx, info.OrderID); err != nil || got.Price != "191" {
+		t.Fatalf("expected amended price 191, got %+v err=%v", got, err)
+	}
+}
+
+// replaceRecorder records the requests Replace sends to the venue.
+type replaceRecorder struct {
+	*PaperBroker
+	reqs []ReplaceRequest
+}
+
+func (b *replaceRecorder) Replace(ctx context.Context, req ReplaceRequest) error {
+	b.reqs = append(b.reqs, req)
+	return b.PaperBroker.Replace(ctx, req)
+}
+
+func TestReplaceSendsUnchangedFields(t *testing.T) {
+	pb, bcPath, orderID := paperWorkingOrder(t)
+	b := &replaceRecorder{PaperBroker: pb}
+	ctx := context.Background()
+
+	replace := func(id, meta string) ReplaceRequest {
+		t.Helper()
+		appendLedger(t, bcPath, "\n2026-01-01 * \"ORDER\" \"REPLACE\"\n  ; intent_id: "+id+
+			"\n  ; action: REPLACE\n  ; order_id: "+orderID+"\n"+meta)
+		if _, err := ProcessLedger(ctx, b, pb.root); err != nil {
+			t.Fatalf("ProcessLedger: %v", err)
+		}
+		if len(b.reqs) == 0 {
+			data, _ := os.ReadFile(bcPath)
+			t.Fatalf("expected a replace request, got:\n%s", data)
+		}
+		req := b.reqs[len(b.reqs)-1]
+		b.reqs = nil
+		return req
+	}
+
+	// A qty-only amendment keeps the original price and remark
+	req := replace("r-2", "  ; qty: 120\n")
+	if req.Qty != "120" || req.Price != "180.00" || req.Remark != RemarkPrefix+"r-1" {
+		t.Fatalf("unexpected qty-only request %+v", req)
+	}
+	// Later amendments start from the values already replaced
+	replace("r-3", "  ; price: 181\n")
+	req = replace("r-4", "  ; qty: 130\n")
+	if req.Qty != "130" || req.Price != "181" || req.Remark != RemarkPrefix+"r-1" {
+		t.Fatalf("unexpected request after earlier amendments %+v", req)
+	}
+}
+
+func TestOrderActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		meta   string // order_id is appended when withID is set
+		withID bool
+		want   string
+	}{
+		{"lowercase cancel", "  ; action: cancel\n", true, "order_id: CANCEL-"},
+		{"cancel with side", "  ; action: CANCEL\n  ; side: BUY\n  ; symbol: AAPL.US\n  ; qty: 100\n", true, "order_id: CANCEL-"},
+		{"lowercase replace", "  ; action: replace\n  ; side: BUY\n  ; price: 181\n", true, "status: REPLACED"},
+		{"unknown action", "  ; action: CANCLE\n  ; side: BUY\n  ; symbol: AAPL.US\n  ; qty: 100\n", true,
+			`reason: INVALID_ORDER: unknown action "CANCLE" (want CANCEL or REPLACE)`},
+		{"cancel without order_id", "  ; action: CANCEL\n", false, "reason: INVALID_ORDER: order_id is required for CANCEL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, bcPath, orderID := paperWorkingOrder(t)
+			meta := tt.meta
+			if tt.withID {
+				meta += "  ; order_id: " + orderID + "\n"
+			}
+			appendLedger(t, bcPath, "\n2026-01-01 * \"ORDER\" \"ACTION\"\n  ; intent_id: a-1\n"+meta)
+			if _, err := ProcessLedger(context.Background(), b, b.root); err != nil {
+				t.Fatalf("ProcessLedger: %v", err)
+			}
+
+			data, _ := os.ReadFile(bcPath)
+			if !strings.Contains(string(data), tt.want) {
+				t.Fatalf("expected %q, got:\n%s", tt.want, data)
+			}
+			// An action is never submitted as a new order
+			if n := strings.Count(string(data), "\"SUBMITTED\""); n != 1 {
+				t.Fatalf("expected only r-1 submitted, got %d SUBMITTED entries:\n%s", n, data)
+			}
+		})
+	}
+}
+
+// paperWorkingOrder starts a paper broker under a fresh root whose ledger
+// holds one working LIMIT BUY (intent r-1) and returns its order id.
+func paperWorkingOrder(t *testing.T) (*PaperBroker, string, string) {
+	t.Helper()
+	root, bcPath := newLedger(t, "")
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":185.00,"updated_at":"t1"}`, "")
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+
+	appendLedger(t, bcPath, `
+2026-01-01 * "ORDER" "BUY AAPL"
+  ; intent_id: r-1
+  ; side: BUY
+  ; symbol: AAPL
+  ; market: US
+  ; qty: 100
+  ; type: LIMIT
+  ; price: 180.00
+  ; tif: DAY
+`)
+	if _, err := ProcessLedger(context.Background(), b, root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	working := workingFromFile(t, bcPath)
+	if len(working) != 1 {
+		t.Fatalf("expected one working order, got %+v", working)
+	}
+	return b, bcPath, working[0].OrderID
+}
+
+// appendLedger appends text to the ledger at bcPath, creating it if needed.
+func appendLedger(t *testing.T, bcPath, text string) {
+	t.Helper()
+	f, err := os.OpenFile(bcPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("open ledger: %v", err)
+	}
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatalf("append ledger: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close ledger: %v", err)
+	}
+}
+
+func workingFromFile(t *testing.T, bcPath string) []OrderInfo {
+	t.Helper()
+	entries, err := ledger.ParseEntries(bcPath)
+	if err != nil {
+		t.Fatalf("ParseEntries: %v", err)
+	}
+	return WorkingOrders(entries)
+}
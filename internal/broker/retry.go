@@ -0,0 +1,111 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	lbhttp "github.com/longbridge/openapi-go/http"
+)
+
+// Broker error classes recorded in REJECTION meta.
+const (
+	ErrorTransient = "TRANSIENT" // network, rate limit, server side: retried
+	ErrorPermanent = "PERMANENT" // the order itself was refused
+)
+
+// DefaultRetryWindow is how long an order whose submission failed with a
+// transient error keeps being retried before it is rejected, unless the
+// controller's --retry-window flag says otherwise; 0 disables retries.
+const DefaultRetryWindow = time.Minute
+
+// Backoff between retries: doubles from retryBackoffMin up to retryBackoffMax.
+var (
+	retryBackoffMin = 2 * time.Second
+	retryBackoffMax = 30 * time.Second
+)
+
+// submitRetry is the retry state of an order whose submission failed.
+type submitRetry struct {
+	first    time.Time
+	next     time.Time
+	attempts int
+}
+
+// classifyError reports whether err is worth retrying and the venue error
+// code, if any. API errors are transient for HTTP 429 and 5xx; network
+// failures and timeouts are transient; everything else is permanent.
+func classifyError(err error) (class, code string) {
+	var apiErr *lbhttp.ApiError
+	if errors.As(err, &apiErr) {
+		code = strconv.Itoa(apiErr.Code)
+		if apiErr.HttpStatus == 429 || apiErr.HttpStatus >= 500 {
+			return ErrorTransient, code
+		}
+		return ErrorPermanent, code
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorTransient, ""
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"timeout", "connection reset", "connection refused", "broken pipe", "too many requests", "rate limit"} {
+		if strings.Contains(msg, s) {
+			return ErrorTransient, ""
+		}
+	}
+	return ErrorPermanent, ""
+}
+
+// retryLater records a failed submission of intentID under root. It returns
+// true if the order should be tried again on a later cycle; otherwise the
+// retry state is dropped and meta describes the failure for the REJECTION.
+func (s *LedgerState) retryLater(root, intentID string, err error, now time.Time) (retry bool, meta map[string]string) {
+	class, code := classifyError(err)
+	key := stateKey(root, intentID)
+	r := s.retries[key]
+	if r == nil {
+		r = &submitRetry{first: now}
+		s.retries[key] = r
+	}
+	r.attempts++
+
+	if class == ErrorTransient && now.Sub(r.first) < s.retryWindow {
+		backoff := retryBackoffMin
+		for i := 1; i < r.attempts && backoff < retryBackoffMax; i++ {
+			backoff *= 2
+		}
+		backoff = min(backoff, retryBackoffMax)
+		r.next = now.Add(backoff)
+		log.Printf("order submit failed (%s), retrying in %s: intent=%s attempt=%d err=%v", strings.ToLower(class), backoff, intentID, r.attempts, err)
+		return true, nil
+	}
+
+	delete(s.retries, key)
+	meta = map[string]string{
+		"error_class": class,
+		"attempts":    strconv.Itoa(r.attempts),
+	}
+	if code != "" {
+		meta["error_code"] = code
+	}
+	return false, meta
+}
+
+// retryPending reports whether intentID is waiting out a retry backoff.
+func (s *LedgerState) retryPending(root, intentID string, now time.Time) bool {
+	r := s.retries[stateKey(root, intentID)]
+	return r != nil && now.Before(r.next)
+}
+
+// submitted clears the retry state of an order that went out.
+func (s *LedgerState) submitted(root, intentID string) {
+	delete(s.retries, stateKey(root, intentID))
+}
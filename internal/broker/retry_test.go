@@ -0,0 +1,153 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"longbridge-fs/internal/model"
+
+	lbhttp "github.com/longbridge/openapi-go/http"
+)
+
+// flakyBroker fails Submit with the queued errors before filling like MockBroker.
+type flakyBroker struct {
+	*MockBroker
+	errs []error
+}
+
+func (b *flakyBroker) Submit(ctx context.Context, o model.ParsedOrder) (*OrderInfo, error) {
+	if len(b.errs) > 0 {
+		err := b.errs[0]
+		b.errs = b.errs[1:]
+		return nil, err
+	}
+	return b.MockBroker.Submit(ctx, o)
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+		code  string
+	}{
+		{&lbhttp.ApiError{HttpStatus: 429, Code: 429002}, ErrorTransient, "429002"},
+		{fmt.Errorf("submit: %w", &lbhttp.ApiError{HttpStatus: 502}), ErrorTransient, "0"},
+		{&lbhttp.ApiError{HttpStatus: 400, Code: 602001, Message: "insufficient buying power"}, ErrorPermanent, "602001"},
+		{fmt.Errorf("dial: %w", context.DeadlineExceeded), ErrorTransient, ""},
+		{errors.New("read tcp: connection reset by peer"), ErrorTransient, ""},
+		{errors.New("invalid qty \"x\""), ErrorPermanent, ""},
+		{fmt.Errorf("read response: %w", io.ErrUnexpectedEOF), ErrorTransient, ""},
+		{errors.New("symbol GEOFF.US not found"), ErrorPermanent, ""},
+	}
+	for _, tt := range tests {
+		class, code := classifyError(tt.err)
+		if class != tt.class || code != tt.code {
+			t.Errorf("classifyError(%v) = %s %q, want %s %q", tt.err, class, code, tt.class, tt.code)
+		}
+	}
+}
+
+func TestSubmitRetriesTransientErrors(t *testing.T) {
+	defer func(min time.Duration) { retryBackoffMin = min }(retryBackoffMin)
+	retryBackoffMin = 0
+
+	ledgerText := `
+2026-03-31 * "ORDER" "BUY AAPL.US"
+  ; intent_id: retry-001
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qty: 10
+  ; tif: DAY
+`
+	root, bcPath := newLedger(t, ledgerText)
+	b := &flakyBroker{MockBroker: NewMockBroker(), errs: []error{
+		&lbhttp.ApiError{HttpStatus: 503, Code: 500001},
+		errors.New("i/o timeout"),
+	}}
+
+	ctx := context.Background()
+	state := NewLedgerState(time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := ProcessLedgerWithScheduler(ctx, b, root, root, nil, state); err != nil {
+			t.Fatalf("ProcessLedger: %v", err)
+		}
+		if data, _ := os.ReadFile(bcPath); strings.Contains(string(data), "REJECTION") || strings.Contains(string(data), "EXECUTION") {
+			t.Fatalf("expected order held for retry after attempt %d:\n%s", i+1, data)
+		}
+	}
+	if _, err := ProcessLedgerWithScheduler(ctx, b, root, root, nil, state); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, _ := os.ReadFile(bcPath)
+	if !strings.Contains(string(data), "status: FILLED") {
+		t.Errorf("expected order filled on the third attempt:\n%s", data)
+	}
+}
+
+func TestSubmitRejectionRecordsErrorClass(t *testing.T) {
+	ledgerText := `
+2026-03-31 * "ORDER" "BUY AAPL.US"
+  ; intent_id: perm-001
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qty: 10
+  ; tif: DAY
+
+2026-03-31 * "ORDER" "BUY AAPL.US"
+  ; intent_id: perm-002
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qty: 10
+  ; tif: DAY
+`
+	root, bcPath := newLedger(t, ledgerText)
+	b := &flakyBroker{MockBroker: NewMockBroker(), errs: []error{
+		&lbhttp.ApiError{HttpStatus: 400, Code: 602001, Message: "insufficient buying power"},
+		&lbhttp.ApiError{HttpStatus: 503, Code: 500001},
+	}}
+	if _, err := ProcessLedgerWithScheduler(context.Background(), b, root, root, nil, NewLedgerState(0)); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+
+	data, _ := os.ReadFile(bcPath)
+	text := string(data)
+	for _, want := range []string{
+		"error_class: PERMANENT",
+		"error_code: 602001",
+		"error_class: TRANSIENT", // retry window disabled
+		"error_code: 500001",
+		"attempts: 1",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in ledger:\n%s", want, text)
+		}
+	}
+}
+
+func TestRetryStateIsPerAccount(t *testing.T) {
+	s := NewLedgerState(time.Minute)
+	now := time.Now()
+	transient := &lbhttp.ApiError{HttpStatus: 503}
+
+	// The same intent_id backing off in one account leaves another alone
+	if retry, _ := s.retryLater("/fs", "same-001", transient, now); !retry {
+		t.Fatalf("expected a transient error to be retried")
+	}
+	if !s.retryPending("/fs", "same-001", now) {
+		t.Errorf("expected /fs to wait out its backoff")
+	}
+	if s.retryPending("/fs/accounts/ira", "same-001", now) {
+		t.Errorf("backoff of /fs leaked into /fs/accounts/ira")
+	}
+
+	s.submitted("/fs/accounts/ira", "same-001")
+	if !s.retryPending("/fs", "same-001", now) {
+		t.Errorf("submission in /fs/accounts/ira cleared the retry of /fs")
+	}
+}
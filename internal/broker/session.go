@@ -0,0 +1,62 @@
+package broker
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/market"
+	"longbridge-fs/internal/model"
+)
+
+// marketOf returns the market whose calendar an order trades on: that of
+// the symbol suffix if it has one, else of its market field.
+func marketOf(o model.ParsedOrder) string {
+	sym := ledger.FullSymbol(o.Symbol, o.Market)
+	return market.CalendarMarket(sym[strings.LastIndex(sym, ".")+1:])
+}
+
+// sessionCheck consults the cached trading calendar under /quote/market/.
+// hold is true while the market opens later (before the open, lunch break,
+// a weekend or holiday). A DAY order written after the trading day's last
+// session gets a MARKET_CLOSED reason instead; GTC/GTD orders wait for the
+// next session. Without a calendar, orders go out.
+func sessionCheck(root string, o model.ParsedOrder, now time.Time) (hold bool, reason string, state string, next time.Time) {
+	mkt := marketOf(o)
+	cal := market.LoadCalendar(root, mkt)
+	if cal == nil {
+		return false, "", market.SessionOpen, time.Time{}
+	}
+	state, next = cal.State(now)
+	switch {
+	case state == market.SessionOpen:
+		return false, "", state, next
+	case state == market.SessionClosed && o.TIF == "DAY" && cal.SessionEnded(now):
+		reason = fmt.Sprintf("MARKET_CLOSED: %s has no session left today; DAY order not sent", mkt)
+		if !next.IsZero() {
+			reason += fmt.Sprintf(" (next open %s)", next.Format(time.RFC3339))
+		}
+		return false, reason, state, next
+	default:
+		return true, "", state, next
+	}
+}
+
+// holdForSession reports whether an ORDER must wait for its session, logging
+// when an order starts waiting or changes state rather than every cycle.
+// Calendars are read under quoteRoot; root keys the account's state.
+func (s *LedgerState) holdForSession(root, quoteRoot string, o model.ParsedOrder) (hold bool, reason string) {
+	hold, reason, state, next := sessionCheck(quoteRoot, o, time.Now())
+	key := stateKey(root, o.IntentID)
+	if !hold {
+		delete(s.held, key)
+		return false, reason
+	}
+	if s.held[key] != state {
+		s.held[key] = state
+		log.Printf("order held: intent=%s market=%s session=%s opens=%s", o.IntentID, marketOf(o), state, next.Format(time.RFC3339))
+	}
+	return true, ""
+}
@@ -0,0 +1,151 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"longbridge-fs/internal/market"
+	"longbridge-fs/internal/model"
+)
+
+func TestCalendarStateHKLunchBreak(t *testing.T) {
+	cal := &market.Calendar{
+		Market:          "HK",
+		Timezone:        "Asia/Hong_Kong",
+		From:            "2026-03-27",
+		Through:         "2026-04-30",
+		TradingDays:     []string{"2026-03-27", "2026-03-30"},
+		HalfTradingDays: []string{"2026-03-31"},
+		Sessions:        []market.Session{{Begin: "09:30", End: "12:00"}, {Begin: "13:00", End: "16:00"}},
+	}
+	hk, _ := time.LoadLocation("Asia/Hong_Kong")
+	at := func(day, hm string) time.Time {
+		ts, _ := time.ParseInLocation("2006-01-02 15:04", day+" "+hm, hk)
+		return ts
+	}
+
+	cases := []struct {
+		t     time.Time
+		state string
+		next  time.Time
+	}{
+		{at("2026-03-30", "08:00"), market.SessionPreOpen, at("2026-03-30", "09:30")},
+		{at("2026-03-30", "10:00"), market.SessionOpen, time.Time{}},
+		{at("2026-03-30", "12:30"), market.SessionBreak, at("2026-03-30", "13:00")},
+		{at("2026-03-30", "16:30"), market.SessionClosed, at("2026-03-31", "09:30")},
+		{at("2026-03-31", "12:30"), market.SessionClosed, time.Time{}}, // half day: no afternoon
+		{at("2026-03-28", "10:00"), market.SessionClosed, at("2026-03-30", "09:30")},
+		{at("2026-05-04", "03:00"), market.SessionOpen, time.Time{}}, // not cached
+	}
+	for _, c := range cases {
+		state, next := cal.State(c.t)
+		if state != c.state || !next.Equal(c.next) {
+			t.Errorf("State(%s) = %s %s, want %s %s", c.t, state, next, c.state, c.next)
+		}
+	}
+}
+
+func TestClosedMarketRejectsDayAndHoldsGTC(t *testing.T) {
+	root := t.TempDir()
+	writeCalendar(t, root, `{"market":"US","timezone":"America/New_York","from":"2026-03-27","through":"2026-04-30",
+"trading_days":["2026-03-27","2026-03-30"],"sessions":[{"begin":"09:30","end":"16:00"}]}`)
+	ny, _ := time.LoadLocation("America/New_York")
+	at := func(day, hm string) time.Time {
+		ts, _ := time.ParseInLocation("2006-01-02 15:04", day+" "+hm, ny)
+		return ts
+	}
+
+	cases := []struct {
+		name string
+		t    time.Time
+		tif  string
+		hold bool // otherwise rejected with MARKET_CLOSED
+	}{
+		{"DAY after the close", at("2026-03-27", "17:00"), "DAY", false},
+		{"GTC after the close", at("2026-03-27", "17:00"), "GTC", true},
+		{"DAY on a weekend", at("2026-03-28", "10:00"), "DAY", true},
+		{"DAY overnight before the open", at("2026-03-30", "02:00"), "DAY", true},
+		{"DAY before the open", at("2026-03-30", "09:00"), "DAY", true},
+	}
+	for _, c := range cases {
+		o := model.ParsedOrder{IntentID: "cal-1", Symbol: "AAPL", Market: "US", TIF: c.tif}
+		hold, reason, _, _ := sessionCheck(root, o, c.t)
+		if c.hold && (!hold || reason != "") {
+			t.Errorf("%s: expected held, got hold=%v reason=%q", c.name, hold, reason)
+		}
+		if !c.hold && (hold || !strings.HasPrefix(reason, "MARKET_CLOSED") || !strings.Contains(reason, "next open 2026-03-30T09:30:00-04:00")) {
+			t.Errorf("%s: expected MARKET_CLOSED, got hold=%v reason=%q", c.name, hold, reason)
+		}
+	}
+
+	// On a day without trading, DAY and GTC orders stay in the ledger
+	now := time.Now().UTC()
+	tomorrow := now.AddDate(0, 0, 1).Format("2006-01-02")
+	root, bcPath := newLedger(t, `
+2026-03-31 * "ORDER" "BUY AAPL.US"
+  ; intent_id: cal-day
+  ; side: BUY
+  ; symbol: AAPL
+  ; qty: 10
+  ; tif: DAY
+
+2026-03-31 * "ORDER" "BUY AAPL.US"
+  ; intent_id: cal-gtc
+  ; side: BUY
+  ; symbol: AAPL
+  ; qty: 10
+  ; type: LIMIT
+  ; price: 100.00
+  ; tif: GTC
+`)
+	writeCalendar(t, root, `{"market":"US","timezone":"UTC","from":"`+now.AddDate(0, 0, -1).Format("2006-01-02")+`","through":"`+tomorrow+
+		`","trading_days":["`+tomorrow+`"],"sessions":[{"begin":"00:00","end":"23:59"}]}`)
+	if _, err := ProcessLedger(context.Background(), NewMockBroker(), root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	for _, id := range []string{"cal-day", "cal-gtc"} {
+		if n := strings.Count(string(data), "intent_id: "+id); n != 1 {
+			t.Errorf("expected %s held without journal entries:\n%s", id, data)
+		}
+	}
+}
+
+func TestSessionCheckMapsAShareSuffixes(t *testing.T) {
+	root := t.TempDir()
+	writeCalendar(t, root, `{"market":"CN","timezone":"Asia/Shanghai","from":"2026-03-27","through":"2026-04-30",
+"trading_days":["2026-03-30"],"sessions":[{"begin":"09:30","end":"11:30"},{"begin":"13:00","end":"15:00"}]}`)
+	sh, _ := time.LoadLocation("Asia/Shanghai")
+	saturday := time.Date(2026, 3, 28, 10, 0, 0, 0, sh)
+
+	for _, sym := range []string{"600519.SH", "000001.SZ"} {
+		o := model.ParsedOrder{IntentID: "a-1", Symbol: sym, TIF: "GTC"}
+		if hold, reason, state, _ := sessionCheck(root, o, saturday); !hold || reason != "" || state != market.SessionClosed {
+			t.Errorf("%s: expected held on the CN calendar, got hold=%v reason=%q state=%s", sym, hold, reason, state)
+		}
+	}
+}
+
+// writeCalendar caches a market calendar under root.
+func writeCalendar(t *testing.T, root, cal string) {
+	t.Helper()
+	var c market.Calendar
+	if err := json.Unmarshal([]byte(cal), &c); err != nil {
+		t.Fatalf("parse calendar: %v", err)
+	}
+	path := market.CalendarPath(root, c.Market)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(cal), 0644); err != nil {
+		t.Fatalf("write calendar: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"longbridge-fs/internal/model"
+)
+
+// Normalized order states reported by a Broker, independent of venue wording.
+const (
+	StatusSubmitted   = "SUBMITTED"
+	StatusPartialFill = "PARTIAL_FILL"
+	StatusFilled      = "FILLED"
+	StatusCancelled   = "CANCELLED"
+	StatusRejected    = "REJECTED"
+	StatusExpired     = "EXPIRED"
+	StatusReplaced    = "REPLACED" // journal-only: a working order was amended
+)
+
+// Broker is the execution seam used by the ledger processor, the algo
+// scheduler and the CLI. Implementations wrap a concrete venue (Longbridge,
+// a local simulator, a test double) behind the same set of calls.
+type Broker interface {
+	// Submit sends a new order and returns its initial state.
+	Submit(ctx context.Context, o model.ParsedOrder) (*OrderInfo, error)
+	// Cancel requests cancellation of a working order.
+	Cancel(ctx context.Context, orderID string) error
+	// Replace amends quantity and/or prices of a working order.
+	Replace(ctx context.Context, req ReplaceRequest) error
+	// QueryOrder returns the current state of an order.
+	QueryOrder(ctx context.Context, orderID string) (*OrderInfo, error)
+	// ListFills returns the trades executed against an order so far.
+	ListFills(ctx context.Context, orderID string) ([]Fill, error)
+}
+
+// OrderInfo is a venue-neutral snapshot of an order.
+type OrderInfo struct {
+	OrderID   string
+	IntentID  string
+	Symbol    string
+	Side      string
+	Status    string // one of the Status* constants
+	Qty       string
+	FilledQty string
+	Price     string // submitted price, or fill price for instantly filled orders
+	AvgPrice  string // average fill price, empty until something fills
+	Fees      string // cumulative fees charged so far
+	Remark    string
+	Msg       string // venue message, e.g. reject reason
+	GroupID   string // BRACKET/OCO group the order is a leg of
+}
+
+// Fill is a single trade executed against an order.
+type Fill struct {
+	OrderID string    `json:"order_id"`
+	TradeID string    `json:"trade_id"`
+	Symbol  string    `json:"symbol"`
+	Qty     string    `json:"qty"`
+	Price   string    `json:"price"`
+	Time    time.Time `json:"time"`
+}
+
+// ReplaceRequest carries the amended values for Broker.Replace.
+// Empty fields are left unchanged where the venue allows it.
+type ReplaceRequest struct {
+	OrderID         string
+	Qty             string
+	Price           string
+	TriggerPrice    string
+	TrailingAmount  string
+	TrailingPercent string
+	LimitOffset     string
+	Remark          string
+}
+
+// OrderEvent is a state change of a working order (fill, partial fill,
+// cancel, expiry) that the ledger processor journals as an EXECUTION.
+type OrderEvent struct {
+	Order     OrderInfo // snapshot after the change
+	FillQty   string    // quantity filled by this event, "0" for cancel/expiry
+	FillPrice string    // price of this fill
+	Fee       string    // fee charged for this fill
+}
+
+// EventSource is implemented by brokers whose orders can change state after
+// Submit returns. DrainEvents returns the changes observed since the last call.
+// Track registers a working order recovered from the ledger (e.g. after a
+// restart) so its later changes are reported; known orders are left as is.
+type EventSource interface {
+	DrainEvents(ctx context.Context) []OrderEvent
+	Track(info OrderInfo)
+}
+
+// Reconciler is implemented by brokers that can list the orders already
+// placed today. Before submitting, the ledger processor looks pending
+// intents up by remark, so an order sent just before a crash is recovered
+// rather than sent twice.
+type Reconciler interface {
+	// OrdersByRemark returns today's orders keyed by remark.
+	OrdersByRemark(ctx context.Context) (map[string]*OrderInfo, error)
+}
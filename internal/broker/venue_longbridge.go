@@ -0,0 +1,392 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/model"
+
+	"github.com/longbridge/openapi-go/trade"
+	"github.com/shopspring/decimal"
+)
+
+// RemarkPrefix tags orders placed by longbridge-fs; the intent_id follows it.
+const RemarkPrefix = "longbridge-fs:"
+
+// orderPollInterval is how often TodayOrders is polled as a fallback for
+// missed order-changed pushes while orders are working.
+const orderPollInterval = 10 * time.Second
+
+// LongbridgeBroker routes orders to the Longbridge trade API.
+type LongbridgeBroker struct {
+	tc *trade.TradeContext
+
+	mu       sync.Mutex
+	tracked  map[string]*trackedOrder // order_id -> last journaled state
+	events   []OrderEvent
+	lastPoll time.Time
+}
+
+// trackedOrder is the state of a working order as last reported to the ledger.
+type trackedOrder struct {
+	info   OrderInfo
+	filled decimal.Decimal
+	avg    decimal.Decimal
+}
+
+// orderObservation is an order state seen in a push event or a poll.
+type orderObservation struct {
+	OrderID  string
+	Status   trade.OrderStatus
+	Filled   decimal.Decimal
+	AvgPrice decimal.Decimal
+	Msg      string
+}
+
+// NewLongbridgeBroker wraps an initialized TradeContext.
+func NewLongbridgeBroker(tc *trade.TradeContext) *LongbridgeBroker {
+	return &LongbridgeBroker{
+		tc:      tc,
+		tracked: make(map[string]*trackedOrder),
+	}
+}
+
+// SubscribeOrderEvents routes order-changed pushes into the broker so fills,
+// cancels and expiries are reported through DrainEvents. Without it the
+// broker still learns about changes by polling TodayOrders.
+func (b *LongbridgeBroker) SubscribeOrderEvents(ctx context.Context) error {
+	b.tc.OnTrade(b.handlePush)
+	_, err := b.tc.Subscribe(ctx, []string{"private"})
+	return err
+}
+
+// TradeContext exposes the underlying SDK context for callers that need
+// endpoints outside the Broker interface (account refresh, push events).
+func (b *LongbridgeBroker) TradeContext() *trade.TradeContext {
+	return b.tc
+}
+
+// Submit implements Broker.
+func (b *LongbridgeBroker) Submit(ctx context.Context, o model.ParsedOrder) (*OrderInfo, error) {
+	orderID, err := ExecuteOrder(ctx, b.tc, o)
+	if err != nil {
+		return nil, err
+	}
+	info := &OrderInfo{
+		OrderID:  orderID,
+		IntentID: o.IntentID,
+		Symbol:   ledger.FullSymbol(o.Symbol, o.Market),
+		Side:     o.Side,
+		Status:   StatusSubmitted,
+		Qty:      o.Qty,
+		Price:    o.Price,
+		GroupID:  o.GroupID,
+	}
+	b.Track(*info)
+	return info, nil
+}
+
+// Track implements EventSource.
+func (b *LongbridgeBroker) Track(info OrderInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.tracked[info.OrderID]; ok {
+		return
+	}
+	t := &trackedOrder{info: info}
+	t.filled, _ = decimal.NewFromString(info.FilledQty)
+	t.avg, _ = decimal.NewFromString(info.AvgPrice)
+	b.tracked[info.OrderID] = t
+}
+
+// DrainEvents implements EventSource. Pushes are applied as they arrive;
+// here TodayOrders is polled when working orders exist, and fees are looked
+// up for orders that just completed.
+func (b *LongbridgeBroker) DrainEvents(ctx context.Context) []OrderEvent {
+	b.mu.Lock()
+	poll := len(b.tracked) > 0 && time.Since(b.lastPoll) >= orderPollInterval
+	if poll {
+		b.lastPoll = time.Now()
+	}
+	b.mu.Unlock()
+
+	if poll {
+		orders, err := b.tc.TodayOrders(ctx, &trade.GetTodayOrders{})
+		if err != nil {
+			log.Printf("order poll failed: %v", err)
+		} else {
+			for _, o := range orders {
+				filled, _ := decimal.NewFromString(o.ExecutedQuantity)
+				b.observe(orderObservation{
+					OrderID:  o.OrderId,
+					Status:   o.Status,
+					Filled:   filled,
+					AvgPrice: decValue(o.ExecutedPrice),
+					Msg:      o.Msg,
+				})
+			}
+		}
+	}
+
+	b.mu.Lock()
+	events := b.events
+	b.events = nil
+	b.mu.Unlock()
+
+	// Fees are only final once the order is done
+	for i := range events {
+		if events[i].Order.Status != StatusFilled {
+			continue
+		}
+		d, err := b.tc.OrderDetail(ctx, events[i].Order.OrderID)
+		if err != nil {
+			log.Printf("order fee lookup %s: %v", events[i].Order.OrderID, err)
+			continue
+		}
+		events[i].Order.Fees = d.ChargeDetail.TotalAmount.String()
+		events[i].Fee = events[i].Order.Fees
+	}
+
+	return events
+}
+
+// handlePush is the TradeContext order-changed callback.
+func (b *LongbridgeBroker) handlePush(ev *trade.PushEvent) {
+	if ev == nil || ev.Data == nil {
+		return
+	}
+	d := ev.Data
+	b.observe(orderObservation{
+		OrderID:  d.OrderId,
+		Status:   d.Status,
+		Filled:   decValue(d.ExecutedQuantity),
+		AvgPrice: decValue(d.ExecutedPrice),
+		Msg:      d.Msg,
+	})
+}
+
+// observe compares an observed order state with the tracked one and queues
+// an event when the fill quantity grew or the order reached a final state.
+func (b *LongbridgeBroker) observe(obs orderObservation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.tracked[obs.OrderID]
+	if !ok {
+		return // not placed (or recovered) by this controller
+	}
+
+	status := StatusFromSDK(obs.Status)
+	delta := obs.Filled.Sub(t.filled)
+	terminal := status != StatusSubmitted && status != StatusPartialFill
+	if !delta.IsPositive() && !terminal {
+		return
+	}
+
+	ev := OrderEvent{FillQty: "0"}
+	if delta.IsPositive() {
+		// Price of this fill from the change in cumulative notional
+		notional := obs.AvgPrice.Mul(obs.Filled).Sub(t.avg.Mul(t.filled))
+		ev.FillQty = delta.String()
+		ev.FillPrice = notional.Div(delta).Round(4).String()
+		t.filled = obs.Filled
+		t.avg = obs.AvgPrice
+	}
+
+	if status == StatusSubmitted {
+		status = StatusPartialFill // fills reported before the status caught up
+	}
+	t.info.Status = status
+	t.info.FilledQty = t.filled.String()
+	if t.filled.IsPositive() {
+		t.info.AvgPrice = t.avg.String()
+	}
+	t.info.Msg = obs.Msg
+	ev.Order = t.info
+	b.events = append(b.events, ev)
+
+	if terminal {
+		delete(b.tracked, obs.OrderID)
+	}
+}
+
+// OrdersByRemark implements Reconciler. Orders without a remark are
+// skipped; of several sharing one (algo slices), the first is kept.
+func (b *LongbridgeBroker) OrdersByRemark(ctx context.Context) (map[string]*OrderInfo, error) {
+	orders, err := b.tc.TodayOrders(ctx, &trade.GetTodayOrders{})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*OrderInfo, len(orders))
+	for _, o := range orders {
+		if o.Remark == "" || out[o.Remark] != nil {
+			continue
+		}
+		filled, _ := decimal.NewFromString(o.ExecutedQuantity)
+		info := &OrderInfo{
+			OrderID:   o.OrderId,
+			Symbol:    o.Symbol,
+			Side:      sideFromSDK(o.Side),
+			Status:    StatusFromSDK(o.Status),
+			Qty:       o.Quantity,
+			FilledQty: filled.String(),
+			Price:     decString(o.Price),
+			Remark:    o.Remark,
+			Msg:       o.Msg,
+		}
+		if filled.IsPositive() {
+			info.AvgPrice = decString(o.ExecutedPrice)
+		}
+		out[o.Remark] = info
+	}
+	return out, nil
+}
+
+// Cancel implements Broker.
+func (b *LongbridgeBroker) Cancel(ctx context.Context, orderID string) error {
+	return b.tc.CancelOrder(ctx, orderID)
+}
+
+// Replace implements Broker.
+func (b *LongbridgeBroker) Replace(ctx context.Context, req ReplaceRequest) error {
+	qty, err := strconv.ParseUint(req.Qty, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid qty %q: %w", req.Qty, err)
+	}
+
+	r := &trade.ReplaceOrder{
+		OrderId:  req.OrderID,
+		Quantity: qty,
+		Remark:   req.Remark,
+	}
+	if req.Price != "" {
+		p, err := decimal.NewFromString(req.Price)
+		if err != nil {
+			return fmt.Errorf("invalid price %q: %w", req.Price, err)
+		}
+		r.Price = p
+	}
+	for _, f := range []struct {
+		name string
+		v    string
+		dst  *decimal.Decimal
+	}{
+		{"trigger_price", req.TriggerPrice, &r.TriggerPrice},
+		{"trailing_amount", req.TrailingAmount, &r.TrailingAmount},
+		{"trailing_percent", req.TrailingPercent, &r.TrailingPercent},
+		{"limit_offset", req.LimitOffset, &r.LimitOffset},
+	} {
+		if f.v == "" {
+			continue
+		}
+		p, err := decimal.NewFromString(f.v)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", f.name, f.v, err)
+		}
+		*f.dst = p
+	}
+
+	if err := b.tc.ReplaceOrder(ctx, r); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	if t, ok := b.tracked[req.OrderID]; ok {
+		t.info.Qty = req.Qty
+	}
+	b.mu.Unlock()
+	return nil
+}
+
+// QueryOrder implements Broker.
+func (b *LongbridgeBroker) QueryOrder(ctx context.Context, orderID string) (*OrderInfo, error) {
+	d, err := b.tc.OrderDetail(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	info := &OrderInfo{
+		OrderID:   d.OrderId,
+		Symbol:    d.Symbol,
+		Side:      sideFromSDK(d.Side),
+		Status:    StatusFromSDK(d.Status),
+		Qty:       strconv.FormatInt(d.Quantity, 10),
+		FilledQty: strconv.FormatInt(d.ExecutedQuantity, 10),
+		Price:     decString(d.Price),
+		Remark:    d.Remark,
+		Msg:       d.Msg,
+	}
+	if d.ExecutedQuantity > 0 {
+		info.AvgPrice = decString(d.ExecutedPrice)
+	}
+	return info, nil
+}
+
+// ListFills implements Broker.
+func (b *LongbridgeBroker) ListFills(ctx context.Context, orderID string) ([]Fill, error) {
+	execs, err := b.tc.TodayExecutions(ctx, &trade.GetTodayExecutions{OrderId: orderID})
+	if err != nil {
+		return nil, err
+	}
+	fills := make([]Fill, 0, len(execs))
+	for _, e := range execs {
+		fills = append(fills, Fill{
+			OrderID: e.OrderId,
+			TradeID: e.TradeId,
+			Symbol:  e.Symbol,
+			Qty:     e.Quantity,
+			Price:   decString(e.Price),
+			Time:    e.TradeDoneAt,
+		})
+	}
+	return fills, nil
+}
+
+// StatusFromSDK maps an SDK order status to one of the Status* constants.
+func StatusFromSDK(s trade.OrderStatus) string {
+	switch s {
+	case trade.OrderFilledStatus:
+		return StatusFilled
+	case trade.OrderPartialFilledStatus:
+		return StatusPartialFill
+	case trade.OrderCanceledStatus, trade.OrderPartialWithdrawal:
+		return StatusCancelled
+	case trade.OrderRejectedStatus:
+		return StatusRejected
+	case trade.OrderExpiredStatus:
+		return StatusExpired
+	default:
+		return StatusSubmitted
+	}
+}
+
+// sideFromSDK converts an SDK OrderSide back to the ledger's BUY/SELL.
+func sideFromSDK(s trade.OrderSide) string {
+	switch s {
+	case trade.OrderSideSell:
+		return "SELL"
+	default:
+		return "BUY"
+	}
+}
+
+// decValue dereferences a decimal pointer, returning zero for nil.
+func decValue(d *decimal.Decimal) decimal.Decimal {
+	if d == nil {
+		return decimal.Zero
+	}
+	return *d
+}
+
+// decString formats a decimal pointer, returning "" for nil.
+func decString(d *decimal.Decimal) string {
+	if d == nil {
+		return ""
+	}
+	return d.String()
+}
@@ -0,0 +1,84 @@
+package broker
+
+import (
+	"testing"
+
+	"longbridge-fs/internal/model"
+
+	"github.com/longbridge/openapi-go/trade"
+	"github.com/shopspring/decimal"
+)
+
+func TestLongbridgeObserveFills(t *testing.T) {
+	b := NewLongbridgeBroker(nil)
+	b.Track(OrderInfo{OrderID: "1001", IntentID: "lc-1", Symbol: "AAPL.US", Side: "BUY", Qty: "300", Status: StatusSubmitted})
+
+	// Acknowledged, nothing filled: no event
+	b.observe(orderObservation{OrderID: "1001", Status: trade.OrderNewStatus})
+	if len(b.events) != 0 {
+		t.Fatalf("expected no event for NEW status, got %d", len(b.events))
+	}
+
+	// 100 @ 180, then 200 more for a 181 average -> second fill at 181.5
+	b.observe(orderObservation{OrderID: "1001", Status: trade.OrderPartialFilledStatus,
+		Filled: decimal.NewFromInt(100), AvgPrice: decimal.NewFromInt(180)})
+	b.observe(orderObservation{OrderID: "1001", Status: trade.OrderFilledStatus,
+		Filled: decimal.NewFromInt(300), AvgPrice: decimal.NewFromInt(181)})
+
+	// Duplicate push after completion is ignored
+	b.observe(orderObservation{OrderID: "1001", Status: trade.OrderFilledStatus,
+		Filled: decimal.NewFromInt(300), AvgPrice: decimal.NewFromInt(181)})
+
+	if len(b.events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(b.events))
+	}
+	first, second := b.events[0], b.events[1]
+	if first.Order.Status != StatusPartialFill || first.FillQty != "100" || first.FillPrice != "180" {
+		t.Errorf("unexpected first event: %+v", first)
+	}
+	if second.Order.Status != StatusFilled || second.FillQty != "200" || second.FillPrice != "181.5" {
+		t.Errorf("unexpected second event: %+v", second)
+	}
+	if second.Order.IntentID != "lc-1" || second.Order.FilledQty != "300" {
+		t.Errorf("event not keyed by intent: %+v", second.Order)
+	}
+}
+
+func TestWorkingOrdersFromLedger(t *testing.T) {
+	entry := func(typ, orderID, status, filled string) model.Entry {
+		return model.Entry{Type: typ, Meta: map[string]string{
+			"order_id": orderID, "intent_id": "i-" + orderID, "status": status, "filled_qty": filled,
+		}}
+	}
+	working := WorkingOrders([]model.Entry{
+		entry("SUBMITTED", "A", StatusSubmitted, ""),
+		entry("SUBMITTED", "B", StatusSubmitted, ""),
+		entry("EXECUTION", "B", StatusPartialFill, "50"),
+		entry("SUBMITTED", "C", StatusSubmitted, ""),
+		entry("EXECUTION", "C", StatusFilled, "10"),
+	})
+
+	if len(working) != 2 || working[0].OrderID != "A" || working[1].OrderID != "B" {
+		t.Fatalf("expected working orders A and B, got %+v", working)
+	}
+	if working[1].FilledQty != "50" {
+		t.Errorf("expected B filled 50, got %s", working[1].FilledQty)
+	}
+}
+
+func TestOrderRemark(t *testing.T) {
+	tests := []struct {
+		o    model.ParsedOrder
+		want string
+	}{
+		{model.ParsedOrder{IntentID: "r-1"}, RemarkPrefix + "r-1"},
+		{model.ParsedOrder{IntentID: "r-1", Remark: "mine"}, "mine"},
+		{model.ParsedOrder{Remark: "mine"}, "mine"},
+		{model.ParsedOrder{}, ""}, // CLI order without --remark
+	}
+	for _, tt := range tests {
+		if got := orderRemark(tt.o); got != tt.want {
+			t.Errorf("orderRemark(%+v) = %q, want %q", tt.o, got, tt.want)
+		}
+	}
+}
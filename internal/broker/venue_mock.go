@@ -0,0 +1,117 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"longbridge-fs/internal/model"
+)
+
+// MockBroker fills every order instantly. It backs --mock mode and tests.
+type MockBroker struct {
+	mu     sync.Mutex
+	orders map[string]*OrderInfo
+	fills  map[string][]Fill
+}
+
+// NewMockBroker creates an empty in-memory mock broker.
+func NewMockBroker() *MockBroker {
+	return &MockBroker{
+		orders: make(map[string]*OrderInfo),
+		fills:  make(map[string][]Fill),
+	}
+}
+
+// Submit implements Broker.
+func (b *MockBroker) Submit(ctx context.Context, o model.ParsedOrder) (*OrderInfo, error) {
+	orderID, price := ExecuteOrderMock(o)
+
+	info := &OrderInfo{
+		OrderID:   orderID,
+		IntentID:  o.IntentID,
+		Symbol:    o.Symbol,
+		Side:      o.Side,
+		Status:    StatusFilled,
+		Qty:       o.Qty,
+		FilledQty: o.Qty,
+		Price:     price,
+		AvgPrice:  price,
+		Remark:    RemarkPrefix + o.IntentID,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.orders[orderID] = info
+	b.fills[orderID] = []Fill{{
+		OrderID: orderID,
+		TradeID: orderID + "-1",
+		Symbol:  o.Symbol,
+		Qty:     o.Qty,
+		Price:   price,
+		Time:    time.Now(),
+	}}
+
+	copied := *info
+	return &copied, nil
+}
+
+// Cancel implements Broker. Orders that already filled cannot be cancelled.
+func (b *MockBroker) Cancel(ctx context.Context, orderID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, ok := b.orders[orderID]
+	if !ok {
+		// Unknown IDs are accepted so CANCEL entries work without prior state.
+		return nil
+	}
+	if info.Status == StatusFilled {
+		return fmt.Errorf("order %s already filled", orderID)
+	}
+	info.Status = StatusCancelled
+	return nil
+}
+
+// Replace implements Broker.
+func (b *MockBroker) Replace(ctx context.Context, req ReplaceRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, ok := b.orders[req.OrderID]
+	if !ok {
+		return nil
+	}
+	if info.Status == StatusFilled {
+		return fmt.Errorf("order %s already filled", req.OrderID)
+	}
+	if req.Qty != "" {
+		info.Qty = req.Qty
+	}
+	if req.Price != "" {
+		info.Price = req.Price
+	}
+	return nil
+}
+
+// QueryOrder implements Broker.
+func (b *MockBroker) QueryOrder(ctx context.Context, orderID string) (*OrderInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, ok := b.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+	copied := *info
+	return &copied, nil
+}
+
+// ListFills implements Broker.
+func (b *MockBroker) ListFills(ctx context.Context, orderID string) ([]Fill, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Fill(nil), b.fills[orderID]...), nil
+}
@@ -0,0 +1,637 @@
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/market"
+	"longbridge-fs/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// PaperConfig is the JSON structure for /trade/paper.json.
+type PaperConfig struct {
+	SlippageBps        float64 `json:"slippage_bps"`         // adverse slippage applied to every fill
+	CommissionPerShare float64 `json:"commission_per_share"` // per-share commission
+	CommissionPct      float64 `json:"commission_pct"`       // commission as a fraction of notional
+	CommissionMin      float64 `json:"commission_min"`       // minimum commission per fill
+	MaxVolumePct       float64 `json:"max_volume_pct"`       // max share of the latest minute bar volume per fill, 0=unlimited
+}
+
+// DefaultPaperConfig is used when /trade/paper.json is absent.
+var DefaultPaperConfig = PaperConfig{
+	SlippageBps:        5,
+	CommissionPerShare: 0.005,
+	CommissionMin:      1.0,
+	MaxVolumePct:       0.1,
+}
+
+// paperOrder is one order known to the paper exchange, persisted in
+// /trade/paper/orders.json so resting orders survive a controller restart.
+type paperOrder struct {
+	OrderID    string  `json:"order_id"`
+	IntentID   string  `json:"intent_id"`
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"`
+	Type       string  `json:"type"`
+	TIF        string  `json:"tif"`
+	ExpireDate string  `json:"expire_date,omitempty"`
+	LimitPrice float64 `json:"limit_price,omitempty"`
+	// LIT/MIT orders wait until the reference price touches TriggerPrice,
+	// from above or below depending on where the price was at submission.
+	TriggerPrice float64 `json:"trigger_price,omitempty"`
+	TriggerAbove bool    `json:"trigger_above,omitempty"`
+	Triggered    bool    `json:"triggered,omitempty"`
+	// TSLPAMT/TSLPPCT trail Extreme (the best price since submission) and
+	// turn into a limit LimitOffset beyond the stop once it is hit.
+	TrailingAmount  float64 `json:"trailing_amount,omitempty"`
+	TrailingPercent float64 `json:"trailing_percent,omitempty"`
+	LimitOffset     float64 `json:"limit_offset,omitempty"`
+	Extreme         float64 `json:"extreme,omitempty"`
+
+	Qty         int64   `json:"qty"`
+	FilledQty   int64   `json:"filled_qty"`
+	Notional    float64 `json:"notional"`
+	Fees        float64 `json:"fees"`
+	Status      string  `json:"status"`
+	TradeDate   string  `json:"trade_date"`
+	SubmittedAt string  `json:"submitted_at"`
+	LastQuoteAt string  `json:"last_quote_at,omitempty"`
+	Fills       []Fill  `json:"fills,omitempty"`
+	GroupID     string  `json:"group_id,omitempty"`
+}
+
+// PaperBroker is a local paper exchange used in --mock mode. It matches
+// orders against the quote files under /quote/hold/{SYMBOL}/:
+//
+//   - MARKET fills at the reference price plus slippage
+//   - LIMIT/ELO rest until the reference price crosses the limit
+//   - ALO is matched once against the day's open, then rests as a limit
+//   - LIT/MIT wait until the price touches trigger_price, then behave as
+//     LIMIT/MARKET
+//   - TSLPAMT/TSLPPCT trail the best price by an amount or percentage and
+//     become a limit order limit_offset beyond the stop when it is hit
+//   - fills are capped at max_volume_pct of the latest minute bar, so large
+//     orders fill partially across quote updates
+//   - DAY orders expire when the trading date rolls over, GTD orders after
+//     their expire_date; GTC orders rest until cancelled
+//
+// The reference price is overview.json "last", falling back to the latest
+// intraday.json point and finally the last close in D.json.
+type PaperBroker struct {
+	root      string
+	quoteRoot string
+	cfg       PaperConfig
+	mu        sync.Mutex
+	orders    map[string]*paperOrder
+	events    []OrderEvent
+	seq       int64
+	now       func() time.Time
+}
+
+// NewPaperBroker loads /trade/paper.json and any persisted paper orders of
+// the account at root. Reference prices are read under quoteRoot, the FS root.
+func NewPaperBroker(root, quoteRoot string) (*PaperBroker, error) {
+	b := &PaperBroker{
+		root:      root,
+		quoteRoot: quoteRoot,
+		cfg:       DefaultPaperConfig,
+		orders:    make(map[string]*paperOrder),
+		now:       time.Now,
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, "trade", "paper.json"))
+	if err == nil {
+		if err := json.Unmarshal(data, &b.cfg); err != nil {
+			return nil, fmt.Errorf("parse paper.json: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err = os.ReadFile(b.ordersPath())
+	if err == nil {
+		var orders []*paperOrder
+		if err := json.Unmarshal(data, &orders); err != nil {
+			return nil, fmt.Errorf("parse paper orders: %w", err)
+		}
+		for _, po := range orders {
+			b.orders[po.OrderID] = po
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Submit implements Broker. The order is matched once immediately; whatever
+// is not filled rests and is reported later through DrainEvents.
+func (b *PaperBroker) Submit(ctx context.Context, o model.ParsedOrder) (*OrderInfo, error) {
+	if err := ledger.ValidateOrder(o); err != nil {
+		return nil, err
+	}
+	qty, err := strconv.ParseInt(o.Qty, 10, 64)
+	if err != nil || qty <= 0 {
+		return nil, fmt.Errorf("invalid qty %q", o.Qty)
+	}
+
+	sym := ledger.FullSymbol(o.Symbol, o.Market)
+	orderType := string(MapOrderType(o.OrderType))
+
+	switch orderType {
+	case "MO", "LO", "ELO", "ALO", "LIT", "MIT", "TSLPAMT", "TSLPPCT":
+	default:
+		return nil, fmt.Errorf("PAPER_UNSUPPORTED: order type %s is not simulated", o.OrderType)
+	}
+
+	var limit float64
+	if orderType == "LO" || orderType == "ELO" || orderType == "ALO" || orderType == "LIT" {
+		limit, err = strconv.ParseFloat(o.Price, 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("%s order requires a positive price, got %q", o.OrderType, o.Price)
+		}
+	}
+
+	var trigger float64
+	if orderType == "LIT" || orderType == "MIT" {
+		trigger, err = strconv.ParseFloat(o.TriggerPrice, 64)
+		if err != nil || trigger <= 0 {
+			return nil, fmt.Errorf("%s order requires a positive trigger_price, got %q", o.OrderType, o.TriggerPrice)
+		}
+	}
+
+	var trailAmt, trailPct, offset float64
+	switch orderType {
+	case "TSLPAMT":
+		trailAmt, err = strconv.ParseFloat(o.TrailingAmount, 64)
+		if err != nil || trailAmt <= 0 {
+			return nil, fmt.Errorf("TSLPAMT order requires a positive trailing_amount, got %q", o.TrailingAmount)
+		}
+	case "TSLPPCT":
+		trailPct, err = strconv.ParseFloat(o.TrailingPercent, 64)
+		if err != nil || trailPct <= 0 || trailPct >= 100 {
+			return nil, fmt.Errorf("TSLPPCT order requires a trailing_percent in (0, 100), got %q", o.TrailingPercent)
+		}
+	}
+	if o.LimitOffset != "" {
+		offset, _ = strconv.ParseFloat(o.LimitOffset, 64)
+	}
+
+	ref, _, haveQuote := b.referencePrice(sym)
+	if orderType == "MO" && !haveQuote {
+		return nil, fmt.Errorf("PAPER_NO_QUOTE: no reference price for %s under quote/hold/", sym)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.seq++
+	po := &paperOrder{
+		OrderID:         fmt.Sprintf("PAPER-%d-%d", now.UnixNano(), b.seq),
+		IntentID:        o.IntentID,
+		Symbol:          sym,
+		Side:            strings.ToUpper(o.Side),
+		Type:            orderType,
+		TIF:             strings.ToUpper(o.TIF),
+		ExpireDate:      o.ExpireDate,
+		LimitPrice:      limit,
+		Qty:             qty,
+		GroupID:         o.GroupID,
+		TrailingAmount:  trailAmt,
+		TrailingPercent: trailPct,
+		LimitOffset:     offset,
+		Status:          StatusSubmitted,
+		TradeDate:       now.Format("2006-01-02"),
+		SubmittedAt:     now.Format(time.RFC3339),
+	}
+	if trigger > 0 {
+		po.TriggerPrice = trigger
+		if haveQuote {
+			po.TriggerAbove = ref < trigger
+		} else {
+			// No quote yet: assume a buy stop above / sell stop below the market
+			po.TriggerAbove = po.Side == "BUY"
+		}
+	}
+	b.orders[po.OrderID] = po
+
+	b.match(po, true)
+	b.save()
+
+	info := po.info()
+	return &info, nil
+}
+
+// Cancel implements Broker.
+func (b *PaperBroker) Cancel(ctx context.Context, orderID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	po, ok := b.orders[orderID]
+	if !ok {
+		return fmt.Errorf("order %s not found", orderID)
+	}
+	if !po.open() {
+		return fmt.Errorf("order %s is %s", orderID, po.Status)
+	}
+	po.Status = StatusCancelled
+	b.events = append(b.events, OrderEvent{Order: po.info(), FillQty: "0"})
+	b.save()
+	return nil
+}
+
+// Replace implements Broker.
+func (b *PaperBroker) Replace(ctx context.Context, req ReplaceRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	po, ok := b.orders[req.OrderID]
+	if !ok {
+		return fmt.Errorf("order %s not found", req.OrderID)
+	}
+	if !po.open() {
+		return fmt.Errorf("order %s is %s", req.OrderID, po.Status)
+	}
+	if req.Qty != "" {
+		qty, err := strconv.ParseInt(req.Qty, 10, 64)
+		if err != nil || qty < po.FilledQty {
+			return fmt.Errorf("invalid qty %q (filled %d)", req.Qty, po.FilledQty)
+		}
+		po.Qty = qty
+	}
+	if req.Price != "" {
+		p, err := strconv.ParseFloat(req.Price, 64)
+		if err != nil || p <= 0 {
+			return fmt.Errorf("invalid price %q", req.Price)
+		}
+		po.LimitPrice = p
+	}
+	if !po.Triggered {
+		for _, f := range []struct {
+			name string
+			v    string
+			dst  *float64
+		}{
+			{"trigger_price", req.TriggerPrice, &po.TriggerPrice},
+			{"trailing_amount", req.TrailingAmount, &po.TrailingAmount},
+			{"trailing_percent", req.TrailingPercent, &po.TrailingPercent},
+			{"limit_offset", req.LimitOffset, &po.LimitOffset},
+		} {
+			if f.v == "" {
+				continue
+			}
+			p, err := strconv.ParseFloat(f.v, 64)
+			if err != nil || p < 0 {
+				return fmt.Errorf("invalid %s %q", f.name, f.v)
+			}
+			*f.dst = p
+		}
+	}
+	b.save()
+	return nil
+}
+
+// QueryOrder implements Broker.
+func (b *PaperBroker) QueryOrder(ctx context.Context, orderID string) (*OrderInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	po, ok := b.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+	info := po.info()
+	return &info, nil
+}
+
+// ListFills implements Broker.
+func (b *PaperBroker) ListFills(ctx context.Context, orderID string) ([]Fill, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	po, ok := b.orders[orderID]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", orderID)
+	}
+	return append([]Fill(nil), po.Fills...), nil
+}
+
+// DrainEvents implements EventSource. It expires stale DAY orders, matches
+// resting orders against the current quote files and returns every change.
+func (b *PaperBroker) DrainEvents(ctx context.Context) []OrderEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	today := b.now().Format("2006-01-02")
+
+	ids := make([]string, 0, len(b.orders))
+	for id := range b.orders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		po := b.orders[id]
+		if !po.open() {
+			continue
+		}
+		if po.expired(today) {
+			po.Status = StatusExpired
+			b.events = append(b.events, OrderEvent{Order: po.info(), FillQty: "0"})
+			continue
+		}
+		b.match(po, false)
+	}
+
+	events := b.events
+	b.events = nil
+	if len(events) > 0 {
+		b.save()
+	}
+	return events
+}
+
+// OrdersByRemark implements Reconciler with the orders of today's trade date
+// and those still working.
+func (b *PaperBroker) OrdersByRemark(ctx context.Context) (map[string]*OrderInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	today := b.now().Format("2006-01-02")
+	out := make(map[string]*OrderInfo)
+	for _, po := range b.orders {
+		if po.TradeDate != today && !po.open() {
+			continue
+		}
+		info := po.info()
+		if prev := out[info.Remark]; prev == nil || info.OrderID < prev.OrderID {
+			out[info.Remark] = &info
+		}
+	}
+	return out, nil
+}
+
+// Track implements EventSource. The paper book is persisted on its own, so
+// orders it does not know about belong to another venue and are ignored.
+func (b *PaperBroker) Track(info OrderInfo) {}
+
+// match tries to fill po against the current quote. Fills found on the
+// initial match are returned through Submit; later ones become events.
+func (b *PaperBroker) match(po *paperOrder, initial bool) {
+	holdDir := market.HoldDir(b.quoteRoot, po.Symbol)
+	ref, quoteAt, ok := b.referencePrice(po.Symbol)
+	if !ok {
+		return
+	}
+
+	// Auction orders only see the opening price on their first match
+	if po.Type == "ALO" && initial {
+		if ov := market.ReadOverview(holdDir); ov != nil && ov.Open > 0 {
+			ref = ov.Open
+		}
+	}
+
+	// Each quote snapshot provides liquidity once
+	if !initial && quoteAt != "" && quoteAt == po.LastQuoteAt {
+		return
+	}
+
+	switch {
+	case po.Triggered:
+	case po.TrailingAmount > 0 || po.TrailingPercent > 0:
+		if !po.trail(ref) {
+			return
+		}
+	case po.TriggerPrice > 0:
+		if po.TriggerAbove && ref < po.TriggerPrice || !po.TriggerAbove && ref > po.TriggerPrice {
+			return
+		}
+		po.Triggered = true
+	}
+
+	price := b.applySlippage(po.Side, ref)
+	if po.Type != "MO" && po.Type != "MIT" {
+		if po.Side == "BUY" && ref > po.LimitPrice {
+			return
+		}
+		if po.Side == "SELL" && ref < po.LimitPrice {
+			return
+		}
+		// Never fill worse than the limit
+		if po.Side == "BUY" {
+			price = math.Min(price, po.LimitPrice)
+		} else {
+			price = math.Max(price, po.LimitPrice)
+		}
+	}
+
+	qty := po.Qty - po.FilledQty
+	if maxQty := b.liquidity(holdDir); maxQty > 0 && qty > maxQty {
+		qty = maxQty
+	}
+	if qty <= 0 {
+		return
+	}
+
+	price = roundPrice(price)
+	fee := b.commission(qty, price)
+
+	po.FilledQty += qty
+	po.Notional += float64(qty) * price
+	po.Fees += fee
+	po.LastQuoteAt = quoteAt
+	po.Fills = append(po.Fills, Fill{
+		OrderID: po.OrderID,
+		TradeID: fmt.Sprintf("%s-%d", po.OrderID, len(po.Fills)+1),
+		Symbol:  po.Symbol,
+		Qty:     strconv.FormatInt(qty, 10),
+		Price:   formatFloat(price),
+		Time:    b.now(),
+	})
+	if po.FilledQty >= po.Qty {
+		po.Status = StatusFilled
+	} else {
+		po.Status = StatusPartialFill
+	}
+
+	if !initial {
+		b.events = append(b.events, OrderEvent{
+			Order:     po.info(),
+			FillQty:   strconv.FormatInt(qty, 10),
+			FillPrice: formatFloat(price),
+			Fee:       formatFloat(fee),
+		})
+	}
+}
+
+// referencePrice resolves the price the paper exchange trades at, plus a
+// token identifying the quote snapshot it came from.
+func (b *PaperBroker) referencePrice(sym string) (float64, string, bool) {
+	holdDir := market.HoldDir(b.quoteRoot, sym)
+	if ov := market.ReadOverview(holdDir); ov != nil && ov.Last > 0 {
+		return ov.Last, ov.UpdatedAt, true
+	}
+	if pts := market.ReadIntraday(holdDir); len(pts) > 0 && pts[len(pts)-1].Price > 0 {
+		last := pts[len(pts)-1]
+		return last.Price, last.Time, true
+	}
+	if sticks := market.ReadCandlesticks(holdDir, "D"); len(sticks) > 0 && sticks[len(sticks)-1].Close > 0 {
+		last := sticks[len(sticks)-1]
+		return last.Close, last.Date, true
+	}
+	return 0, "", false
+}
+
+// liquidity returns the max quantity one match may fill, 0 for unlimited.
+func (b *PaperBroker) liquidity(holdDir string) int64 {
+	if b.cfg.MaxVolumePct <= 0 {
+		return 0
+	}
+	pts := market.ReadIntraday(holdDir)
+	if len(pts) == 0 || pts[len(pts)-1].Volume <= 0 {
+		return 0
+	}
+	maxQty := int64(float64(pts[len(pts)-1].Volume) * b.cfg.MaxVolumePct)
+	if maxQty < 1 {
+		maxQty = 1
+	}
+	return maxQty
+}
+
+func (b *PaperBroker) applySlippage(side string, ref float64) float64 {
+	slip := ref * b.cfg.SlippageBps / 10000
+	if side == "SELL" {
+		return ref - slip
+	}
+	return ref + slip
+}
+
+func (b *PaperBroker) commission(qty int64, price float64) float64 {
+	fee := float64(qty)*b.cfg.CommissionPerShare + float64(qty)*price*b.cfg.CommissionPct
+	if fee < b.cfg.CommissionMin {
+		fee = b.cfg.CommissionMin
+	}
+	return roundPrice(fee)
+}
+
+func (b *PaperBroker) ordersPath() string {
+	return filepath.Join(b.root, "trade", "paper", "orders.json")
+}
+
+// save persists open orders plus today's closed ones, replacing the file
+// atomically so a crash never leaves a truncated book. Errors are logged only:
+// the in-memory book stays authoritative for the running controller.
+func (b *PaperBroker) save() {
+	today := b.now().Format("2006-01-02")
+	orders := make([]*paperOrder, 0, len(b.orders))
+	for _, po := range b.orders {
+		if po.open() || po.TradeDate == today {
+			orders = append(orders, po)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].OrderID < orders[j].OrderID })
+
+	data, err := json.MarshalIndent(orders, "", "  ")
+	if err != nil {
+		log.Printf("paper: marshal orders: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(b.ordersPath()), 0755); err != nil {
+		log.Printf("paper: %v", err)
+		return
+	}
+	if err := ledger.WriteFileAtomic(b.ordersPath(), append(data, '\n'), 0644); err != nil {
+		log.Printf("paper: write orders: %v", err)
+	}
+}
+
+// trail moves a trailing stop with the market and reports whether ref has
+// pulled back far enough to trigger it; the limit is then set off the stop.
+func (po *paperOrder) trail(ref float64) bool {
+	if po.Extreme == 0 || po.Side == "SELL" && ref > po.Extreme || po.Side == "BUY" && ref < po.Extreme {
+		po.Extreme = ref
+	}
+	dist := po.TrailingAmount
+	if po.TrailingPercent > 0 {
+		dist = po.Extreme * po.TrailingPercent / 100
+	}
+
+	if po.Side == "SELL" {
+		po.TriggerPrice = roundPrice(po.Extreme - dist)
+		if ref > po.TriggerPrice {
+			return false
+		}
+		po.LimitPrice = roundPrice(po.TriggerPrice - po.LimitOffset)
+	} else {
+		po.TriggerPrice = roundPrice(po.Extreme + dist)
+		if ref < po.TriggerPrice {
+			return false
+		}
+		po.LimitPrice = roundPrice(po.TriggerPrice + po.LimitOffset)
+	}
+	po.Triggered = true
+	return true
+}
+
+// expired reports whether a working order has outlived its time in force:
+// DAY orders end with their trade date, GTD orders after expire_date.
+func (po *paperOrder) expired(today string) bool {
+	switch po.TIF {
+	case "GTC":
+		return false
+	case "GTD":
+		return po.ExpireDate != "" && today > po.ExpireDate
+	default:
+		return po.TradeDate != today
+	}
+}
+
+func (po *paperOrder) open() bool {
+	return po.Status == StatusSubmitted || po.Status == StatusPartialFill
+}
+
+func (po *paperOrder) info() OrderInfo {
+	info := OrderInfo{
+		OrderID:   po.OrderID,
+		IntentID:  po.IntentID,
+		Symbol:    po.Symbol,
+		Side:      po.Side,
+		Status:    po.Status,
+		Qty:       strconv.FormatInt(po.Qty, 10),
+		FilledQty: strconv.FormatInt(po.FilledQty, 10),
+		Fees:      formatFloat(po.Fees),
+		Remark:    RemarkPrefix + po.IntentID,
+		GroupID:   po.GroupID,
+	}
+	if po.LimitPrice > 0 {
+		info.Price = formatFloat(po.LimitPrice)
+	}
+	if po.FilledQty > 0 {
+		info.AvgPrice = formatFloat(roundPrice(po.Notional / float64(po.FilledQty)))
+		info.Price = info.AvgPrice
+	}
+	return info
+}
+
+func roundPrice(f float64) float64 {
+	v, _ := decimal.NewFromFloat(f).Round(4).Float64()
+	return v
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,235 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"longbridge-fs/internal/model"
+)
+
+func writeQuote(t *testing.T, root, symbol, overview, intraday string) {
+	t.Helper()
+	dir := filepath.Join(root, "quote", "hold", symbol)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "overview.json"), []byte(overview), 0644); err != nil {
+		t.Fatalf("write overview: %v", err)
+	}
+	if intraday != "" {
+		if err := os.WriteFile(filepath.Join(dir, "intraday.json"), []byte(intraday), 0644); err != nil {
+			t.Fatalf("write intraday: %v", err)
+		}
+	}
+}
+
+func TestPaperLimitRestsUntilCrossed(t *testing.T) {
+	root := t.TempDir()
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":185.00,"updated_at":"t1"}`, "")
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+
+	ctx := context.Background()
+	info, err := b.Submit(ctx, model.ParsedOrder{
+		IntentID: "p-1", Side: "BUY", Symbol: "AAPL", Market: "US",
+		Qty: "100", OrderType: "LIMIT", Price: "180.00", TIF: "DAY",
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if info.Status != StatusSubmitted {
+		t.Fatalf("expected resting order, got %s", info.Status)
+	}
+	if evs := b.DrainEvents(ctx); len(evs) != 0 {
+		t.Fatalf("expected no events before price crosses, got %d", len(evs))
+	}
+
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":179.50,"updated_at":"t2"}`, "")
+	evs := b.DrainEvents(ctx)
+	if len(evs) != 1 || evs[0].Order.Status != StatusFilled {
+		t.Fatalf("expected one FILLED event, got %+v", evs)
+	}
+	if evs[0].FillPrice != "179.5" || evs[0].FillQty != "100" {
+		t.Errorf("unexpected fill %s @ %s", evs[0].FillQty, evs[0].FillPrice)
+	}
+}
+
+func TestPaperPartialFillsAndExpiry(t *testing.T) {
+	root := t.TempDir()
+	writeQuote(t, root, "TSLA.US", `{"symbol":"TSLA.US","last":250.00,"updated_at":"t1"}`,
+		`[{"time":"10:00","price":250.00,"volume":1000,"avg_price":250.00}]`)
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{SlippageBps: 10, CommissionMin: 1, MaxVolumePct: 0.1}
+
+	ctx := context.Background()
+	info, err := b.Submit(ctx, model.ParsedOrder{
+		IntentID: "p-2", Side: "BUY", Symbol: "TSLA", Market: "US",
+		Qty: "300", OrderType: "MARKET", TIF: "DAY",
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if info.Status != StatusPartialFill || info.FilledQty != "100" {
+		t.Fatalf("expected 100 partially filled, got %s %s", info.Status, info.FilledQty)
+	}
+	if info.AvgPrice != "250.25" {
+		t.Errorf("expected slippage-adjusted price 250.25, got %s", info.AvgPrice)
+	}
+
+	// Same quote snapshot: no new liquidity
+	if evs := b.DrainEvents(ctx); len(evs) != 0 {
+		t.Fatalf("expected no fill on unchanged quote, got %d", len(evs))
+	}
+
+	// Resting state survives a restart
+	reloaded, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	got, err := reloaded.QueryOrder(ctx, info.OrderID)
+	if err != nil || got.FilledQty != "100" {
+		t.Fatalf("expected persisted partial order, got %+v err=%v", got, err)
+	}
+
+	// Next trading day: DAY order expires with the remainder unfilled
+	reloaded.now = func() time.Time { return time.Now().AddDate(0, 0, 1) }
+	evs := reloaded.DrainEvents(ctx)
+	if len(evs) != 1 || evs[0].Order.Status != StatusExpired {
+		t.Fatalf("expected EXPIRED event, got %+v", evs)
+	}
+}
+
+func TestPaperMarketWithoutQuoteRejected(t *testing.T) {
+	root := t.TempDir()
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	_, err = b.Submit(context.Background(), model.ParsedOrder{
+		IntentID: "p-3", Side: "SELL", Symbol: "NVDA", Market: "US",
+		Qty: "10", OrderType: "MARKET", TIF: "DAY",
+	})
+	if err == nil {
+		t.Fatal("expected PAPER_NO_QUOTE error")
+	}
+}
+
+func TestPaperAccountUsesSharedQuotes(t *testing.T) {
+	root := t.TempDir()
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":185.00,"updated_at":"t1"}`, "")
+	acct := filepath.Join(root, "accounts", "paper-1")
+	if err := os.MkdirAll(filepath.Join(acct, "trade"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	b, err := NewPaperBroker(acct, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+	info, err := b.Submit(context.Background(), model.ParsedOrder{
+		IntentID: "p-acct", Side: "BUY", Symbol: "AAPL", Market: "US",
+		Qty: "10", OrderType: "MARKET", TIF: "DAY",
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if info.Status != StatusFilled || info.AvgPrice != "185" {
+		t.Fatalf("expected fill at the shared quote, got %s @ %s", info.Status, info.AvgPrice)
+	}
+}
+
+func TestPaperTrailingStopFollowsPrice(t *testing.T) {
+	root := t.TempDir()
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":100.00,"updated_at":"t1"}`, "")
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+
+	ctx := context.Background()
+	info, err := b.Submit(ctx, model.ParsedOrder{
+		IntentID: "p-4", Side: "SELL", Symbol: "AAPL", Market: "US", Qty: "10",
+		OrderType: "TSLPAMT", TrailingAmount: "5", LimitOffset: "0", TIF: "GTC",
+	})
+	if err != nil || info.Status != StatusSubmitted {
+		t.Fatalf("Submit: %+v err=%v", info, err)
+	}
+
+	// Rally to 110 moves the stop to 105; a dip to 106 does not trigger it
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":110.00,"updated_at":"t2"}`, "")
+	b.DrainEvents(ctx)
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":106.00,"updated_at":"t3"}`, "")
+	if evs := b.DrainEvents(ctx); len(evs) != 0 {
+		t.Fatalf("expected no fill above the trailed stop, got %+v", evs)
+	}
+
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":105.00,"updated_at":"t4"}`, "")
+	evs := b.DrainEvents(ctx)
+	if len(evs) != 1 || evs[0].Order.Status != StatusFilled || evs[0].FillPrice != "105" {
+		t.Fatalf("expected fill at the 105 stop, got %+v", evs)
+	}
+}
+
+func TestPaperOrderRecoveredByRemark(t *testing.T) {
+	root, bcPath := newLedger(t, "")
+	writeQuote(t, root, "AAPL.US", `{"symbol":"AAPL.US","last":185.00,"updated_at":"t1"}`, "")
+
+	b, err := NewPaperBroker(root, root)
+	if err != nil {
+		t.Fatalf("NewPaperBroker: %v", err)
+	}
+	b.cfg = PaperConfig{}
+
+	o := model.ParsedOrder{
+		IntentID: "rec-1", Side: "BUY", Symbol: "AAPL", Market: "US",
+		Qty: "100", OrderType: "LIMIT", Price: "180.00", TIF: "DAY",
+	}
+	// Submitted, then the controller died before journaling it
+	first, err := b.Submit(context.Background(), o)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	ledgerText := `
+2026-03-31 * "ORDER" "BUY AAPL.US"
+  ; intent_id: rec-1
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qty: 100
+  ; type: LIMIT
+  ; price: 180.00
+  ; tif: DAY
+`
+	if err := os.WriteFile(bcPath, []byte(ledgerText), 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	if _, err := ProcessLedger(context.Background(), b, root); err != nil {
+		t.Fatalf("ProcessLedger: %v", err)
+	}
+
+	if len(b.orders) != 1 {
+		t.Fatalf("expected the order not to be resubmitted, paper book has %d orders", len(b.orders))
+	}
+	data, _ := os.ReadFile(bcPath)
+	text := string(data)
+	for _, want := range []string{`"SUBMITTED"`, "order_id: " + first.OrderID, "recovered: true"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in ledger:\n%s", want, text)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package ledger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GenesisHash is the prev_hash of the first chained block.
+var GenesisHash = strings.Repeat("0", 64)
+
+// chainHeadPrefix marks the live ledger header line naming the last block.
+const chainHeadPrefix = "; chain_head: "
+
+// BlockMeta is the parsed meta.txt of a block under trade/blocks/.
+type BlockMeta struct {
+	BlockID   string
+	Dir       string
+	CreatedAt string
+	Entries   int
+	Height    int    // position among chained blocks from 1, 0 for unchained ones
+	SHA256    string // hash of the block data
+	PrevHash  string // Hash of the previous block, GenesisHash for the first
+	Hash      string // chain hash over PrevHash and SHA256
+}
+
+// link is the hash a following block refers to: the chain hash, or the
+// data hash for blocks written before chaining.
+func (m BlockMeta) link() string {
+	if m.Hash != "" {
+		return m.Hash
+	}
+	return m.SHA256
+}
+
+// chainHash links a block's data hash to the previous block.
+func chainHash(prev, dataHash string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(prev+"\n"+dataHash)))
+}
+
+// ReadBlockMeta parses dir/meta.txt.
+func ReadBlockMeta(dir string) (BlockMeta, error) {
+	m := BlockMeta{BlockID: filepath.Base(dir), Dir: dir}
+	f, err := os.Open(filepath.Join(dir, "meta.txt"))
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.TrimSpace(k) {
+		case "block_id":
+			m.BlockID = v
+		case "created_at":
+			m.CreatedAt = v
+		case "entries":
+			m.Entries, _ = strconv.Atoi(v)
+		case "height":
+			m.Height, _ = strconv.Atoi(v)
+		case "sha256":
+			m.SHA256 = v
+		case "prev_hash":
+			m.PrevHash = v
+		case "hash":
+			m.Hash = v
+		}
+	}
+	return m, sc.Err()
+}
+
+// ListBlocks returns the blocks under root/trade/blocks in chain order:
+// unchained blocks by block ID, then chained blocks by height. Blocks
+// whose meta.txt can't be read are returned with only BlockID and Dir set.
+func ListBlocks(root string) ([]BlockMeta, error) {
+	dirs, err := os.ReadDir(filepath.Join(root, "trade", "blocks"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var blocks []BlockMeta
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		m, _ := ReadBlockMeta(filepath.Join(root, "trade", "blocks", d.Name()))
+		blocks = append(blocks, m)
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Height != blocks[j].Height {
+			return blocks[i].Height < blocks[j].Height
+		}
+		return blocks[i].BlockID < blocks[j].BlockID
+	})
+	return blocks, nil
+}
+
+// chainTip returns the hash the next block links to and its height.
+func chainTip(root string) (prev string, height int, err error) {
+	blocks, err := ListBlocks(root)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(blocks) == 0 {
+		return GenesisHash, 1, nil
+	}
+	last := blocks[len(blocks)-1]
+	if last.link() == "" {
+		return "", 0, fmt.Errorf("block %s has no hash", last.BlockID)
+	}
+	return last.link(), last.Height + 1, nil
+}
+
+// ledgerChainHead returns the chain_head recorded in the live ledger's
+// header, empty if there is none.
+func ledgerChainHead(bcPath string) (string, error) {
+	f, err := os.Open(bcPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if HeaderRe.MatchString(line) {
+			break
+		}
+		if strings.HasPrefix(line, chainHeadPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, chainHeadPrefix)), nil
+		}
+	}
+	return "", sc.Err()
+}
+
+// Chain verification severities.
+const (
+	SeverityError   = "ERROR"
+	SeverityWarning = "WARNING"
+)
+
+// ChainIssue is one finding of VerifyChain.
+type ChainIssue struct {
+	Severity string `json:"severity"`
+	BlockID  string `json:"block_id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ChainReport is the result of VerifyChain.
+type ChainReport struct {
+	Blocks int          `json:"blocks"`
+	Head   string       `json:"head,omitempty"`
+	OK     bool         `json:"ok"`
+	Issues []ChainIssue `json:"issues"`
+}
+
+func (r *ChainReport) add(severity, blockID, format string, args ...any) {
+	r.Issues = append(r.Issues, ChainIssue{Severity: severity, BlockID: blockID, Message: fmt.Sprintf(format, args...)})
+}
+
+// VerifyChain checks every block's data against its recorded hash, each
+// block's link to the previous one, and the live ledger's chain_head
+// against the last block. Edited, deleted, reordered or inserted blocks
+// show up as ERROR issues; blocks written before chaining as WARNINGs.
+func VerifyChain(root string) (*ChainReport, error) {
+	blocks, err := ListBlocks(root)
+	if err != nil {
+		return nil, err
+	}
+	r := &ChainReport{Blocks: len(blocks), Issues: []ChainIssue{}}
+
+	prev := GenesisHash
+	height := 0 // of the last chained block
+	chained := false
+	for _, b := range blocks {
+		if b.SHA256 == "" {
+			r.add(SeverityError, b.BlockID, "meta.txt missing or without sha256")
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(b.Dir, "data"))
+		if err != nil {
+			r.add(SeverityError, b.BlockID, "data unreadable: %v", err)
+		} else {
+			if sum := fmt.Sprintf("%x", sha256.Sum256(data)); sum != b.SHA256 {
+				r.add(SeverityError, b.BlockID, "data modified: sha256 %s, meta.txt records %s", short(sum), short(b.SHA256))
+			}
+			if n := countEntries(string(data)); b.Entries > 0 && n != b.Entries {
+				r.add(SeverityError, b.BlockID, "data holds %d entries, meta.txt records %d", n, b.Entries)
+			}
+		}
+
+		if b.Hash == "" {
+			if chained {
+				r.add(SeverityError, b.BlockID, "unchained block after chained blocks (inserted?)")
+			} else {
+				r.add(SeverityWarning, b.BlockID, "written before hash chaining, not linked")
+			}
+			prev = b.SHA256
+			continue
+		}
+		if b.Height != height+1 {
+			r.add(SeverityError, b.BlockID, "height %d, expected %d (block missing?)", b.Height, height+1)
+		}
+		height = b.Height
+		chained = true
+		if b.PrevHash != prev {
+			r.add(SeverityError, b.BlockID, "prev_hash %s does not match the previous block %s (block missing or replaced?)", short(b.PrevHash), short(prev))
+		}
+		if h := chainHash(b.PrevHash, b.SHA256); h != b.Hash {
+			r.add(SeverityError, b.BlockID, "hash %s does not match prev_hash and sha256 (meta.txt edited?)", short(b.Hash))
+		}
+		prev = b.Hash
+	}
+
+	if len(blocks) > 0 {
+		r.Head = prev
+	}
+	head, err := ledgerChainHead(filepath.Join(root, "trade", "beancount.txt"))
+	switch {
+	case err != nil:
+		r.add(SeverityError, "", "live ledger unreadable: %v", err)
+	case head == "" && chained:
+		r.add(SeverityError, "", "live ledger has no chain_head, last block is %s", short(prev))
+	case head == "" && len(blocks) > 0:
+		r.add(SeverityWarning, "", "live ledger has no chain_head (compacted before hash chaining)")
+	case head != "" && len(blocks) == 0:
+		r.add(SeverityError, "", "live ledger names chain_head %s but there are no blocks (blocks deleted?)", short(head))
+	case head != "" && head != prev:
+		r.add(SeverityError, "", "live ledger chain_head %s does not match the last block %s (block deleted or added?)", short(head), short(prev))
+	}
+
+	r.OK = true
+	for _, is := range r.Issues {
+		if is.Severity == SeverityError {
+			r.OK = false
+		}
+	}
+	return r, nil
+}
+
+// countEntries counts the transaction headers in block data.
+func countEntries(data string) int {
+	n := 0
+	for _, line := range strings.Split(data, "\n") {
+		if HeaderRe.MatchString(line) {
+			n++
+		}
+	}
+	return n
+}
+
+// short abbreviates a hash for messages.
+func short(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
@@ -0,0 +1,55 @@
+package ledger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompactedBlocksHashChained(t *testing.T) {
+	root, bcPath := newLedger(t, "; beancount append-only trade ledger\n")
+	for _, id := range []string{"hc-1", "hc-2"} {
+		appendText(t, bcPath, orderText("2026-01-01", id, "BUY", "AAPL.US", "1", ""), fillText("2026-01-01", id, "BUY", "AAPL.US", "1", "100"))
+		if err := CompactBlocks(root, 1); err != nil {
+			t.Fatalf("CompactBlocks: %v", err)
+		}
+	}
+
+	report, err := VerifyChain(root)
+	if err != nil || !report.OK || report.Blocks != 2 || len(report.Issues) != 0 {
+		t.Fatalf("expected intact chain of 2 blocks, got %+v err=%v", report, err)
+	}
+	blocks, err := ListBlocks(root)
+	if err != nil {
+		t.Fatalf("ListBlocks: %v", err)
+	}
+	if blocks[0].PrevHash != GenesisHash || blocks[1].PrevHash != blocks[0].Hash {
+		t.Fatalf("blocks not linked: %+v", blocks)
+	}
+
+	// Edited block data
+	dataPath := filepath.Join(blocks[0].Dir, "data")
+	orig, err := os.ReadFile(dataPath)
+	if err != nil {
+		t.Fatalf("read block: %v", err)
+	}
+	if err := os.WriteFile(dataPath, []byte(strings.Replace(string(orig), "qty: 1", "qty: 9", 1)), 0644); err != nil {
+		t.Fatalf("edit block: %v", err)
+	}
+	if report, err := VerifyChain(root); err != nil || report.OK || !strings.Contains(report.Issues[0].Message, "data modified") {
+		t.Errorf("expected edited data to be reported, got %+v err=%v", report, err)
+	}
+	if err := os.WriteFile(dataPath, orig, 0644); err != nil {
+		t.Fatalf("restore block: %v", err)
+	}
+
+	// Deleted last block
+	if err := os.RemoveAll(blocks[1].Dir); err != nil {
+		t.Fatalf("remove block: %v", err)
+	}
+	report, err = VerifyChain(root)
+	if err != nil || report.OK || len(report.Issues) != 1 || !strings.Contains(report.Issues[0].Message, "chain_head") {
+		t.Errorf("expected deleted block to be reported, got %+v err=%v", report, err)
+	}
+}
@@ -14,21 +14,128 @@ import (
 
 // CompactBlocks finds completed ORDER+EXECUTION pairs in the beancount ledger,
 // moves them into a block under /trade/blocks/{BLOCK_ID}/, and rewrites the ledger.
+// Each block's meta.txt links to the previous block's hash, and the rewritten
+// ledger's header records the new chain head (see VerifyChain). The ledger
+// stays locked from read to rewrite, so concurrent appends are not lost.
 func CompactBlocks(root string, count int) error {
 	bcPath := filepath.Join(root, "trade", "beancount.txt")
-	entries, err := ParseEntries(bcPath)
-	if err != nil {
+	var compacted bool
+	err := WithLock(bcPath, func() error {
+		var err error
+		compacted, err = compactLocked(root, bcPath)
+		return err
+	})
+	if err != nil || !compacted {
 		return err
 	}
 
-	// Find completed pairs: an ORDER that has a matching EXECUTION or REJECTION
+	// Include the new block in the beancount entry point
+	if err := WriteAccounts(filepath.Join(root, "trade")); err != nil {
+		log.Printf("write %s failed: %v", AccountsFile, err)
+	}
+	return nil
+}
+
+// compactLocked does the work of CompactBlocks with the ledger lock held.
+// It reports whether a block was written.
+func compactLocked(root, bcPath string) (bool, error) {
+	raw, err := os.ReadFile(bcPath)
+	if err != nil {
+		return false, err
+	}
+	entries := parseEntries(string(raw))
+
+	// Order group legs (BRACKET/OCO) carry parent_id and are compacted
+	// together with their parent ORDER.
+	parentOf := make(map[string]string)
+	legs := make(map[string]map[string]string) // parent -> leg -> intent_id
+	for _, e := range entries {
+		parent, id := e.Meta["parent_id"], e.Meta["intent_id"]
+		if parent == "" || id == "" {
+			continue
+		}
+		parentOf[id] = parent
+		if legs[parent] == nil {
+			legs[parent] = make(map[string]string)
+		}
+		legs[parent][e.Meta["leg"]] = id
+	}
+
+	// Find completed intents: every order an intent placed has a terminal
+	// latest status (or the intent was rejected outright), and an algo
+	// intent's task has finished. Working orders stay in the ledger.
+	orderStatus := make(map[string]map[string]string) // intent -> order_id -> latest status
+	rejected := make(map[string]bool)
+	orders := make(map[string]int)     // live ORDERs per intent
+	duplicates := make(map[string]int) // DUPLICATE_INTENT rejections per intent
+	algoStatus := make(map[string]string)
+	filled := make(map[string]bool)
+	for _, e := range entries {
+		id := e.Meta["intent_id"]
+		if id == "" {
+			continue
+		}
+		switch e.Type {
+		case "ORDER":
+			orders[id]++
+		case "REJECTION":
+			if IsDuplicateRejection(e) {
+				duplicates[id]++
+				continue
+			}
+			rejected[id] = true
+		case "ALGO":
+			algoStatus[id] = e.Meta["status"]
+		case "SUBMITTED", "EXECUTION":
+			status, oid := e.Meta["status"], e.Meta["order_id"]
+			if orderStatus[id] == nil {
+				orderStatus[id] = make(map[string]string)
+			}
+			if _, seen := orderStatus[id][oid]; seen && status == "REPLACED" {
+				continue // a resized order keeps working
+			}
+			orderStatus[id][oid] = status
+			if fq := e.Meta["filled_qty"]; e.Type == "EXECUTION" && (status == "" || status == "FILLED" || (fq != "" && fq != "0")) {
+				filled[id] = true
+			}
+		}
+	}
+
 	processed := make(map[string]bool)
 	for _, e := range entries {
-		if e.Type == "EXECUTION" || e.Type == "REJECTION" {
-			if id := e.Meta["intent_id"]; id != "" {
-				processed[id] = true
+		id := e.Meta["intent_id"]
+		if id == "" || e.Type == "ORDER" {
+			continue
+		}
+		algo, isAlgo := algoStatus[id]
+		// Rejected duplicates go once the original is done, or right away
+		// if the original was compacted before
+		allDuplicates := duplicates[id] > 0 && orders[id] <= duplicates[id]
+		done := rejected[id] || len(orderStatus[id]) > 0 || isAlgo || allDuplicates
+		for _, status := range orderStatus[id] {
+			if !IsTerminalStatus(status) {
+				done = false
 			}
 		}
+		if isAlgo && !IsTerminalAlgoStatus(algo) {
+			done = false
+		}
+		processed[id] = done
+	}
+
+	// A group is done once every leg is terminal and, if the entry leg
+	// traded, both exit legs have been submitted.
+	for parent, ls := range legs {
+		done := true
+		for _, id := range ls {
+			if !processed[id] {
+				done = false
+			}
+		}
+		if entry, ok := ls["ENTRY"]; ok && filled[entry] && (ls["TAKE_PROFIT"] == "" || ls["STOP_LOSS"] == "") {
+			done = false
+		}
+		processed[parent] = done
 	}
 
 	// Collect entries to compact (ORDER + its EXECUTION/REJECTION)
@@ -45,15 +152,15 @@ func CompactBlocks(root string, count int) error {
 				toCompact = append(toCompact, e)
 				compactedIDs[id] = true
 			}
-		case "EXECUTION", "REJECTION":
-			if compactedIDs[id] {
+		case "EXECUTION", "REJECTION", "SUBMITTED", "ALGO":
+			if compactedIDs[id] || compactedIDs[parentOf[id]] {
 				toCompact = append(toCompact, e)
 			}
 		}
 	}
 
 	if len(toCompact) == 0 {
-		return nil
+		return false, nil
 	}
 
 	// Build block data
@@ -74,50 +181,61 @@ func CompactBlocks(root string, count int) error {
 	now := time.Now()
 	hash := sha256.Sum256([]byte(data))
 	hashHex := fmt.Sprintf("%x", hash)
+
+	// Link to the previous block
+	prevHash, height, err := chainTip(root)
+	if err != nil {
+		return false, err
+	}
+	chained := chainHash(prevHash, hashHex)
 	blockID := fmt.Sprintf("%s-%s", now.Format("20060102T150405"), hashHex[:8])
 
 	// Write block
 	blockDir := filepath.Join(root, "trade", "blocks", blockID)
 	if err := os.MkdirAll(blockDir, 0755); err != nil {
-		return err
+		return false, err
 	}
 
 	// meta.txt
-	meta := fmt.Sprintf("block_id: %s\ncreated_at: %s\nentries: %d\nintent_ids: %s\nsha256: %s\n",
+	meta := fmt.Sprintf("block_id: %s\ncreated_at: %s\nentries: %d\nintent_ids: %s\nsha256: %s\nheight: %d\nprev_hash: %s\nhash: %s\n",
 		blockID,
 		now.UTC().Format(time.RFC3339),
 		len(toCompact),
 		strings.Join(intentIDs, ", "),
 		hashHex,
+		height,
+		prevHash,
+		chained,
 	)
 	if err := os.WriteFile(filepath.Join(blockDir, "meta.txt"), []byte(meta), 0644); err != nil {
-		return err
+		return false, err
 	}
 
 	// data
 	if err := os.WriteFile(filepath.Join(blockDir, "data"), []byte(data), 0644); err != nil {
-		return err
+		return false, err
 	}
 
 	// Rewrite ledger without compacted entries
 	var remaining []string
 	remaining = append(remaining, "; beancount append-only trade ledger")
 	remaining = append(remaining, fmt.Sprintf("; compacted to block %s at %s", blockID, now.UTC().Format(time.RFC3339)))
+	remaining = append(remaining, chainHeadPrefix+chained)
 	remaining = append(remaining, "")
 
 	for _, e := range entries {
 		id := e.Meta["intent_id"]
-		if id != "" && compactedIDs[id] {
+		if id != "" && (compactedIDs[id] || compactedIDs[parentOf[id]]) {
 			continue // skip compacted entries
 		}
 		remaining = append(remaining, strings.Join(e.RawLines, "\n"))
 	}
 
 	newContent := strings.Join(remaining, "\n") + "\n"
-	if err := os.WriteFile(bcPath, []byte(newContent), 0644); err != nil {
-		return err
+	if err := WriteFileAtomic(bcPath, []byte(newContent), 0644); err != nil {
+		return false, err
 	}
 
 	log.Printf("compacted %d entries into block %s", len(toCompact), blockID)
-	return nil
+	return true, nil
 }
@@ -0,0 +1,72 @@
+package ledger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompactionKeepsConcurrentAppends(t *testing.T) {
+	root, bcPath := newLedger(t, "; beancount append-only trade ledger\n")
+
+	// Executed intents for the compactor to move while new ORDERs arrive
+	const n = 200
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			id := fmt.Sprintf("cc-%03d", i)
+			texts := []string{orderText("2026-01-01", id, "BUY", "AAPL.US", "1", "")}
+			if i%2 == 0 {
+				texts = append(texts, fillText("2026-01-01", id, "BUY", "AAPL.US", "1", "1"))
+			}
+			for _, text := range texts {
+				if err := Append(bcPath, text); err != nil {
+					done <- err
+					return
+				}
+			}
+		}
+		close(done)
+	}()
+	for compacting := true; compacting; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			compacting = false
+		default:
+		}
+		if err := CompactBlocks(root, 1); err != nil {
+			t.Fatalf("CompactBlocks: %v", err)
+		}
+	}
+
+	var all strings.Builder
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	all.Write(data)
+	blocks, err := ListBlocks(root)
+	if err != nil {
+		t.Fatalf("ListBlocks: %v", err)
+	}
+	for _, b := range blocks {
+		data, err := os.ReadFile(filepath.Join(b.Dir, "data"))
+		if err != nil {
+			t.Fatalf("read block: %v", err)
+		}
+		all.Write(data)
+	}
+	for i := 0; i < n; i++ {
+		if id := fmt.Sprintf("cc-%03d", i); !strings.Contains(all.String(), "intent_id: "+id+"\n") {
+			t.Fatalf("ORDER %s lost during compaction", id)
+		}
+	}
+	if report, err := VerifyChain(root); err != nil || !report.OK {
+		t.Errorf("expected intact chain, got %+v err=%v", report, err)
+	}
+}
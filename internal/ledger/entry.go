@@ -0,0 +1,58 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"longbridge-fs/internal/model"
+)
+
+// FormatOrder renders o as an ORDER entry dated date (YYYY-MM-DD) that
+// OrderFromEntry reads back: a `"ORDER" "SIDE QTY SYMBOL"` header and one
+// `; key: value` line per set field, then extra meta in key order. Append
+// the result with Append.
+func FormatOrder(date string, o model.ParsedOrder, extra map[string]string) string {
+	desc := strings.TrimSpace(fmt.Sprintf("%s %s %s", o.Side, o.Qty, o.Symbol))
+	if o.Action != "" {
+		desc = strings.TrimSpace(o.Action + " " + o.OrderID)
+	}
+	if o.RebalanceID != "" {
+		desc += " " + o.RebalanceID
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s * \"ORDER\" \"%s\"\n", date, desc)
+	field := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&b, "  ; %s: %s\n", k, v)
+		}
+	}
+	field("intent_id", o.IntentID)
+	field("action", o.Action)
+	field("order_id", o.OrderID)
+	field("side", o.Side)
+	field("symbol", o.Symbol)
+	field("qty", o.Qty)
+	field("type", o.OrderType)
+	field("price", o.Price)
+	field("trigger_price", o.TriggerPrice)
+	field("trailing_amount", o.TrailingAmount)
+	field("trailing_percent", o.TrailingPercent)
+	field("limit_offset", o.LimitOffset)
+	field("tif", o.TIF)
+	field("expire_date", o.ExpireDate)
+	field("source", o.Source)
+	field("rebalance_id", o.RebalanceID)
+	field("signal_refs", strings.Join(o.SignalRefs, ","))
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		field(k, extra[k])
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExportColumns is the column schema of the CSV and JSONL exports, one row
+// per ORDER, EXECUTION or REJECTION entry. Columns are only ever added at
+// the end. Intent-level columns (order_type through signal_refs) come from
+// the entry's ORDER when the entry itself doesn't carry them.
+var ExportColumns = []string{
+	"date", "type", "block", "intent_id", "parent_id", "order_id",
+	"symbol", "side", "qty", "price", "status",
+	"filled_qty", "avg_price", "fee", "total_fees", "reason", "executed_at",
+	"order_type", "tif", "source", "rebalance_id", "signal_refs",
+}
+
+// BlotterColumns is the column schema of the trade blotter: one row per
+// fill, with signed cash amounts in the trading currency (net_amount is
+// negative for buys).
+var BlotterColumns = []string{
+	"trade_date", "executed_at", "symbol", "market", "currency", "side",
+	"qty", "price", "gross_amount", "fee", "net_amount",
+	"intent_id", "order_id", "order_type", "source", "status", "block",
+}
+
+// ExportTypes are the entry types exported.
+var ExportTypes = []string{"ORDER", "EXECUTION", "REJECTION"}
+
+// ExportFormats lists the formats accepted by Export.
+var ExportFormats = []string{"csv", "jsonl", "blotter"}
+
+// Export writes entries in format ("csv", "jsonl" or "blotter"). history
+// is the full history, used to complete entries with their ORDER's fields.
+func Export(w io.Writer, format string, history, entries []HistoryEntry) error {
+	ix := newIntentIndex(history)
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(ExportColumns)
+		for _, h := range entries {
+			cw.Write(exportRow(ix, h))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, h := range entries {
+			row := exportRow(ix, h)
+			obj := make(map[string]string, len(row))
+			for i, c := range ExportColumns {
+				obj[c] = row[i]
+			}
+			if err := enc.Encode(obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "blotter":
+		cw := csv.NewWriter(w)
+		cw.Write(BlotterColumns)
+		for _, h := range entries {
+			if row := blotterRow(ix, h); row != nil {
+				cw.Write(row)
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown export format %q (want %s)", format, strings.Join(ExportFormats, ", "))
+}
+
+func exportRow(ix intentIndex, h HistoryEntry) []string {
+	row := make([]string, len(ExportColumns))
+	for i, c := range ExportColumns {
+		switch c {
+		case "date":
+			row[i] = h.Date
+		case "type":
+			row[i] = h.Type
+		case "block":
+			row[i] = h.Block
+		case "order_type":
+			row[i] = ix.orderMeta(h, "type")
+		case "tif", "source", "rebalance_id", "signal_refs":
+			row[i] = ix.meta(h, c)
+		default:
+			row[i] = h.Meta[c]
+		}
+	}
+	return row
+}
+
+// blotterRow returns the blotter row of a fill, nil for other entries.
+func blotterRow(ix intentIndex, h HistoryEntry) []string {
+	qty, price, ok := fill(h)
+	if !ok {
+		return nil
+	}
+	symbol, side := h.Meta["symbol"], h.Meta["side"]
+	fee, _ := strconv.ParseFloat(h.Meta["fee"], 64)
+	gross := qty * price
+	net := gross - fee
+	if side == "BUY" {
+		net = -(gross + fee)
+	}
+	market := ""
+	if i := strings.LastIndex(symbol, "."); i >= 0 {
+		market = strings.ToUpper(symbol[i+1:])
+	}
+	tradeDate := h.Date
+	if at := h.Meta["executed_at"]; len(at) >= 10 {
+		tradeDate = at[:10]
+	}
+	return []string{
+		tradeDate, h.Meta["executed_at"], symbol, market, Currency(symbol), side,
+		decimal(qty), decimal(price), decimal(gross), decimal(fee), decimal(net),
+		h.Meta["intent_id"], h.Meta["order_id"], ix.orderMeta(h, "type"),
+		ix.meta(h, "source"), h.Meta["status"], h.Block,
+	}
+}
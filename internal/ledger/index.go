@@ -0,0 +1,344 @@
+package ledger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"longbridge-fs/internal/model"
+)
+
+// IndexFile is the intent index persisted next to beancount.txt.
+const IndexFile = "index.json"
+
+// IntentRecord is what the index knows about one intent_id.
+type IntentRecord struct {
+	Date      string `json:"date,omitempty"`   // header date of the ORDER
+	Symbol    string `json:"symbol,omitempty"` // as written in the ORDER
+	Side      string `json:"side,omitempty"`
+	Processed bool   `json:"processed"`        // has a SUBMITTED, EXECUTION, REJECTION or ALGO entry (its own or a group leg's)
+	Status    string `json:"status,omitempty"` // latest status, REJECTED for a REJECTION
+	Block     string `json:"block,omitempty"`  // block holding the intent, empty while live
+	Parent    string `json:"parent,omitempty"` // parent intent of an order group leg
+}
+
+// ReasonDuplicateIntent prefixes the reason of the REJECTION journaled for
+// an ORDER whose intent_id is already taken. Such rejections belong to the
+// duplicate, not to the intent: they leave its record and status alone.
+const ReasonDuplicateIntent = "DUPLICATE_INTENT"
+
+// IsDuplicateRejection reports whether e rejects a duplicate ORDER.
+func IsDuplicateRejection(e model.Entry) bool {
+	return e.Type == "REJECTION" && strings.HasPrefix(e.Meta["reason"], ReasonDuplicateIntent)
+}
+
+// indexFile is the on-disk form of Index.
+type indexFile struct {
+	UpdatedAt string                   `json:"updated_at"`
+	Blocks    []string                 `json:"blocks"`
+	Intents   map[string]*IntentRecord `json:"intents"`
+}
+
+// Index is the controller's incremental view of an account's ledger. It
+// keeps the parsed live entries between cycles and only parses what was
+// appended since the last read; the intent records of the live ledger and
+// of every compacted block are persisted in trade/index.json, so blocks are
+// parsed once, not on every start.
+//
+// Appends are detected by file identity and size. A ledger replaced by
+// rename (compaction) or truncated is re-read in full, after indexing any
+// new blocks. Writers must append (see Append); a file rewritten in place
+// is only noticed if the bytes of its last entry changed.
+type Index struct {
+	mu     sync.Mutex
+	root   string
+	bcPath string
+
+	file    os.FileInfo   // the ledger last read
+	offset  int64         // start of the last entry; everything before is parsed
+	tail    []byte        // bytes from offset, re-parsed on every read
+	entries []model.Entry // live entries in ledger order
+
+	blocks  map[string]bool
+	intents map[string]*IntentRecord
+	dirty   bool
+}
+
+var (
+	indexMu sync.Mutex
+	indexes = make(map[string]*Index) // root -> index
+)
+
+// OpenIndex returns the index of root, loading trade/index.json on first
+// use. Indexes are shared per root within the process.
+func OpenIndex(root string) *Index {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if ix := indexes[root]; ix != nil {
+		return ix
+	}
+	ix := &Index{
+		root:    root,
+		bcPath:  filepath.Join(root, "trade", "beancount.txt"),
+		blocks:  make(map[string]bool),
+		intents: make(map[string]*IntentRecord),
+	}
+	var saved indexFile
+	data, err := os.ReadFile(ix.path())
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	switch {
+	case err == nil:
+		for _, id := range saved.Blocks {
+			ix.blocks[id] = true
+		}
+		for id, r := range saved.Intents {
+			if r != nil {
+				ix.intents[id] = r
+			}
+		}
+	case !os.IsNotExist(err):
+		log.Printf("WARNING: %s unreadable, rebuilding: %v", ix.path(), err)
+	}
+	indexes[root] = ix
+	return ix
+}
+
+func (ix *Index) path() string {
+	return filepath.Join(ix.root, "trade", IndexFile)
+}
+
+// Refresh reads what was appended to the live ledger since the last call,
+// updates the intent records and saves index.json if they changed. It
+// returns all live entries, which callers must not modify.
+func (ix *Index) Refresh() ([]model.Entry, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	data, info, reset, err := readLedgerFrom(ix.bcPath, ix.file, ix.offset)
+	if err == nil && !reset && !bytes.HasPrefix(data, ix.tail) {
+		// Rewritten in place rather than appended to
+		data, info, reset, err = readLedgerFrom(ix.bcPath, nil, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if reset {
+		ix.offset, ix.entries = 0, nil
+		ix.indexBlocks()
+		// Live records are rebuilt from the ledger below
+		for id, r := range ix.intents {
+			if r.Block == "" {
+				delete(ix.intents, id)
+				ix.dirty = true
+			}
+		}
+	} else if len(ix.entries) > 0 {
+		ix.entries = ix.entries[:len(ix.entries)-1] // re-parsed from the tail
+	}
+
+	parsed := parseEntries(string(data))
+	for _, e := range parsed {
+		ix.apply(e, "")
+	}
+	ix.entries = append(ix.entries, parsed...)
+	ix.file = info
+	if i := lastHeader(data); i >= 0 {
+		ix.offset += int64(i)
+		data = data[i:]
+	}
+	ix.tail = data
+
+	if ix.dirty {
+		if err := ix.save(); err != nil {
+			log.Printf("WARNING: failed to save %s: %v", ix.path(), err)
+		} else {
+			ix.dirty = false
+		}
+	}
+	return ix.entries, nil
+}
+
+// indexBlocks adds the records of blocks not indexed yet.
+func (ix *Index) indexBlocks() {
+	blocks, err := ListBlocks(ix.root)
+	if err != nil {
+		log.Printf("WARNING: failed to list ledger blocks: %v", err)
+		return
+	}
+	for _, b := range blocks {
+		if ix.blocks[b.BlockID] {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(b.Dir, "data"))
+		if err != nil {
+			log.Printf("WARNING: failed to index block %s: %v", b.BlockID, err)
+			continue
+		}
+		for _, e := range parseEntries(string(data)) {
+			ix.apply(e, b.BlockID)
+		}
+		ix.blocks[b.BlockID] = true
+		ix.dirty = true
+	}
+}
+
+// apply updates the records e refers to. Applying the same entries again
+// in the same order leaves the records unchanged.
+func (ix *Index) apply(e model.Entry, block string) {
+	id := e.Meta["intent_id"]
+	if id == "" || IsDuplicateRejection(e) {
+		return
+	}
+	r := ix.record(id)
+	before := *r
+	if block != "" {
+		r.Block = block
+	}
+	switch e.Type {
+	case "ORDER":
+		if m := HeaderRe.FindStringSubmatch(e.RawLines[0]); m != nil && r.Date == "" {
+			r.Date = m[1]
+		}
+		if r.Symbol == "" {
+			r.Symbol, r.Side = e.Meta["symbol"], e.Meta["side"]
+		}
+	case "SUBMITTED", "EXECUTION", "REJECTION", "ALGO":
+		r.Processed = true
+		switch status := e.Meta["status"]; {
+		case e.Type == "REJECTION":
+			r.Status = "REJECTED"
+		case status != "" && status != "REPLACED":
+			r.Status = status
+		}
+		if parent := e.Meta["parent_id"]; parent != "" {
+			r.Parent = parent
+			p := ix.record(parent)
+			if !p.Processed {
+				p.Processed = true
+				ix.dirty = true
+			}
+		}
+	}
+	if *r != before {
+		ix.dirty = true
+	}
+}
+
+func (ix *Index) record(id string) *IntentRecord {
+	r := ix.intents[id]
+	if r == nil {
+		r = &IntentRecord{}
+		ix.intents[id] = r
+	}
+	return r
+}
+
+func (ix *Index) save() error {
+	f := indexFile{
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+		Blocks:    make([]string, 0, len(ix.blocks)),
+		Intents:   ix.intents,
+	}
+	for id := range ix.blocks {
+		f.Blocks = append(f.Blocks, id)
+	}
+	sort.Strings(f.Blocks)
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(ix.path(), append(data, '\n'), 0644)
+}
+
+// Processed reports whether intentID already has a SUBMITTED, EXECUTION,
+// REJECTION or ALGO entry, live or compacted. An order group's parent
+// counts as processed once any of its legs was journaled.
+func (ix *Index) Processed(intentID string) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	r := ix.intents[intentID]
+	return r != nil && r.Processed
+}
+
+// Lookup returns the record of intentID.
+func (ix *Index) Lookup(intentID string) (IntentRecord, bool) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	r := ix.intents[intentID]
+	if r == nil {
+		return IntentRecord{}, false
+	}
+	return *r, true
+}
+
+// Duplicate is a live ORDER reusing the intent_id of Original.
+type Duplicate struct {
+	Entry    model.Entry
+	Original IntentRecord
+}
+
+// Pending returns the live ORDER entries whose intent is not processed yet,
+// in ledger order, and the duplicate ORDERs not rejected yet.
+//
+// An ORDER is a duplicate if its intent_id is already taken: by an earlier
+// ORDER in the live ledger, by any compacted entry, or by a group leg the
+// controller journaled. Each duplicate is matched by one DUPLICATE_INTENT
+// rejection of the same intent_id.
+func (ix *Index) Pending() (orders []model.Entry, dups []Duplicate) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	rejected := make(map[string]int) // DUPLICATE_INTENT rejections per intent
+	for _, e := range ix.entries {
+		if IsDuplicateRejection(e) {
+			rejected[e.Meta["intent_id"]]++
+		}
+	}
+	seen := make(map[string]bool)
+	for _, e := range ix.entries {
+		id := e.Meta["intent_id"]
+		if e.Type != "ORDER" || id == "" {
+			continue
+		}
+		r := ix.record(id)
+		if !seen[id] && r.Block == "" && r.Parent == "" {
+			seen[id] = true
+			if !r.Processed {
+				orders = append(orders, e)
+			}
+			continue
+		}
+		if rejected[id] > 0 {
+			rejected[id]--
+			continue
+		}
+		dups = append(dups, Duplicate{Entry: e, Original: *r})
+	}
+	return orders, dups
+}
+
+// lastHeader returns the byte offset of the last transaction header line in
+// data, -1 if there is none.
+func lastHeader(data []byte) int {
+	last := -1
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			end = len(data) - start
+		}
+		if HeaderRe.Match(data[start : start+end]) {
+			last = start
+		}
+		start += end + 1
+	}
+	return last
+}
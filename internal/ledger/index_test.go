@@ -0,0 +1,94 @@
+package ledger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLedgerIndexIncremental(t *testing.T) {
+	root, bcPath := newLedger(t, "; beancount append-only trade ledger\n")
+	ix := OpenIndex(root)
+	order := func(id string) string {
+		return orderText("2026-01-01", id, "BUY", "AAPL.US", "1", "")
+	}
+	fill := func(id string) string {
+		return fillText("2026-01-01", id, "BUY", "AAPL.US", "1", "100")
+	}
+	pending := func(wantOrders, wantDups int) {
+		t.Helper()
+		if _, err := ix.Refresh(); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+		orders, dups := ix.Pending()
+		if len(orders) != wantOrders || len(dups) != wantDups {
+			t.Fatalf("Pending = %d orders, %d duplicates; want %d, %d", len(orders), len(dups), wantOrders, wantDups)
+		}
+	}
+
+	// Only the appended ORDER is new
+	appendText(t, bcPath, order("ix-1"))
+	pending(1, 0)
+	appendText(t, bcPath, fill("ix-1"), order("ix-2"))
+	pending(1, 0)
+	appendText(t, bcPath, fill("ix-2"))
+	pending(0, 0)
+
+	// After compaction the ledger is re-read and the block indexed; an
+	// ORDER reusing a compacted intent_id is a duplicate until rejected
+	if err := CompactBlocks(root, 1); err != nil {
+		t.Fatalf("CompactBlocks: %v", err)
+	}
+	appendText(t, bcPath, order("ix-1"))
+	pending(0, 1)
+	appendText(t, bcPath, duplicateText("2026-01-01", "ix-1"))
+	pending(0, 0)
+
+	// A duplicate in the live ledger too, even in the same append
+	appendText(t, bcPath, order("ix-4")+order("ix-4"))
+	pending(1, 1)
+	appendText(t, bcPath, fill("ix-4"), duplicateText("2026-01-01", "ix-4"))
+	pending(0, 0)
+
+	// Rejected duplicates are compacted with or after their original
+	if err := CompactBlocks(root, 1); err != nil {
+		t.Fatalf("CompactBlocks: %v", err)
+	}
+	data, err := os.ReadFile(bcPath)
+	if err != nil {
+		t.Fatalf("read ledger: %v", err)
+	}
+	if strings.Contains(string(data), "intent_id:") {
+		t.Errorf("expected every intent compacted:\n%s", data)
+	}
+	pending(0, 0)
+
+	var index struct {
+		Blocks  []string                `json:"blocks"`
+		Intents map[string]IntentRecord `json:"intents"`
+	}
+	data, err = os.ReadFile(filepath.Join(root, "trade", IndexFile))
+	if err != nil {
+		t.Fatalf("read index: %v", err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("parse index: %v", err)
+	}
+	for _, id := range []string{"ix-1", "ix-2", "ix-4"} {
+		r := index.Intents[id]
+		if !r.Processed || r.Block == "" || r.Status != "FILLED" || r.Symbol != "AAPL.US" {
+			t.Errorf("unexpected record of %s: %+v", id, r)
+		}
+	}
+	if len(index.Blocks) != 2 {
+		t.Errorf("expected 2 indexed blocks, got %v", index.Blocks)
+	}
+
+	// A ledger rewritten in place is re-read in full
+	if err := os.WriteFile(bcPath, []byte(order("ix-3")), 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	pending(1, 0)
+}
@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newLedger creates root/trade/beancount.txt holding text under a fresh
+// root and returns the root and the ledger path.
+func newLedger(t *testing.T, text string) (root, bcPath string) {
+	t.Helper()
+	root = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "trade"), 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	bcPath = filepath.Join(root, "trade", "beancount.txt")
+	if err := os.WriteFile(bcPath, []byte(text), 0644); err != nil {
+		t.Fatalf("write ledger: %v", err)
+	}
+	return root, bcPath
+}
+
+// appendText appends entries to the ledger at bcPath.
+func appendText(t *testing.T, bcPath string, entries ...string) {
+	t.Helper()
+	if err := Append(bcPath, strings.Join(entries, "")); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+}
+
+// orderText renders an ORDER entry: a LIMIT order if price is set, else a
+// MARKET one. extra meta lines ("key: value") are appended as given.
+func orderText(date, id, side, symbol, qty, price string, extra ...string) string {
+	text := fmt.Sprintf("\n%s * \"ORDER\" \"%s %s\"\n  ; intent_id: %s\n  ; side: %s\n  ; symbol: %s\n  ; qty: %s\n",
+		date, side, symbol, id, side, symbol, qty)
+	if price != "" {
+		text += "  ; type: LIMIT\n  ; price: " + price + "\n"
+	}
+	for _, m := range extra {
+		text += "  ; " + m + "\n"
+	}
+	return text
+}
+
+// fillText renders the FILLED EXECUTION the controller journals for an
+// order filled in full at price.
+func fillText(date, id, side, symbol, qty, price string) string {
+	return fmt.Sprintf("\n%s * \"EXECUTION\" \"%s %s\"\n  ; intent_id: %s\n  ; order_id: LOCAL-%s\n  ; status: FILLED\n"+
+		"  ; symbol: %s\n  ; side: %s\n  ; qty: %s\n  ; price: %s\n  ; executed_at: %sT10:00:00Z\n",
+		date, side, symbol, id, id, symbol, side, qty, price, date) + Postings(symbol, side, qty, price, "")
+}
+
+// duplicateText renders the REJECTION of an ORDER reusing intent_id id.
+func duplicateText(date, id string) string {
+	return fmt.Sprintf("\n%s * \"REJECTION\" \"BUY AAPL.US\"\n  ; intent_id: %s\n  ; status: REJECTED\n  ; reason: %s: intent_id %s already used\n",
+		date, id, ReasonDuplicateIntent, id)
+}
@@ -0,0 +1,340 @@
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"longbridge-fs/internal/model"
+)
+
+// LintFile is the lint report the controller writes next to beancount.txt
+// (controller --lint).
+const LintFile = "lint.json"
+
+// Lint diagnostic codes.
+const (
+	LintBadHeader       = "BAD_HEADER"       // dated line that is not a transaction header
+	LintOrphanMeta      = "ORPHAN_META"      // meta or indented line outside any entry
+	LintBadMeta         = "BAD_META"         // line inside an entry the parser ignores
+	LintNotIndented     = "NOT_INDENTED"     // meta line without leading indentation
+	LintDuplicateKey    = "DUPLICATE_KEY"    // key repeated within an entry
+	LintUnknownType     = "UNKNOWN_TYPE"     // header type the controller doesn't know
+	LintUnknownKey      = "UNKNOWN_KEY"      // ORDER key the controller doesn't read
+	LintMissingField    = "MISSING_FIELD"    // required ORDER field absent
+	LintInvalidValue    = "INVALID_VALUE"    // ORDER field the controller would reject
+	LintDuplicateIntent = "DUPLICATE_INTENT" // intent_id of an earlier ORDER in the file
+)
+
+// entryTypes are the transaction types the controller reads or writes.
+var entryTypes = map[string]bool{
+	"ORDER": true, "SUBMITTED": true, "EXECUTION": true, "REJECTION": true, "ALGO": true,
+}
+
+// orderKeys are the ORDER meta keys read by OrderFromEntry, plus reason,
+// which risk-triggered ORDERs carry.
+var orderKeys = []string{
+	"intent_id", "side", "symbol", "qty", "type", "tif", "expire_date", "price", "market",
+	"source", "rebalance_id", "signal_refs",
+	"algo", "algo_duration", "algo_slices", "algo_repeg", "algo_variance", "algo_start", "algo_end", "algo_pov_rate",
+	"action", "order_id",
+	"trigger_price", "trailing_amount", "trailing_percent", "limit_offset",
+	"group_id", "take_profit", "stop_loss", "stop_limit", "exit_tif",
+	"reason",
+}
+
+var knownOrderKeys = func() map[string]bool {
+	m := make(map[string]bool, len(orderKeys))
+	for _, k := range orderKeys {
+		m[k] = true
+	}
+	return m
+}()
+
+var (
+	datedLineRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\b`)
+	keyValueRe  = regexp.MustCompile(`^;?\s*[A-Za-z_]+\s*[=:]`)
+	postingRe   = regexp.MustCompile(`^\s+(Assets|Liabilities|Equity|Income|Expenses):`)
+	symbolRe    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.]*$`)
+)
+
+// Diagnostic is one finding of Lint, on a 1-based line.
+type Diagnostic struct {
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	IntentID string `json:"intent_id,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintReport is the result of linting a ledger file.
+type LintReport struct {
+	Path        string       `json:"path"`
+	CheckedAt   string       `json:"checked_at"`
+	Entries     int          `json:"entries"`
+	Errors      int          `json:"errors"`
+	Warnings    int          `json:"warnings"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// lintEntry is an entry being linted: its header line and where each meta
+// key was written.
+type lintEntry struct {
+	line int
+	typ  string
+	meta map[string]string
+	keys map[string]int // key -> line
+}
+
+type linter struct {
+	diags  []Diagnostic
+	orders map[string]int // intent_id -> line of its first ORDER
+}
+
+func (l *linter) add(line int, severity, code, intentID, format string, args ...any) {
+	l.diags = append(l.diags, Diagnostic{Line: line, Severity: severity, Code: code, IntentID: intentID, Message: fmt.Sprintf(format, args...)})
+}
+
+// Lint checks ledger text the way the controller reads it and reports what
+// it would silently ignore or reject: malformed headers (whose lines the
+// parser reads into the previous entry), meta lines outside entries or not
+// written as `; key: value`, unknown entry types and ORDER keys, and ORDERs
+// with missing or invalid fields. Diagnostics are sorted by line.
+func Lint(data string) []Diagnostic {
+	l := &linter{orders: make(map[string]int)}
+	var cur *lintEntry
+	skipping := false // lines after a malformed header
+
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		trimmed := strings.TrimSpace(line)
+		indented := trimmed != "" && line[0] != trimmed[0]
+
+		if m := HeaderRe.FindStringSubmatch(line); m != nil {
+			l.finish(cur)
+			cur = &lintEntry{line: n, typ: m[2], meta: make(map[string]string), keys: make(map[string]int)}
+			skipping = false
+			continue
+		}
+		if datedLineRe.MatchString(line) {
+			l.finish(cur)
+			cur, skipping = nil, true
+			l.add(n, SeverityError, LintBadHeader, "",
+				"malformed header, want YYYY-MM-DD * \"TYPE\" \"description\"; the controller reads this entry as part of the previous one")
+			continue
+		}
+		if trimmed == "" || skipping {
+			continue
+		}
+
+		if cur == nil {
+			switch {
+			case !indented && strings.HasPrefix(trimmed, ";"):
+				// file comment (header, chain_head)
+			case indented:
+				l.add(n, SeverityError, LintOrphanMeta, "", "line outside any entry (no header above it)")
+			default:
+				l.add(n, SeverityError, LintOrphanMeta, "", "unparsable line outside any entry")
+			}
+			continue
+		}
+
+		if !strings.HasPrefix(trimmed, ";") {
+			switch {
+			case cur.typ == "EXECUTION" && postingRe.MatchString(line):
+				// double-entry posting
+			case keyValueRe.MatchString(trimmed):
+				l.add(n, SeverityError, LintBadMeta, cur.meta["intent_id"], "meta line without \";\" is ignored, write \"; key: value\"")
+			default:
+				l.add(n, SeverityError, LintBadMeta, cur.meta["intent_id"], "unparsable line inside the entry")
+			}
+			continue
+		}
+
+		k, v := ParseMeta(line)
+		if k == "" {
+			if keyValueRe.MatchString(trimmed) {
+				l.add(n, SeverityError, LintBadMeta, cur.meta["intent_id"], "\"key=value\" is ignored, write \"; key: value\"")
+			}
+			continue // plain comment
+		}
+		prev, dup := cur.keys[k]
+		cur.meta[k] = v
+		cur.keys[k] = n
+		if !indented {
+			l.add(n, SeverityWarning, LintNotIndented, cur.meta["intent_id"], "meta line %q is not indented (invalid beancount)", k)
+		}
+		if dup {
+			l.add(n, SeverityWarning, LintDuplicateKey, cur.meta["intent_id"], "%s already set on line %d, this value wins", k, prev)
+		}
+	}
+	l.finish(cur)
+
+	sort.SliceStable(l.diags, func(i, j int) bool { return l.diags[i].Line < l.diags[j].Line })
+	return l.diags
+}
+
+// finish checks a complete entry.
+func (l *linter) finish(e *lintEntry) {
+	if e == nil {
+		return
+	}
+	if !entryTypes[e.typ] {
+		l.add(e.line, SeverityWarning, LintUnknownType, e.meta["intent_id"], "unknown entry type %q, ignored by the controller", e.typ)
+		return
+	}
+	if e.typ != "ORDER" {
+		return // written by the controller
+	}
+
+	id := e.meta["intent_id"]
+	if id == "" {
+		l.add(e.line, SeverityError, LintMissingField, "", "ORDER without intent_id is ignored")
+	} else if first, ok := l.orders[id]; ok {
+		l.add(e.line, SeverityWarning, LintDuplicateIntent, id, "intent_id already used by the ORDER on line %d, this one will be rejected", first)
+	} else {
+		l.orders[id] = e.line
+	}
+
+	for k, line := range e.keys {
+		if knownOrderKeys[k] {
+			continue
+		}
+		msg := fmt.Sprintf("unknown ORDER key %q, ignored by the controller", k)
+		if s := suggestKey(k); s != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", s)
+		}
+		l.add(line, SeverityWarning, LintUnknownKey, id, "%s", msg)
+	}
+
+	fieldErr := func(field, format string, args ...any) {
+		code, line := LintInvalidValue, e.keys[field]
+		if line == 0 {
+			code, line = LintMissingField, e.line
+		}
+		l.add(line, SeverityError, code, id, format, args...)
+	}
+
+	switch strings.ToUpper(e.meta["action"]) {
+	case "":
+	case "CANCEL":
+		if e.meta["order_id"] == "" {
+			fieldErr("order_id", "CANCEL requires order_id")
+		}
+		return
+	case "REPLACE":
+		if e.meta["order_id"] == "" {
+			fieldErr("order_id", "REPLACE requires order_id")
+		}
+		o, _ := OrderFromEntry(model.Entry{Type: e.typ, Meta: e.meta})
+		if o.Qty == "" && o.Price == "" && o.TriggerPrice == "" && o.TrailingAmount == "" && o.TrailingPercent == "" && o.LimitOffset == "" {
+			l.add(e.line, SeverityError, LintMissingField, id, "REPLACE has nothing to amend (qty, price, trigger_price, trailing_amount, trailing_percent or limit_offset)")
+		} else if err := ValidateAmendment(o); err != nil {
+			// Messages start with the offending field
+			line := e.keys[strings.Fields(err.Error())[0]]
+			if line == 0 {
+				line = e.line
+			}
+			l.add(line, SeverityError, LintInvalidValue, id, "%v", err)
+		}
+		return
+	default:
+		l.add(e.keys["action"], SeverityError, LintInvalidValue, id, "unknown action %q (want CANCEL or REPLACE)", e.meta["action"])
+		return
+	}
+
+	if sym := e.meta["symbol"]; sym == "" {
+		fieldErr("symbol", "symbol is required")
+	} else if !symbolRe.MatchString(sym) {
+		fieldErr("symbol", "symbol %q must be CODE.MARKET, e.g. AAPL.US or 700.HK", sym)
+	}
+	if _, err := OrderFromEntry(model.Entry{Type: e.typ, Meta: e.meta}); err != nil {
+		// Point at the field the message names ("qty must be ...",
+		// "unknown tif ..."), else at the header
+		code, line := LintInvalidValue, e.line
+		words := strings.Fields(err.Error())
+		for _, w := range words[:min(3, len(words))] {
+			if e.keys[w] > 0 {
+				line = e.keys[w]
+				break
+			}
+		}
+		if strings.HasSuffix(err.Error(), " is required") {
+			code, line = LintMissingField, e.line
+		}
+		l.add(line, SeverityError, code, id, "%s", err.Error())
+	}
+}
+
+// suggestKey returns the ORDER key k is most likely a typo of, if any.
+func suggestKey(k string) string {
+	best, bestDist := "", 3
+	for _, known := range orderKeys {
+		if d := editDistance(strings.ToLower(k), known); d < bestDist {
+			best, bestDist = known, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// LintLedgerFile lints the ledger at path, read under its lock.
+func LintLedgerFile(path string) (*LintReport, error) {
+	data, err := readLedger(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &LintReport{
+		Path:        path,
+		CheckedAt:   time.Now().UTC().Format(time.RFC3339),
+		Entries:     countEntries(string(data)),
+		Diagnostics: Lint(string(data)),
+	}
+	if r.Diagnostics == nil {
+		r.Diagnostics = []Diagnostic{}
+	}
+	for _, d := range r.Diagnostics {
+		if d.Severity == SeverityError {
+			r.Errors++
+		} else {
+			r.Warnings++
+		}
+	}
+	return r, nil
+}
+
+// WriteLintReport lints root's live ledger and writes trade/lint.json.
+func WriteLintReport(root string) (*LintReport, error) {
+	r, err := LintLedgerFile(filepath.Join(root, "trade", "beancount.txt"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return r, WriteFileAtomic(filepath.Join(root, "trade", LintFile), append(data, '\n'), 0644)
+}
@@ -0,0 +1,81 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLedgerLint(t *testing.T) {
+	text := `; beancount append-only trade ledger
+
+2026-01-01 * "ORDER" "BUY AAPL"
+  ; intent_id: l-1
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qyt: 10
+
+2026-01-01 ORDER
+  intent_id: l-2
+  side: SELL
+
+2026-01-02 * "ORDER" "BUY AAPL"
+  ; intent_id: l-1
+  ; side: BUY
+  ; symbol: AAPL.US
+  ; qty: 1.5
+  qty=2
+`
+	want := []struct {
+		line int
+		code string
+	}{
+		{3, LintMissingField},     // qty is required
+		{7, LintUnknownKey},       // qyt
+		{9, LintBadHeader},        // lines 10-11 belong to it
+		{13, LintDuplicateIntent}, // l-1 again
+		{17, LintInvalidValue},    // qty 1.5
+		{18, LintBadMeta},         // qty=2
+	}
+	diags := Lint(text)
+	if len(diags) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %+v", len(want), diags)
+	}
+	for i, w := range want {
+		if diags[i].Line != w.line || diags[i].Code != w.code {
+			t.Errorf("diagnostic %d: got line %d %s (%s), want line %d %s", i, diags[i].Line, diags[i].Code, diags[i].Message, w.line, w.code)
+		}
+	}
+	if !strings.Contains(diags[1].Message, `did you mean "qty"`) {
+		t.Errorf("expected a suggestion, got %q", diags[1].Message)
+	}
+}
+
+func TestLintActions(t *testing.T) {
+	tests := []struct {
+		name string
+		meta string
+		code string // empty: expect a clean entry
+	}{
+		{"lowercase cancel", "  ; action: cancel\n  ; order_id: 1001\n", ""},
+		{"cancel with side", "  ; action: CANCEL\n  ; order_id: 1001\n  ; side: BUY\n", ""},
+		{"cancel without order_id", "  ; action: CANCEL\n", LintMissingField},
+		{"unknown action", "  ; action: CANCLE\n  ; order_id: 1001\n", LintInvalidValue},
+		{"replace", "  ; action: replace\n  ; order_id: 1001\n  ; price: 181\n", ""},
+		{"replace nothing", "  ; action: REPLACE\n  ; order_id: 1001\n", LintMissingField},
+		{"replace bad qty", "  ; action: REPLACE\n  ; order_id: 1001\n  ; qty: -5\n", LintInvalidValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := Lint("2026-01-01 * \"ORDER\" \"ACTION\"\n  ; intent_id: a-1\n" + tt.meta)
+			if tt.code == "" {
+				if len(diags) != 0 {
+					t.Fatalf("expected no diagnostics, got %+v", diags)
+				}
+				return
+			}
+			if len(diags) != 1 || diags[0].Code != tt.code {
+				t.Fatalf("expected one %s, got %+v", tt.code, diags)
+			}
+		})
+	}
+}
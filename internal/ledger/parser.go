@@ -1,10 +1,11 @@
 package ledger
 
 import (
-	"os"
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"longbridge-fs/internal/model"
 )
@@ -15,13 +16,17 @@ var HeaderRe = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+\*\s+"(\w+)"\s+"(.+)"`
 
 // ParseEntries parses a beancount file into a list of entries.
 // Each entry starts with a header line and continues with indented meta lines.
+// A locked ledger is read under its shared lock (see Append).
 func ParseEntries(path string) ([]model.Entry, error) {
-	data, err := os.ReadFile(path)
+	data, err := readLedger(path)
 	if err != nil {
 		return nil, err
 	}
+	return parseEntries(string(data)), nil
+}
 
-	lines := strings.Split(string(data), "\n")
+func parseEntries(data string) []model.Entry {
+	lines := strings.Split(data, "\n")
 	var entries []model.Entry
 	var current *model.Entry
 
@@ -49,7 +54,7 @@ func ParseEntries(path string) ([]model.Entry, error) {
 		entries = append(entries, *current)
 	}
 
-	return entries, nil
+	return entries
 }
 
 // ParseMeta extracts key-value from a beancount meta comment line like:
@@ -66,23 +71,41 @@ func ParseMeta(line string) (string, string) {
 	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 }
 
-// OrderFromEntry extracts a ParsedOrder from an ORDER entry.
-func OrderFromEntry(e model.Entry) model.ParsedOrder {
+// OrderFromEntry extracts a ParsedOrder from an ORDER entry. The order is
+// always returned; err reports why it cannot be submitted as written.
+func OrderFromEntry(e model.Entry) (model.ParsedOrder, error) {
 	o := model.ParsedOrder{
-		IntentID:  e.Meta["intent_id"],
-		Side:      strings.ToUpper(e.Meta["side"]),
-		Symbol:    e.Meta["symbol"],
-		Qty:       e.Meta["qty"],
-		OrderType: strings.ToUpper(e.Meta["type"]),
-		TIF:       strings.ToUpper(e.Meta["tif"]),
-		Price:     e.Meta["price"],
-		Market:    e.Meta["market"],
+		IntentID:   e.Meta["intent_id"],
+		Side:       strings.ToUpper(e.Meta["side"]),
+		Symbol:     e.Meta["symbol"],
+		Qty:        e.Meta["qty"],
+		OrderType:  strings.ToUpper(e.Meta["type"]),
+		TIF:        strings.ToUpper(e.Meta["tif"]),
+		ExpireDate: e.Meta["expire_date"],
+		Price:      e.Meta["price"],
+		Market:     e.Meta["market"],
 		// Phase 1: Extended metadata fields
 		Source:      e.Meta["source"],
 		RebalanceID: e.Meta["rebalance_id"],
 		// Phase 4: Algorithm execution fields
 		Algo:         strings.ToUpper(e.Meta["algo"]),
 		AlgoDuration: e.Meta["algo_duration"],
+		AlgoStart:    e.Meta["algo_start"],
+		AlgoEnd:      e.Meta["algo_end"],
+		// Order management
+		Action:  strings.ToUpper(e.Meta["action"]),
+		OrderID: e.Meta["order_id"],
+		// Conditional orders
+		TriggerPrice:    e.Meta["trigger_price"],
+		TrailingAmount:  e.Meta["trailing_amount"],
+		TrailingPercent: e.Meta["trailing_percent"],
+		LimitOffset:     e.Meta["limit_offset"],
+		// Order groups
+		GroupID:    e.Meta["group_id"],
+		TakeProfit: e.Meta["take_profit"],
+		StopLoss:   e.Meta["stop_loss"],
+		StopLimit:  e.Meta["stop_limit"],
+		ExitTIF:    strings.ToUpper(e.Meta["exit_tif"]),
 	}
 
 	// Parse signal_refs (comma-separated)
@@ -101,6 +124,28 @@ func OrderFromEntry(e model.Entry) model.ParsedOrder {
 		}
 	}
 
+	if v := e.Meta["algo_repeg"]; v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("algo_repeg must be true or false, got %q", v)
+		}
+		o.AlgoRepeg = b
+	}
+	if v := e.Meta["algo_variance"]; v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f >= 1 {
+			return o, fmt.Errorf("algo_variance must be a fraction in [0, 1), got %q", v)
+		}
+		o.AlgoVariance = f
+	}
+	if v := e.Meta["algo_pov_rate"]; v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return o, fmt.Errorf("algo_pov_rate must be a fraction in (0, 1], got %q", v)
+		}
+		o.AlgoPovRate = f
+	}
+
 	if o.Market == "" {
 		o.Market = "US"
 	}
@@ -110,7 +155,159 @@ func OrderFromEntry(e model.Entry) model.ParsedOrder {
 	if o.OrderType == "" {
 		o.OrderType = "MARKET"
 	}
-	return o
+	if o.OrderType == "BRACKET" || o.OrderType == "OCO" {
+		if o.GroupID == "" {
+			o.GroupID = o.IntentID
+		}
+		if o.ExitTIF == "" {
+			o.ExitTIF = "GTC"
+		}
+	}
+	switch o.Action {
+	case "":
+		return o, ValidateOrder(o)
+	case "CANCEL":
+		// Only order_id matters; side/qty are informational
+		if o.OrderID == "" {
+			return o, fmt.Errorf("order_id is required for CANCEL")
+		}
+		return o, nil
+	case "REPLACE":
+		// Amended fields are checked against the order being replaced
+		return o, nil
+	default:
+		return o, fmt.Errorf("unknown action %q (want CANCEL or REPLACE)", o.Action)
+	}
+}
+
+// orderTypes lists the ORDER types the controller can submit. Aliases map to
+// the same venue type (see broker.MapOrderType).
+var orderTypes = map[string]bool{
+	"MARKET": true, "MO": true,
+	"LIMIT": true, "LO": true,
+	"ELO": true, "ALO": true,
+	"LIT": true, "MIT": true,
+	"TSLPAMT": true, "TSLPPCT": true,
+	"BRACKET": true, "OCO": true,
+}
+
+// ValidateOrder rejects anything the venue would otherwise have to guess:
+// side must be BUY/SELL, qty a positive integer, tif DAY/GTC/GTD (GTD with
+// expire_date), and the order type one of orderTypes with its fields set:
+//
+//	LIMIT/ELO/ALO  price
+//	LIT            price + trigger_price
+//	MIT            trigger_price
+//	TSLPAMT        trailing_amount + limit_offset
+//	TSLPPCT        trailing_percent (0-100) + limit_offset
+func ValidateOrder(o model.ParsedOrder) error {
+	switch o.Side {
+	case "BUY", "SELL":
+	case "":
+		return fmt.Errorf("side is required")
+	default:
+		return fmt.Errorf("unknown side %q (want BUY or SELL)", o.Side)
+	}
+
+	if o.Qty == "" {
+		return fmt.Errorf("qty is required")
+	}
+	if n, err := strconv.ParseInt(o.Qty, 10, 64); err != nil || n <= 0 {
+		return fmt.Errorf("qty must be a positive integer, got %q", o.Qty)
+	}
+
+	switch o.TIF {
+	case "DAY", "GTC":
+	case "GTD":
+		if o.ExpireDate == "" {
+			return fmt.Errorf("expire_date is required for GTD orders")
+		}
+		if _, err := time.Parse("2006-01-02", o.ExpireDate); err != nil {
+			return fmt.Errorf("expire_date must be YYYY-MM-DD, got %q", o.ExpireDate)
+		}
+	default:
+		return fmt.Errorf("unknown tif %q (want DAY, GTC or GTD)", o.TIF)
+	}
+
+	if !orderTypes[o.OrderType] {
+		return fmt.Errorf("unsupported order type %q", o.OrderType)
+	}
+
+	switch o.OrderType {
+	case "LIMIT", "LO", "ELO", "ALO":
+		return positive("price", o.Price)
+	case "LIT":
+		if err := positive("price", o.Price); err != nil {
+			return err
+		}
+		return positive("trigger_price", o.TriggerPrice)
+	case "MIT":
+		return positive("trigger_price", o.TriggerPrice)
+	case "TSLPAMT":
+		if err := positive("trailing_amount", o.TrailingAmount); err != nil {
+			return err
+		}
+		return nonNegative("limit_offset", o.LimitOffset)
+	case "TSLPPCT":
+		if err := positive("trailing_percent", o.TrailingPercent); err != nil {
+			return err
+		}
+		if p, _ := strconv.ParseFloat(o.TrailingPercent, 64); p >= 100 {
+			return fmt.Errorf("trailing_percent must be below 100, got %q", o.TrailingPercent)
+		}
+		return nonNegative("limit_offset", o.LimitOffset)
+	}
+	return nil
+}
+
+// ValidateAmendment checks the fields a REPLACE sets. The rest of the order
+// is the venue's, which may not report every field ValidateOrder needs.
+func ValidateAmendment(o model.ParsedOrder) error {
+	if o.Qty != "" {
+		if n, err := strconv.ParseInt(o.Qty, 10, 64); err != nil || n <= 0 {
+			return fmt.Errorf("qty must be a positive integer, got %q", o.Qty)
+		}
+	}
+	for _, f := range []struct{ name, v string }{
+		{"price", o.Price},
+		{"trigger_price", o.TriggerPrice},
+		{"trailing_amount", o.TrailingAmount},
+		{"trailing_percent", o.TrailingPercent},
+	} {
+		if f.v == "" {
+			continue
+		}
+		if err := positive(f.name, f.v); err != nil {
+			return err
+		}
+	}
+	if p, _ := strconv.ParseFloat(o.TrailingPercent, 64); p >= 100 {
+		return fmt.Errorf("trailing_percent must be below 100, got %q", o.TrailingPercent)
+	}
+	if o.LimitOffset != "" {
+		return nonNegative("limit_offset", o.LimitOffset)
+	}
+	return nil
+}
+
+func positive(field, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f <= 0 {
+		return fmt.Errorf("%s must be a positive number, got %q", field, v)
+	}
+	return nil
+}
+
+func nonNegative(field, v string) error {
+	if v == "" {
+		return fmt.Errorf("%s is required", field)
+	}
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f < 0 {
+		return fmt.Errorf("%s must be a non-negative number, got %q", field, v)
+	}
+	return nil
 }
 
 // FullSymbol returns a symbol with market suffix, e.g. "NVDA" -> "NVDA.US"
@@ -121,19 +318,24 @@ func FullSymbol(symbol, market string) string {
 	return symbol + "." + market
 }
 
-// BuildLedgerState scans entries and returns a set of intent_ids that already
-// have an EXECUTION or REJECTION, plus all ORDER entries.
-func BuildLedgerState(entries []model.Entry) (processed map[string]bool, orders []model.Entry) {
-	processed = make(map[string]bool)
-	for _, e := range entries {
-		switch e.Type {
-		case "EXECUTION", "REJECTION":
-			if id := e.Meta["intent_id"]; id != "" {
-				processed[id] = true
-			}
-		case "ORDER":
-			orders = append(orders, e)
-		}
+// IsTerminalStatus reports whether an EXECUTION status ends an intent's life.
+// Entries written before statuses were tracked have no status and count as
+// filled; REPLACED completes the REPLACE intent, not the amended order.
+func IsTerminalStatus(status string) bool {
+	switch strings.ToUpper(status) {
+	case "", "FILLED", "CANCELLED", "EXPIRED", "REJECTED", "REPLACED":
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTerminalAlgoStatus reports whether an ALGO entry status ends the task.
+func IsTerminalAlgoStatus(status string) bool {
+	switch strings.ToUpper(status) {
+	case "COMPLETED", "CANCELLED", "ABANDONED":
+		return true
+	default:
+		return false
 	}
-	return
 }
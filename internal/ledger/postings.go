@@ -0,0 +1,212 @@
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AccountsFile is the generated beancount entry point next to beancount.txt:
+// commodity declarations, open directives and includes of the ledger and
+// its blocks, so `bean-check trade/accounts.beancount` sees the full history.
+const AccountsFile = "accounts.beancount"
+
+// openDate dates every generated directive, before any possible posting.
+const openDate = "1970-01-01"
+
+// marketCurrency maps a symbol's market suffix to its trading currency.
+var marketCurrency = map[string]string{
+	"US": "USD",
+	"HK": "HKD",
+	"SH": "CNY",
+	"SZ": "CNY",
+	"SG": "SGD",
+}
+
+// Currency returns the trading currency of a full symbol (e.g. AAPL.US ->
+// USD), empty if the market is unknown.
+func Currency(symbol string) string {
+	i := strings.LastIndex(symbol, ".")
+	if i < 0 {
+		return ""
+	}
+	return marketCurrency[strings.ToUpper(symbol[i+1:])]
+}
+
+// Commodity returns the beancount commodity of a full symbol: the code for
+// codes starting with a letter (AAPL.US -> AAPL, BRK.B.US -> BRK.B), the
+// market plus the code otherwise (700.HK -> HK700). One-letter codes keep
+// the market (F.US), as commodities need two characters. Empty if the
+// symbol has no known market.
+func Commodity(symbol string) string {
+	i := strings.LastIndex(symbol, ".")
+	if i <= 0 || Currency(symbol) == "" {
+		return ""
+	}
+	code, mkt := strings.ToUpper(symbol[:i]), strings.ToUpper(symbol[i+1:])
+	switch {
+	case code[0] < 'A' || code[0] > 'Z':
+		code = mkt + code
+	case len(code) == 1:
+		code += "." + mkt
+	}
+	var b strings.Builder
+	for _, r := range code {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	return strings.TrimRight(b.String(), ".-_")
+}
+
+// brokerAccounts names the beancount accounts of a symbol's market.
+type brokerAccounts struct {
+	position, cash, fees, pnl string
+}
+
+func accountsFor(symbol string) brokerAccounts {
+	mkt := strings.ToUpper(symbol[strings.LastIndex(symbol, ".")+1:])
+	leaf := strings.NewReplacer(".", "-", "_", "-").Replace(Commodity(symbol))
+	base := "Broker:" + mkt
+	return brokerAccounts{
+		position: "Assets:" + base + ":" + leaf,
+		cash:     "Assets:" + base + ":Cash",
+		fees:     "Expenses:" + base + ":Fees",
+		pnl:      "Income:" + base + ":PnL",
+	}
+}
+
+// Postings renders the double-entry postings of a fill: the position at
+// cost against cash, plus fees. A SELL reduces lots at cost (FIFO, see
+// WriteAccounts) and books the difference to PnL. Empty if the fill cannot
+// be valued (unknown market, no side, zero quantity or price).
+func Postings(symbol, side, qty, price, fee string) string {
+	q, _ := strconv.ParseFloat(qty, 64)
+	p, _ := strconv.ParseFloat(price, 64)
+	f, _ := strconv.ParseFloat(fee, 64)
+	cur, com := Currency(symbol), Commodity(symbol)
+	if cur == "" || com == "" || q <= 0 || p <= 0 || (side != "BUY" && side != "SELL") {
+		return ""
+	}
+	acc := accountsFor(symbol)
+
+	var text string
+	if side == "BUY" {
+		text += fmt.Sprintf("  %s  %s %s {%s %s}\n", acc.position, decimal(q), com, decimal(p), cur)
+	} else {
+		text += fmt.Sprintf("  %s  -%s %s {} @ %s %s\n", acc.position, decimal(q), com, decimal(p), cur)
+	}
+	if f > 0 {
+		text += fmt.Sprintf("  %s  %s %s\n", acc.fees, decimal(f), cur)
+	}
+	if side == "BUY" {
+		text += fmt.Sprintf("  %s  %s %s\n", acc.cash, decimal(-(q*p + f)), cur)
+	} else {
+		text += fmt.Sprintf("  %s  %s %s\n", acc.cash, decimal(q*p-f), cur)
+		text += fmt.Sprintf("  %s\n", acc.pnl)
+	}
+	return text
+}
+
+// decimal formats v without float noise.
+func decimal(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e8)/1e8, 'f', -1, 64)
+}
+
+// EnsureAccounts regenerates tradeDir's accounts.beancount if it does not
+// open the position account of symbol yet.
+func EnsureAccounts(tradeDir, symbol string) error {
+	if Commodity(symbol) == "" {
+		return nil
+	}
+	data, _ := os.ReadFile(filepath.Join(tradeDir, AccountsFile))
+	if strings.Contains(string(data), " open "+accountsFor(symbol).position+" ") {
+		return nil
+	}
+	return WriteAccounts(tradeDir)
+}
+
+// WriteAccounts generates tradeDir's accounts.beancount from the symbols
+// executed in beancount.txt and the compacted blocks. Position accounts use
+// FIFO booking so sells reduce the oldest lots.
+func WriteAccounts(tradeDir string) error {
+	blocks, _ := filepath.Glob(filepath.Join(tradeDir, "blocks", "*", "data"))
+	sort.Strings(blocks)
+
+	symbols := make(map[string]bool)
+	for _, path := range append([]string{filepath.Join(tradeDir, "beancount.txt")}, blocks...) {
+		entries, err := ParseEntries(path)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if sym := e.Meta["symbol"]; e.Type == "EXECUTION" && Commodity(sym) != "" {
+				symbols[sym] = true
+			}
+		}
+	}
+
+	currencies := make(map[string]bool)
+	commodities := make(map[string]bool)
+	opens := make(map[string]string) // account -> currency constraint and booking
+	for sym := range symbols {
+		cur, acc := Currency(sym), accountsFor(sym)
+		currencies[cur] = true
+		commodities[Commodity(sym)] = true
+		opens[acc.position] = Commodity(sym) + ` "FIFO"`
+		opens[acc.cash] = cur
+		opens[acc.fees] = cur
+		opens[acc.pnl] = cur
+	}
+
+	var b strings.Builder
+	b.WriteString("; Generated by longbridge-fs from the trade ledger; do not edit.\n")
+	b.WriteString("; Check the full history with: bean-check " + AccountsFile + "\n\n")
+	b.WriteString("option \"title\" \"longbridge-fs\"\n")
+	for _, cur := range sortedKeys(currencies) {
+		fmt.Fprintf(&b, "option \"operating_currency\" \"%s\"\n", cur)
+	}
+	b.WriteString("\n")
+	for _, c := range append(sortedKeys(currencies), sortedKeys(commodities)...) {
+		fmt.Fprintf(&b, "%s commodity %s\n", openDate, c)
+	}
+	if len(commodities) > 0 {
+		b.WriteString("\n")
+	}
+	accounts := make([]string, 0, len(opens))
+	for a := range opens {
+		accounts = append(accounts, a)
+	}
+	sort.Strings(accounts)
+	for _, a := range accounts {
+		fmt.Fprintf(&b, "%s open %s %s\n", openDate, a, opens[a])
+	}
+	if len(accounts) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("include \"beancount.txt\"\n")
+	for _, path := range blocks {
+		rel, err := filepath.Rel(tradeDir, path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "include \"%s\"\n", filepath.ToSlash(rel))
+	}
+	return WriteFileAtomic(filepath.Join(tradeDir, AccountsFile), []byte(b.String()), 0644)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
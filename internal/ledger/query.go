@@ -0,0 +1,222 @@
+package ledger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"longbridge-fs/internal/model"
+)
+
+// HistoryEntry is a ledger entry with its date and where it is stored.
+type HistoryEntry struct {
+	model.Entry
+	Date  string // YYYY-MM-DD from the header
+	Block string // block ID, empty for the live ledger
+}
+
+// LoadHistory returns the full history of root's ledger: the compacted
+// blocks in chain order, then the live beancount.txt.
+func LoadHistory(root string) ([]HistoryEntry, error) {
+	blocks, err := ListBlocks(root)
+	if err != nil {
+		return nil, err
+	}
+	var history []HistoryEntry
+	add := func(entries []model.Entry, block string) {
+		for _, e := range entries {
+			h := HistoryEntry{Entry: e, Block: block}
+			if m := HeaderRe.FindStringSubmatch(e.RawLines[0]); m != nil {
+				h.Date = m[1]
+			}
+			history = append(history, h)
+		}
+	}
+	for _, b := range blocks {
+		data, err := os.ReadFile(filepath.Join(b.Dir, "data"))
+		if err != nil {
+			return nil, err
+		}
+		add(parseEntries(string(data)), b.BlockID)
+	}
+	entries, err := ParseEntries(filepath.Join(root, "trade", "beancount.txt"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	add(entries, "")
+	return history, nil
+}
+
+// QueryFilter selects history entries; empty fields match everything.
+// IntentID, Source, RebalanceID and SignalRef are intent-level: an entry
+// matches through its own meta or its intent's ORDER (or the parent ORDER
+// of a group leg), so executions are found by the ORDER's source.
+type QueryFilter struct {
+	Types       []string
+	Symbols     []string
+	Sides       []string
+	From, To    string // inclusive YYYY-MM-DD
+	IntentID    string
+	Source      string
+	RebalanceID string
+	SignalRef   string
+}
+
+// intentIndex maps intent_id to the meta of its ORDER.
+type intentIndex map[string]map[string]string
+
+func newIntentIndex(history []HistoryEntry) intentIndex {
+	ix := make(intentIndex)
+	for _, h := range history {
+		id := h.Meta["intent_id"]
+		if h.Type == "ORDER" && id != "" && ix[id] == nil {
+			ix[id] = h.Meta // a duplicate ORDER doesn't replace the original
+		}
+	}
+	return ix
+}
+
+// meta looks key up on the entry, then its ORDER, then the parent ORDER.
+func (ix intentIndex) meta(h HistoryEntry, key string) string {
+	if v := h.Meta[key]; v != "" {
+		return v
+	}
+	return ix.orderMeta(h, key)
+}
+
+// orderMeta looks key up on the entry's ORDER, then the parent ORDER.
+func (ix intentIndex) orderMeta(h HistoryEntry, key string) string {
+	if o := ix[h.Meta["intent_id"]]; o[key] != "" {
+		return o[key]
+	}
+	return ix[h.Meta["parent_id"]][key]
+}
+
+// Query returns the entries of history matching f, in history order.
+func Query(history []HistoryEntry, f QueryFilter) []HistoryEntry {
+	intentMeta := newIntentIndex(history).meta
+
+	var out []HistoryEntry
+	for _, h := range history {
+		switch {
+		case !matchAny(f.Types, h.Type),
+			!matchSymbol(f.Symbols, h.Meta["symbol"]),
+			!matchAny(f.Sides, h.Meta["side"]),
+			f.From != "" && h.Date < f.From,
+			f.To != "" && h.Date > f.To,
+			f.IntentID != "" && h.Meta["intent_id"] != f.IntentID && h.Meta["parent_id"] != f.IntentID,
+			f.Source != "" && !strings.EqualFold(intentMeta(h, "source"), f.Source),
+			f.RebalanceID != "" && intentMeta(h, "rebalance_id") != f.RebalanceID,
+			f.SignalRef != "" && !hasRef(intentMeta(h, "signal_refs"), f.SignalRef):
+			continue
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
+func matchAny(want []string, v string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	for _, w := range want {
+		if strings.EqualFold(w, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSymbol compares full symbols, or just the code if the filter has no
+// market suffix (AAPL matches AAPL.US).
+func matchSymbol(want []string, symbol string) bool {
+	if len(want) == 0 {
+		return true
+	}
+	code, _, _ := strings.Cut(symbol, ".")
+	for _, w := range want {
+		if strings.EqualFold(w, symbol) || (!strings.Contains(w, ".") && strings.EqualFold(w, code)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRef(refs, ref string) bool {
+	for _, r := range strings.Split(refs, ",") {
+		if strings.TrimSpace(r) == ref {
+			return true
+		}
+	}
+	return false
+}
+
+// fill returns the quantity and price h filled, ok if h is a fill.
+func fill(h HistoryEntry) (qty, price float64, ok bool) {
+	status := h.Meta["status"]
+	if h.Type != "EXECUTION" || status == "REPLACED" || status == "SUBMITTED" {
+		return 0, 0, false
+	}
+	qty, _ = strconv.ParseFloat(h.Meta["qty"], 64)
+	price, _ = strconv.ParseFloat(h.Meta["price"], 64)
+	return qty, price, qty > 0 && price > 0
+}
+
+// SymbolSummary aggregates the fills of one symbol.
+type SymbolSummary struct {
+	Symbol       string  `json:"symbol"`
+	Fills        int     `json:"fills"`
+	BoughtQty    float64 `json:"bought_qty"`
+	BoughtValue  float64 `json:"bought_value"`
+	AvgBuyPrice  float64 `json:"avg_buy_price"`
+	SoldQty      float64 `json:"sold_qty"`
+	SoldValue    float64 `json:"sold_value"`
+	AvgSellPrice float64 `json:"avg_sell_price"`
+	NetQty       float64 `json:"net_qty"`
+	Fees         float64 `json:"fees"`
+}
+
+// Summarize aggregates the fills among entries per symbol: EXECUTION
+// entries with a quantity and price, the same ones that carry postings.
+func Summarize(entries []HistoryEntry) []SymbolSummary {
+	bySymbol := make(map[string]*SymbolSummary)
+	for _, h := range entries {
+		qty, price, ok := fill(h)
+		if !ok {
+			continue
+		}
+		sym := h.Meta["symbol"]
+		s := bySymbol[sym]
+		if s == nil {
+			s = &SymbolSummary{Symbol: sym}
+			bySymbol[sym] = s
+		}
+		s.Fills++
+		fee, _ := strconv.ParseFloat(h.Meta["fee"], 64)
+		s.Fees += fee
+		switch h.Meta["side"] {
+		case "BUY":
+			s.BoughtQty += qty
+			s.BoughtValue += qty * price
+		case "SELL":
+			s.SoldQty += qty
+			s.SoldValue += qty * price
+		}
+	}
+
+	out := make([]SymbolSummary, 0, len(bySymbol))
+	for _, s := range bySymbol {
+		if s.BoughtQty > 0 {
+			s.AvgBuyPrice = s.BoughtValue / s.BoughtQty
+		}
+		if s.SoldQty > 0 {
+			s.AvgSellPrice = s.SoldValue / s.SoldQty
+		}
+		s.NetQty = s.BoughtQty - s.SoldQty
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Symbol < out[j].Symbol })
+	return out
+}
@@ -0,0 +1,70 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLedgerQuerySpansBlocks(t *testing.T) {
+	root, bcPath := newLedger(t, "")
+	appendText(t, bcPath,
+		orderText("2026-03-01", "lq-1", "BUY", "AAPL.US", "100", "180", "source: rebalance", "rebalance_id: rebal-1"),
+		fillText("2026-03-01", "lq-1", "BUY", "AAPL.US", "100", "180"))
+	if err := CompactBlocks(root, 1); err != nil {
+		t.Fatalf("CompactBlocks: %v", err)
+	}
+	appendText(t, bcPath,
+		orderText("2026-03-02", "lq-2", "BUY", "AAPL.US", "50", "186", "signal_refs: rsi, macd"),
+		fillText("2026-03-02", "lq-2", "BUY", "AAPL.US", "50", "186"),
+		orderText("2026-03-03", "lq-3", "SELL", "AAPL.US", "30", "190"),
+		fillText("2026-03-03", "lq-3", "SELL", "AAPL.US", "30", "190"))
+
+	history, err := LoadHistory(root)
+	if err != nil {
+		t.Fatalf("LoadHistory: %v", err)
+	}
+	if len(history) != 6 || history[0].Block == "" || history[len(history)-1].Block != "" {
+		t.Fatalf("expected block entries then live ones, got %d entries", len(history))
+	}
+
+	got := Query(history, QueryFilter{Source: "rebalance", Types: []string{"EXECUTION"}})
+	if len(got) != 1 || got[0].Meta["intent_id"] != "lq-1" {
+		t.Errorf("source filter should find the compacted execution of lq-1, got %+v", got)
+	}
+	got = Query(history, QueryFilter{SignalRef: "macd", Symbols: []string{"AAPL"}})
+	if len(got) != 2 {
+		t.Errorf("signal_refs filter should match lq-2's ORDER and EXECUTION, got %d", len(got))
+	}
+	got = Query(history, QueryFilter{From: "2026-03-02", To: "2026-03-03", Types: []string{"ORDER"}})
+	if len(got) != 2 {
+		t.Errorf("date filter should match two ORDERs, got %d", len(got))
+	}
+
+	sum := Summarize(history)
+	if len(sum) != 1 || sum[0].BoughtQty != 150 || sum[0].AvgBuyPrice != 182 || sum[0].SoldQty != 30 || sum[0].NetQty != 120 {
+		t.Errorf("unexpected summary %+v", sum)
+	}
+
+	var blotter strings.Builder
+	if err := Export(&blotter, "blotter", history, history); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	rows := strings.Split(strings.TrimSpace(blotter.String()), "\n")
+	if len(rows) != 4 || rows[0] != strings.Join(BlotterColumns, ",") {
+		t.Fatalf("expected header and 3 fills:\n%s", blotter.String())
+	}
+	if !strings.Contains(rows[1], ",AAPL.US,US,USD,BUY,100,180,18000,0,-18000,lq-1,") || !strings.Contains(rows[1], ",LIMIT,rebalance,FILLED,") {
+		t.Errorf("unexpected buy row %q", rows[1])
+	}
+	if !strings.Contains(rows[3], ",SELL,30,190,5700,0,5700,lq-3,") {
+		t.Errorf("unexpected sell row %q", rows[3])
+	}
+
+	var csvOut strings.Builder
+	if err := Export(&csvOut, "csv", history, Query(history, QueryFilter{Types: ExportTypes})); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if lines := strings.Count(csvOut.String(), "\n"); lines != 7 {
+		t.Errorf("expected header and 6 entries, got %d lines:\n%s", lines, csvOut.String())
+	}
+}
@@ -0,0 +1,115 @@
+package ledger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Ledger writes follow an advisory lock protocol so the controller, its
+// algo goroutines and external agents never interleave:
+//
+//   - the lock is flock(2) on LockPath(ledger), a sidecar file that is
+//     created on demand and never removed (the ledger itself is replaced
+//     on rewrite, so it can't carry the lock)
+//   - appends take the lock exclusively and write whole entries
+//   - rewrites (compaction) take it exclusively, read the ledger, and
+//     replace it by renaming a fully written temp file
+//   - the controller reads under a shared lock, so it never sees half an
+//     entry
+//
+// From a shell: flock trade/beancount.txt.lock sh -c 'cat order.txt >> trade/beancount.txt'
+
+// LockPath returns the lock file guarding the ledger at bcPath.
+func LockPath(bcPath string) string {
+	return bcPath + ".lock"
+}
+
+// WithLock runs fn holding the exclusive lock of the ledger at bcPath.
+// fn must not call ParseEntries or Append on the same ledger.
+func WithLock(bcPath string, fn func() error) error {
+	unlock, err := lockFile(LockPath(bcPath), true)
+	if err != nil {
+		return fmt.Errorf("lock ledger: %w", err)
+	}
+	defer unlock()
+	return fn()
+}
+
+// Append appends text (one or more whole entries) to the ledger at bcPath
+// under its lock, creating the ledger if needed.
+func Append(bcPath, text string) error {
+	return WithLock(bcPath, func() error {
+		f, err := os.OpenFile(bcPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteString(text); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// readLedger reads path under a shared lock if it has a lock file; files
+// nobody locks (blocks, exports) are read directly.
+func readLedger(path string) ([]byte, error) {
+	data, _, _, err := readLedgerFrom(path, nil, 0)
+	return data, err
+}
+
+// readLedgerFrom is readLedger for incremental reads: if path is still the
+// file prev describes and holds at least offset bytes, it returns the bytes
+// from offset on. Otherwise (first read, file replaced or truncated) it
+// returns the whole file with reset set.
+func readLedgerFrom(path string, prev os.FileInfo, offset int64) (data []byte, info os.FileInfo, reset bool, err error) {
+	if _, err := os.Stat(LockPath(path)); err == nil {
+		unlock, err := lockFile(LockPath(path), false)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("lock ledger: %w", err)
+		}
+		defer unlock()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer f.Close()
+	if info, err = f.Stat(); err != nil {
+		return nil, nil, false, err
+	}
+	if prev == nil || !os.SameFile(prev, info) || info.Size() < offset {
+		offset, reset = 0, true
+	}
+	data, err = io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	return data, info, reset, err
+}
+
+// WriteFileAtomic replaces path with data: it writes and syncs a temp file
+// in the same directory, then renames it over path, so readers see either
+// the old or the new content.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
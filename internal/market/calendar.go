@@ -0,0 +1,279 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // exchange time zones without relying on the host
+
+	"github.com/longbridge/openapi-go"
+	"github.com/longbridge/openapi-go/quote"
+)
+
+// Session states reported by Calendar.State.
+const (
+	SessionOpen    = "OPEN"     // inside a regular trading session
+	SessionPreOpen = "PRE_OPEN" // trading day, before the first session
+	SessionBreak   = "BREAK"    // between sessions, e.g. HK lunch break
+	SessionClosed  = "CLOSED"   // after the last session, or not a trading day
+)
+
+// calendarDays is how far ahead trading days are fetched.
+const calendarDays = 30
+
+// marketTimezones lists the markets with a cached calendar and the exchange
+// time zone their session times are given in.
+var marketTimezones = map[string]string{
+	"US": "America/New_York",
+	"HK": "Asia/Hong_Kong",
+	"CN": "Asia/Shanghai",
+	"SG": "Asia/Singapore",
+}
+
+// calendarMarkets maps symbol suffixes to the market whose calendar they
+// trade on: Shanghai and Shenzhen A-shares share the CN calendar.
+var calendarMarkets = map[string]string{
+	"SH": "CN",
+	"SZ": "CN",
+}
+
+// CalendarMarket returns the market whose calendar a symbol suffix trades on.
+func CalendarMarket(suffix string) string {
+	suffix = strings.ToUpper(suffix)
+	if mkt, ok := calendarMarkets[suffix]; ok {
+		return mkt
+	}
+	return suffix
+}
+
+// halfDayClose is when trading ends on a half trading day, exchange time.
+var halfDayClose = map[string]string{
+	"US": "13:00",
+	"HK": "12:00",
+}
+
+// Calendar is the cached trading calendar of one market, stored in
+// /quote/market/{MARKET}.json.
+type Calendar struct {
+	Market          string    `json:"market"`
+	Timezone        string    `json:"timezone"`
+	From            string    `json:"from"`    // first date covered
+	Through         string    `json:"through"` // last date covered
+	TradingDays     []string  `json:"trading_days"`
+	HalfTradingDays []string  `json:"half_trading_days,omitempty"`
+	Sessions        []Session `json:"sessions"`
+	UpdatedAt       string    `json:"updated_at"`
+}
+
+// Session is one regular trading session, HH:MM exchange time.
+type Session struct {
+	Begin string `json:"begin"`
+	End   string `json:"end"`
+}
+
+// CalendarPath returns the cache file of a market's calendar.
+func CalendarPath(root, mkt string) string {
+	return filepath.Join(root, "quote", "market", mkt+".json")
+}
+
+// LoadCalendar reads a market's cached calendar. Returns nil if the file
+// doesn't exist or can't be parsed.
+func LoadCalendar(root, mkt string) *Calendar {
+	data, err := os.ReadFile(CalendarPath(root, mkt))
+	if err != nil {
+		return nil
+	}
+	var c Calendar
+	if json.Unmarshal(data, &c) != nil {
+		return nil
+	}
+	return &c
+}
+
+// RefreshCalendars fetches trading days and sessions for every market whose
+// cache wasn't refreshed today. Failures are logged and retried next call.
+func RefreshCalendars(ctx context.Context, qc *quote.QuoteContext, root string) {
+	today := time.Now().Format("2006-01-02")
+	var stale []string
+	for mkt := range marketTimezones {
+		if c := LoadCalendar(root, mkt); c == nil || len(c.UpdatedAt) < 10 || c.UpdatedAt[:10] != today {
+			stale = append(stale, mkt)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	sort.Strings(stale)
+
+	sessions, err := qc.TradingSession(ctx)
+	if err != nil {
+		log.Printf("trading session fetch failed: %v", err)
+		return
+	}
+	regular := make(map[string][]Session)
+	for _, ms := range sessions {
+		for _, p := range ms.TradeSession {
+			if p.TradeSession != quote.TradeSessionNormal {
+				continue
+			}
+			regular[string(ms.Market)] = append(regular[string(ms.Market)], Session{Begin: hhmm(p.BegTime), End: hhmm(p.EndTime)})
+		}
+	}
+
+	dir := filepath.Join(root, "quote", "market")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("calendar mkdir: %v", err)
+		return
+	}
+	for _, mkt := range stale {
+		loc, _ := time.LoadLocation(marketTimezones[mkt])
+		begin := time.Now().In(loc).AddDate(0, 0, -1)
+		end := begin.AddDate(0, 0, calendarDays)
+		days, err := qc.TradingDays(ctx, openapi.Market(mkt), &begin, &end)
+		if err != nil {
+			log.Printf("trading days fetch failed for %s: %v", mkt, err)
+			continue
+		}
+		c := Calendar{
+			Market:          mkt,
+			Timezone:        marketTimezones[mkt],
+			From:            begin.Format("2006-01-02"),
+			Through:         end.Format("2006-01-02"),
+			TradingDays:     dates(days.TradeDay),
+			HalfTradingDays: dates(days.HalfTradeDay),
+			Sessions:        regular[mkt],
+			UpdatedAt:       time.Now().Format(time.RFC3339),
+		}
+		sort.Slice(c.Sessions, func(i, j int) bool { return c.Sessions[i].Begin < c.Sessions[j].Begin })
+		if err := writeJSON(CalendarPath(root, mkt), c); err != nil {
+			log.Printf("calendar write %s: %v", mkt, err)
+			continue
+		}
+		log.Printf("trading calendar refreshed: %s (%d trading days, %d sessions)", mkt, len(c.TradingDays), len(c.Sessions))
+	}
+}
+
+// State reports where t falls in the market's trading day and, unless the
+// market is open, when the next session opens. Dates outside the cached
+// range, or a calendar without sessions, count as open: without data the
+// controller behaves as it did before calendars existed.
+func (c *Calendar) State(t time.Time) (state string, next time.Time) {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	lt := t.In(loc)
+	day := lt.Format("2006-01-02")
+	if len(c.Sessions) == 0 || day < c.From || day > c.Through {
+		return SessionOpen, time.Time{}
+	}
+
+	if c.isTradingDay(day) {
+		for i, s := range c.sessionsOn(lt) {
+			switch {
+			case lt.Before(s[0]) && i == 0:
+				return SessionPreOpen, s[0]
+			case lt.Before(s[0]):
+				return SessionBreak, s[0]
+			case lt.Before(s[1]):
+				return SessionOpen, time.Time{}
+			}
+		}
+	}
+
+	for d := 1; d <= calendarDays+1; d++ {
+		nd := lt.AddDate(0, 0, d)
+		if c.isTradingDay(nd.Format("2006-01-02")) {
+			if ss := c.sessionsOn(nd); len(ss) > 0 {
+				return SessionClosed, ss[0][0]
+			}
+		}
+	}
+	return SessionClosed, time.Time{}
+}
+
+// SessionEnded reports whether t falls on a trading day after its last
+// session has closed. Weekends, holidays and the hours before the open are
+// not ended: the day's session is still to come.
+func (c *Calendar) SessionEnded(t time.Time) bool {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	lt := t.In(loc)
+	day := lt.Format("2006-01-02")
+	if len(c.Sessions) == 0 || day < c.From || day > c.Through || !c.isTradingDay(day) {
+		return false
+	}
+	ss := c.sessionsOn(lt)
+	return len(ss) > 0 && !lt.Before(ss[len(ss)-1][1])
+}
+
+func (c *Calendar) isTradingDay(day string) bool {
+	for _, d := range c.TradingDays {
+		if d == day {
+			return true
+		}
+	}
+	for _, d := range c.HalfTradingDays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionsOn returns the [begin, end) times of the sessions on the day of
+// t (in the exchange zone), cut short on half trading days.
+func (c *Calendar) sessionsOn(t time.Time) [][2]time.Time {
+	cutoff := ""
+	for _, d := range c.HalfTradingDays {
+		if d == t.Format("2006-01-02") {
+			cutoff = halfDayClose[c.Market]
+		}
+	}
+	var out [][2]time.Time
+	for _, s := range c.Sessions {
+		if cutoff != "" && s.Begin >= cutoff {
+			continue
+		}
+		end := s.End
+		if cutoff != "" && end > cutoff {
+			end = cutoff
+		}
+		b, errB := clockOn(t, s.Begin)
+		e, errE := clockOn(t, end)
+		if errB == nil && errE == nil {
+			out = append(out, [2]time.Time{b, e})
+		}
+	}
+	return out
+}
+
+// clockOn returns HH:MM on the day of t, in t's location.
+func clockOn(t time.Time, hm string) (time.Time, error) {
+	c, err := time.Parse("15:04", hm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), c.Hour(), c.Minute(), 0, 0, t.Location()), nil
+}
+
+// hhmm formats an SDK session time such as 930 as "09:30".
+func hhmm(v int32) string {
+	return fmt.Sprintf("%02d:%02d", v/100, v%100)
+}
+
+func dates(ts []time.Time) []string {
+	out := make([]string, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, t.Format("2006-01-02"))
+	}
+	return out
+}
@@ -33,6 +33,13 @@ var quoteFileMap = []quoteFile{
 	{"5D", quote.PeriodFiveMinute, 390},
 }
 
+// HoldDir returns the quote directory of symbol, /quote/hold/{SYMBOL}/.
+// root is the FS root: account roots (accounts/{name}/) have no quote/ tree
+// of their own and share the FS root's.
+func HoldDir(root, symbol string) string {
+	return filepath.Join(root, "quote", "hold", symbol)
+}
+
 // RefreshQuotes scans /quote/track/ for pending refresh requests.
 // When a track file exists, we fetch quote data into /quote/hold/{SYMBOL}/,
 // then remove the track file (one-shot trigger).
@@ -75,7 +82,12 @@ func fetchAndWriteQuote(ctx context.Context, qc *quote.QuoteContext, symbolDir,
 		log.Printf("  intraday %s: %v", symbol, err)
 	}
 
-	// 3. Candlestick files (D, W, M, Y, 5D)
+	// 3. Static info (board lot, tick ladder)
+	if err := writeStatic(ctx, qc, symbolDir, symbol); err != nil {
+		log.Printf("  static %s: %v", symbol, err)
+	}
+
+	// 4. Candlestick files (D, W, M, Y, 5D)
 	for _, qf := range quoteFileMap {
 		if err := writeCandlesticks(ctx, qc, symbolDir, symbol, qf.Name, qf.Period, qf.Count); err != nil {
 			log.Printf("  %s %s: %v", qf.Name, symbol, err)
@@ -291,3 +303,31 @@ func ReadOverview(holdDir string) *model.QuoteOverview {
 	}
 	return &ov
 }
+
+// ReadIntraday reads the minute bars from a symbol's hold directory.
+// Returns nil if the file doesn't exist or can't be parsed.
+func ReadIntraday(holdDir string) []model.IntradayPoint {
+	data, err := os.ReadFile(filepath.Join(holdDir, "intraday.json"))
+	if err != nil {
+		return nil
+	}
+	var pts []model.IntradayPoint
+	if json.Unmarshal(data, &pts) != nil {
+		return nil
+	}
+	return pts
+}
+
+// ReadCandlesticks reads a candlestick file (D, W, M, Y, 5D) from a symbol's
+// hold directory. Returns nil if the file doesn't exist or can't be parsed.
+func ReadCandlesticks(holdDir, name string) []model.Candlestick {
+	data, err := os.ReadFile(filepath.Join(holdDir, name+".json"))
+	if err != nil {
+		return nil
+	}
+	var sticks []model.Candlestick
+	if json.Unmarshal(data, &sticks) != nil {
+		return nil
+	}
+	return sticks
+}
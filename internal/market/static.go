@@ -0,0 +1,121 @@
+package market
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"longbridge-fs/internal/model"
+
+	"github.com/longbridge/openapi-go/quote"
+	"github.com/shopspring/decimal"
+)
+
+// tickLadders holds the price steps of each market, keyed by symbol suffix.
+// The StaticInfo API reports lot sizes only, so tick rules are the
+// exchanges' published spread tables.
+var tickLadders = map[string][]model.TickRule{
+	"HK": {
+		{From: 0, Tick: 0.001},
+		{From: 0.25, Tick: 0.005},
+		{From: 0.5, Tick: 0.01},
+		{From: 10, Tick: 0.02},
+		{From: 20, Tick: 0.05},
+		{From: 100, Tick: 0.1},
+		{From: 200, Tick: 0.2},
+		{From: 500, Tick: 0.5},
+		{From: 1000, Tick: 1},
+		{From: 2000, Tick: 2},
+		{From: 5000, Tick: 5},
+	},
+	"US": {
+		{From: 0, Tick: 0.0001},
+		{From: 1, Tick: 0.01},
+	},
+	"SH": {{From: 0, Tick: 0.01}},
+	"SZ": {{From: 0, Tick: 0.01}},
+	"SG": {
+		{From: 0, Tick: 0.001},
+		{From: 0.2, Tick: 0.005},
+		{From: 1, Tick: 0.01},
+	},
+}
+
+// writeStatic writes static.json with the symbol's board lot and tick ladder.
+func writeStatic(ctx context.Context, qc *quote.QuoteContext, dir, symbol string) error {
+	infos, err := qc.StaticInfo(ctx, []string{symbol})
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return fmt.Errorf("no static info for %s", symbol)
+	}
+	si := infos[0]
+	name := si.NameEn
+	if name == "" {
+		name = si.NameHk
+	}
+	info := model.StaticInfo{
+		Symbol:    symbol,
+		Name:      name,
+		Exchange:  si.Exchange,
+		Currency:  si.Currency,
+		LotSize:   int64(si.LotSize),
+		TickSizes: tickLadders[strings.ToUpper(symbol[strings.LastIndex(symbol, ".")+1:])],
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	return writeJSON(filepath.Join(dir, "static.json"), info)
+}
+
+// ReadStatic reads the static info from a symbol's hold directory.
+// Returns nil if the file doesn't exist or can't be parsed.
+func ReadStatic(holdDir string) *model.StaticInfo {
+	data, err := os.ReadFile(filepath.Join(holdDir, "static.json"))
+	if err != nil {
+		return nil
+	}
+	var info model.StaticInfo
+	if json.Unmarshal(data, &info) != nil {
+		return nil
+	}
+	return &info
+}
+
+// LotQty rounds qty down to whole board lots. Without static info, or with
+// a lot size of 1, qty is returned unchanged.
+func LotQty(info *model.StaticInfo, qty int64) int64 {
+	if info == nil || info.LotSize <= 1 {
+		return qty
+	}
+	return qty / info.LotSize * info.LotSize
+}
+
+// TickPrice rounds price to the tick that applies at that price: up if up,
+// else down. Without a tick ladder, price is returned unchanged.
+func TickPrice(info *model.StaticInfo, price float64, up bool) float64 {
+	if info == nil || len(info.TickSizes) == 0 || price <= 0 {
+		return price
+	}
+	tick := info.TickSizes[0].Tick
+	for _, r := range info.TickSizes {
+		if price >= r.From {
+			tick = r.Tick
+		}
+	}
+	if tick <= 0 {
+		return price
+	}
+	t := decimal.NewFromFloat(tick)
+	steps := decimal.NewFromFloat(price).Div(t)
+	if up {
+		steps = steps.Ceil()
+	} else {
+		steps = steps.Floor()
+	}
+	v, _ := steps.Mul(t).Float64()
+	return v
+}
@@ -21,10 +21,15 @@ type SubscriptionManager struct {
 	root            string
 	subscriptions   map[string]bool // symbol -> subscribed
 	mu              sync.RWMutex
+	writeMu         sync.Mutex // serializes overview.json updates from pushes
 	subscribeDir    string
 	unsubscribeDir  string
 }
 
+// subTypes are the push channels requested per symbol: quotes for
+// overview.json and depth for its best bid/ask.
+var subTypes = []quote.SubType{quote.SubTypeQuote, quote.SubTypeDepth}
+
 // NewSubscriptionManager creates a new subscription manager
 func NewSubscriptionManager(qc *quote.QuoteContext, root string) *SubscriptionManager {
 	sm := &SubscriptionManager{
@@ -38,6 +43,7 @@ func NewSubscriptionManager(qc *quote.QuoteContext, root string) *SubscriptionMa
 	// Set up quote push callback
 	if qc != nil {
 		qc.OnQuote(sm.handleQuotePush)
+		qc.OnDepth(sm.handleDepthPush)
 	}
 
 	return sm
@@ -97,7 +103,7 @@ func (sm *SubscriptionManager) processSubscribeRequests(ctx context.Context) err
 	}
 
 	// Subscribe to new symbols
-	err = sm.qc.Subscribe(ctx, toSubscribe, []quote.SubType{quote.SubTypeQuote}, true)
+	err = sm.qc.Subscribe(ctx, toSubscribe, subTypes, true)
 	if err != nil {
 		log.Printf("subscribe failed for %v: %v", toSubscribe, err)
 		return err
@@ -111,6 +117,19 @@ func (sm *SubscriptionManager) processSubscribeRequests(ctx context.Context) err
 
 	log.Printf("subscribed to real-time quotes: %v", toSubscribe)
 
+	// Lot sizes and ticks for orders on subscribed symbols
+	for _, symbol := range toSubscribe {
+		dir := filepath.Join(sm.root, "quote", "hold", symbol)
+		if ReadStatic(dir) != nil {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err == nil {
+			if err := writeStatic(ctx, sm.qc, dir, symbol); err != nil {
+				log.Printf("static %s: %v", symbol, err)
+			}
+		}
+	}
+
 	// Remove subscribe request files
 	for _, f := range filesToRemove {
 		os.Remove(f)
@@ -151,7 +170,7 @@ func (sm *SubscriptionManager) processUnsubscribeRequests(ctx context.Context) e
 	}
 
 	// Unsubscribe from symbols
-	err = sm.qc.Unsubscribe(ctx, false, toUnsubscribe, []quote.SubType{quote.SubTypeQuote})
+	err = sm.qc.Unsubscribe(ctx, false, toUnsubscribe, subTypes)
 	if err != nil {
 		log.Printf("unsubscribe failed for %v: %v", toUnsubscribe, err)
 		return err
@@ -184,7 +203,10 @@ func (sm *SubscriptionManager) handleQuotePush(push *quote.PushQuote) {
 	}
 
 	// Update overview.json with real-time data
-	if err := sm.writeRealtimeOverview(holdSymbolDir, push); err != nil {
+	sm.writeMu.Lock()
+	err := sm.writeRealtimeOverview(holdSymbolDir, push)
+	sm.writeMu.Unlock()
+	if err != nil {
 		log.Printf("quote push write %s: %v", symbol, err)
 		return
 	}
@@ -192,6 +214,32 @@ func (sm *SubscriptionManager) handleQuotePush(push *quote.PushQuote) {
 	log.Printf("quote push updated: %s -> hold/%s/overview.json", symbol, symbol)
 }
 
+// handleDepthPush records the best bid/ask of a depth update in overview.json
+func (sm *SubscriptionManager) handleDepthPush(push *quote.PushDepth) {
+	holdSymbolDir := filepath.Join(sm.root, "quote", "hold", push.Symbol)
+	if err := os.MkdirAll(holdSymbolDir, 0755); err != nil {
+		log.Printf("depth push mkdir %s: %v", push.Symbol, err)
+		return
+	}
+
+	sm.writeMu.Lock()
+	defer sm.writeMu.Unlock()
+
+	ov := ReadOverview(holdSymbolDir)
+	if ov == nil {
+		ov = &model.QuoteOverview{Symbol: push.Symbol}
+	}
+	if len(push.Bid) > 0 && push.Bid[0] != nil {
+		ov.Bid = decFloat(push.Bid[0].Price)
+	}
+	if len(push.Ask) > 0 && push.Ask[0] != nil {
+		ov.Ask = decFloat(push.Ask[0].Price)
+	}
+	if err := writeJSON(filepath.Join(holdSymbolDir, "overview.json"), ov); err != nil {
+		log.Printf("depth push write %s: %v", push.Symbol, err)
+	}
+}
+
 // writeRealtimeOverview writes real-time quote data to overview.json
 func (sm *SubscriptionManager) writeRealtimeOverview(dir string, push *quote.PushQuote) error {
 	last := decFloat(push.LastDone)
@@ -223,6 +271,9 @@ func (sm *SubscriptionManager) writeRealtimeOverview(dir string, push *quote.Pus
 		ChangePct: roundN(changePct, 2),
 		UpdatedAt: time.Unix(push.Timestamp, 0).UTC().Format(time.RFC3339),
 	}
+	if prevOverview != nil {
+		ov.Bid, ov.Ask = prevOverview.Bid, prevOverview.Ask
+	}
 
 	// Also write text format for human readability
 	var sb strings.Builder
@@ -49,6 +49,7 @@ type ParsedOrder struct {
 	Qty         string
 	OrderType   string
 	TIF         string
+	ExpireDate  string // YYYY-MM-DD, required for GTD
 	Price       string // for LIMIT orders
 	Market      string // default: US
 	// Phase 1: Extended traceability fields
@@ -56,9 +57,30 @@ type ParsedOrder struct {
 	RebalanceID string   // links to portfolio rebalance
 	SignalRefs  []string // triggering signals (comma-separated in beancount)
 	// Phase 4: Algorithm execution fields
-	Algo         string // NONE (default), TWAP, ICEBERG
-	AlgoDuration string // e.g., "30m", "1h"
-	AlgoSlices   int    // number of slices to split order into
+	Algo         string  // NONE (default), TWAP, ICEBERG
+	AlgoDuration string  // e.g., "30m", "1h"
+	AlgoSlices   int     // number of slices to split order into
+	AlgoRepeg    bool    // ICEBERG: re-peg working slices to the bid/ask
+	AlgoVariance float64 // ICEBERG: random +/- fraction of the visible qty
+	AlgoStart    string  // VWAP/POV window start, HH:MM or RFC3339
+	AlgoEnd      string  // VWAP/POV window end, HH:MM or RFC3339
+	AlgoPovRate  float64 // POV: target share of market volume, (0, 1]
+	// Remark overrides the venue remark (default: "longbridge-fs:{intent_id}")
+	Remark string
+	// Order management actions (CANCEL, REPLACE) target an existing order
+	Action       string // empty for new orders
+	OrderID      string // venue order ID targeted by Action
+	// Conditional orders (LIT/MIT/TSLPAMT/TSLPPCT)
+	TriggerPrice    string // LIT/MIT trigger price
+	TrailingAmount  string // TSLPAMT trailing distance
+	TrailingPercent string // TSLPPCT trailing distance in percent
+	LimitOffset     string // TSLPAMT/TSLPPCT limit offset from the trigger
+	// Order groups (type BRACKET/OCO): linked exit legs
+	GroupID    string // shared by all legs, default: intent_id
+	TakeProfit string // limit price of the take-profit leg
+	StopLoss   string // trigger price of the stop-loss leg
+	StopLimit  string // optional limit for the stop-loss leg (LIT instead of MIT)
+	ExitTIF    string // TIF of the exit legs, default: GTC
 }
 
 // --- Quote JSON types ---
@@ -75,11 +97,31 @@ type QuoteOverview struct {
 	Turnover   float64 `json:"turnover"`
 	PreMarket  float64 `json:"pre_market,omitempty"`
 	PostMarket float64 `json:"post_market,omitempty"`
+	Bid        float64 `json:"bid,omitempty"` // best bid from depth push
+	Ask        float64 `json:"ask,omitempty"` // best ask from depth push
 	Change     float64 `json:"change"`
 	ChangePct  float64 `json:"change_pct"`
 	UpdatedAt  string  `json:"updated_at"`
 }
 
+// StaticInfo is the JSON structure for /quote/hold/{SYMBOL}/static.json
+type StaticInfo struct {
+	Symbol    string     `json:"symbol"`
+	Name      string     `json:"name"`
+	Exchange  string     `json:"exchange"`
+	Currency  string     `json:"currency"`
+	LotSize   int64      `json:"lot_size"`
+	TickSizes []TickRule `json:"tick_sizes"` // ascending by from
+	UpdatedAt string     `json:"updated_at"`
+}
+
+// TickRule is one step of a tick ladder: prices at or above From move in
+// increments of Tick.
+type TickRule struct {
+	From float64 `json:"from"`
+	Tick float64 `json:"tick"`
+}
+
 // Candlestick is one K-line bar in JSON output
 type Candlestick struct {
 	Date     string  `json:"date"`
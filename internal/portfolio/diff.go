@@ -8,12 +8,14 @@ import (
 	"path/filepath"
 	"time"
 
+	"longbridge-fs/internal/market"
 	"longbridge-fs/internal/model"
 )
 
 // ComputeDiff calculates the difference between target and current portfolios
-// and writes the result to portfolio/diff.json
-func ComputeDiff(root string) error {
+// and writes the result to portfolio/diff.json. Prices are read under
+// quoteRoot, the FS root.
+func ComputeDiff(root, quoteRoot string) error {
 	// Read target portfolio
 	target, err := ParseTarget(root)
 	if err != nil {
@@ -100,7 +102,7 @@ func ComputeDiff(root string) error {
 			action = "ADD"
 			estimatedSide = "BUY"
 			// Estimate quantity based on current price
-			if currentPrice := getSymbolPrice(root, symbol); currentPrice > 0 {
+			if currentPrice := getSymbolPrice(quoteRoot, symbol); currentPrice > 0 {
 				estimatedQty = int64(targetValue / currentPrice)
 				deltaQty = estimatedQty
 			}
@@ -108,14 +110,14 @@ func ComputeDiff(root string) error {
 			if deltaValue > 0 {
 				action = "REDUCE"
 				estimatedSide = "BUY"
-				if currentPrice := getSymbolPrice(root, symbol); currentPrice > 0 {
+				if currentPrice := getSymbolPrice(quoteRoot, symbol); currentPrice > 0 {
 					estimatedQty = int64(deltaValue / currentPrice)
 					deltaQty = estimatedQty
 				}
 			} else {
 				action = "REDUCE"
 				estimatedSide = "SELL"
-				if currentPrice := getSymbolPrice(root, symbol); currentPrice > 0 {
+				if currentPrice := getSymbolPrice(quoteRoot, symbol); currentPrice > 0 {
 					estimatedQty = int64(-deltaValue / currentPrice)
 					deltaQty = -estimatedQty
 				}
@@ -148,7 +150,7 @@ func ComputeDiff(root string) error {
 
 // getSymbolPrice retrieves current price from quote/hold/{SYMBOL}/overview.json
 func getSymbolPrice(root, symbol string) float64 {
-	overviewPath := filepath.Join(root, "quote", "hold", symbol, "overview.json")
+	overviewPath := filepath.Join(market.HoldDir(root, symbol), "overview.json")
 	data, err := os.ReadFile(overviewPath)
 	if err != nil {
 		return 0
@@ -8,12 +8,14 @@ import (
 	"strconv"
 	"time"
 
+	"longbridge-fs/internal/market"
 	"longbridge-fs/internal/model"
 )
 
 // SyncCurrent reads account/state.json and quote/hold/*/overview.json
 // to generate portfolio/current.json with position weights and market values.
-func SyncCurrent(root string) error {
+// Quotes are read under quoteRoot, the FS root.
+func SyncCurrent(root, quoteRoot string) error {
 	// Read account state
 	stateData, err := os.ReadFile(filepath.Join(root, "account", "state.json"))
 	if err != nil {
@@ -46,7 +48,7 @@ func SyncCurrent(root string) error {
 		}
 
 		// Look up current price
-		overviewPath := filepath.Join(root, "quote", "hold", pos.Symbol, "overview.json")
+		overviewPath := filepath.Join(market.HoldDir(quoteRoot, pos.Symbol), "overview.json")
 		overviewData, err := os.ReadFile(overviewPath)
 		if err != nil {
 			// Skip if no quote available
@@ -5,16 +5,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"longbridge-fs/internal/ledger"
+	"longbridge-fs/internal/market"
 	"longbridge-fs/internal/model"
 )
 
 // AutoCreatePending reads portfolio/diff.json and, when requires_rebalance is true,
 // automatically generates portfolio/rebalance/pending.json so the controller can
 // process it on the next cycle. It is a no-op when pending.json already exists.
-func AutoCreatePending(root string) error {
+// Board lots are read under quoteRoot, the FS root.
+func AutoCreatePending(root, quoteRoot string) error {
 	// Read diff.json
 	diffPath := filepath.Join(root, "portfolio", "diff.json")
 	data, err := os.ReadFile(diffPath)
@@ -51,14 +55,16 @@ func AutoCreatePending(root string) error {
 	}
 
 	for _, adj := range diff.Adjustments {
-		if adj.EstimatedQty <= 0 {
+		// Whole board lots only; an adjustment smaller than a lot is skipped
+		qty := market.LotQty(market.ReadStatic(market.HoldDir(quoteRoot, adj.Symbol)), adj.EstimatedQty)
+		if qty <= 0 {
 			continue
 		}
 
 		order := model.RebalanceOrder{
 			Symbol: adj.Symbol,
 			Side:   adj.EstimatedSide,
-			Qty:    adj.EstimatedQty,
+			Qty:    qty,
 			Type:   "MARKET",
 			TIF:    "DAY",
 		}
@@ -125,39 +131,30 @@ func ProcessRebalance(root string) error {
 func writeRebalanceOrders(root string, pending *model.RebalancePending) error {
 	beancountPath := filepath.Join(root, "trade", "beancount.txt")
 
-	f, err := os.OpenFile(beancountPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
 	timestamp := time.Now().UTC().Format("2006-01-02")
 
+	// All orders of a rebalance go in with one locked append
+	var text strings.Builder
 	for i, order := range pending.Orders {
 		intentID := fmt.Sprintf("%s-%03d", strings.ReplaceAll(pending.RebalanceID, "rebal-", ""), i+1)
 
-		var orderLines strings.Builder
-		orderLines.WriteString("\n")
-		orderLines.WriteString(fmt.Sprintf("%s * \"ORDER\" \"%s %d %s %s\"\n",
-			timestamp, order.Side, order.Qty, order.Symbol, pending.RebalanceID))
-		orderLines.WriteString(fmt.Sprintf("  ; intent_id: %s\n", intentID))
-		orderLines.WriteString(fmt.Sprintf("  ; side: %s\n", order.Side))
-		orderLines.WriteString(fmt.Sprintf("  ; symbol: %s\n", order.Symbol))
-		orderLines.WriteString(fmt.Sprintf("  ; qty: %d\n", order.Qty))
-		orderLines.WriteString(fmt.Sprintf("  ; type: %s\n", order.Type))
-		if order.Price > 0 {
-			orderLines.WriteString(fmt.Sprintf("  ; price: %.2f\n", order.Price))
+		o := model.ParsedOrder{
+			IntentID:    intentID,
+			Side:        order.Side,
+			Symbol:      order.Symbol,
+			Qty:         strconv.FormatInt(order.Qty, 10),
+			OrderType:   order.Type,
+			TIF:         order.TIF,
+			Source:      "rebalance",
+			RebalanceID: pending.RebalanceID,
 		}
-		orderLines.WriteString(fmt.Sprintf("  ; tif: %s\n", order.TIF))
-		orderLines.WriteString("  ; source: rebalance\n")
-		orderLines.WriteString(fmt.Sprintf("  ; rebalance_id: %s\n", pending.RebalanceID))
-
-		if _, err := f.WriteString(orderLines.String()); err != nil {
-			return err
+		if order.Price > 0 {
+			o.Price = fmt.Sprintf("%.2f", order.Price)
 		}
+		text.WriteString(ledger.FormatOrder(timestamp, o, nil))
 	}
 
-	return nil
+	return ledger.Append(beancountPath, text.String())
 }
 
 // archivePending saves the pending rebalance to history with timestamp
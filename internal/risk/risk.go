@@ -6,16 +6,21 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"longbridge-fs/internal/ledger"
 	"longbridge-fs/internal/market"
 	"longbridge-fs/internal/model"
 )
 
 // CheckRiskRules reads /trade/risk_control.json, compares current prices
 // against stop-loss/take-profit levels, and auto-appends ORDER entries
-// to beancount.txt when a rule triggers.
+// (MARKET, DAY, source: risk_trigger) to beancount.txt when a rule
+// triggers. Without qty (or with qty "ALL") the order closes the available
+// quantity in account/state.json; a rule with nothing to close stays in
+// place until there is. Prices are read under quoteRoot, the FS root.
 //
 // risk_control.json format:
 //
@@ -23,7 +28,7 @@ import (
 //	  "700.HK":  { "stop_loss": 280.0, "take_profit": 350.0 },
 //	  "AAPL.US": { "stop_loss": 150.0, "take_profit": 210.0, "qty": "10" }
 //	}
-func CheckRiskRules(root string) error {
+func CheckRiskRules(root, quoteRoot string) error {
 	rcPath := filepath.Join(root, "trade", "risk_control.json")
 	data, err := os.ReadFile(rcPath)
 	if err != nil {
@@ -38,7 +43,7 @@ func CheckRiskRules(root string) error {
 		return fmt.Errorf("parse risk_control.json: %w", err)
 	}
 
-	holdBase := filepath.Join(root, "quote", "hold")
+	holdBase := filepath.Join(quoteRoot, "quote", "hold")
 	bcPath := filepath.Join(root, "trade", "beancount.txt")
 
 	triggered := []string{}
@@ -74,25 +79,35 @@ func CheckRiskRules(root string) error {
 		if rule.Side != "" {
 			side = strings.ToUpper(rule.Side)
 		}
-		qty := "ALL"
-		if rule.Qty != "" {
-			qty = rule.Qty
+		qty := rule.Qty
+		if qty == "" || strings.EqualFold(qty, "ALL") {
+			qty = availableQty(root, symbol)
+			if qty == "" {
+				if key := root + " " + symbol; !unresolved[key] {
+					log.Printf("risk: %s %s, but no available position in account/state.json; rule kept", symbol, reason)
+					unresolved[key] = true
+				}
+				continue
+			}
 		}
-
-		intentID := fmt.Sprintf("risk-%s-%d", strings.ReplaceAll(symbol, ".", "-"), time.Now().UnixMilli())
-		date := time.Now().UTC().Format("2006-01-02")
-
-		entry := fmt.Sprintf("\n%s ORDER\n  intent_id: %s\n  side: %s\n  symbol: %s\n  qty: %s\n  order_type: MARKET\n  tif: DAY\n  reason: %s\n",
-			date, intentID, side, symbol, qty, reason)
+		delete(unresolved, root+" "+symbol)
+
+		o := model.ParsedOrder{
+			IntentID:  fmt.Sprintf("risk-%s-%d", strings.ReplaceAll(symbol, ".", "-"), time.Now().UnixMilli()),
+			Side:      side,
+			Symbol:    symbol,
+			Qty:       qty,
+			OrderType: "MARKET",
+			TIF:       "DAY",
+			Source:    "risk_trigger",
+		}
+		entry := ledger.FormatOrder(time.Now().UTC().Format("2006-01-02"), o, map[string]string{"reason": reason})
 
 		// Append to beancount.txt
-		f, err := os.OpenFile(bcPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
-		if err != nil {
-			log.Printf("risk: cannot open beancount.txt: %v", err)
+		if err := ledger.Append(bcPath, entry); err != nil {
+			log.Printf("risk: cannot append to beancount.txt: %v", err)
 			continue
 		}
-		f.WriteString(entry)
-		f.Close()
 
 		log.Printf("risk: %s %s", symbol, reason)
 		triggered = append(triggered, symbol)
@@ -111,3 +126,31 @@ func CheckRiskRules(root string) error {
 
 	return nil
 }
+
+// unresolved holds the rules ("root symbol") that triggered without a
+// position to size the exit, so the warning is logged once.
+var unresolved = make(map[string]bool)
+
+// availableQty returns the available quantity of symbol in
+// account/state.json as a whole number of shares, empty if there is none.
+func availableQty(root, symbol string) string {
+	data, err := os.ReadFile(filepath.Join(root, "account", "state.json"))
+	if err != nil {
+		return ""
+	}
+	var state model.AccountState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return ""
+	}
+	for _, p := range state.Positions {
+		if !strings.EqualFold(p.Symbol, symbol) {
+			continue
+		}
+		n, err := strconv.ParseFloat(p.Available, 64)
+		if err != nil || n < 1 {
+			return ""
+		}
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return ""
+}